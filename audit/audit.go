@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+// Events - Where events are stored (set from main)
+var Events repository.SecurityEventRepository
+
+// Security event types
+const (
+	EventLogin            = "login"
+	EventLoginMFA         = "login_mfa"
+	EventTokenRefresh     = "token_refresh"
+	EventLogout           = "logout"
+	EventRegister         = "register"
+	EventPasswordReset    = "password_reset"
+	EventPasswordChanged  = "password_changed"
+	EventPermissionDenied = "permission_denied"
+	EventAccountUnlocked  = "account_unlocked"
+	EventMFAEnabled       = "mfa_enabled"
+	EventMFADisabled      = "mfa_disabled"
+	EventAPIKeyCreated    = "api_key_created"
+	EventAPIKeyRevoked    = "api_key_revoked"
+	EventSessionRevoked   = "session_revoked"
+	EventLogLevelChanged  = "log_level_changed"
+)
+
+// Outcomes
+const (
+	Success = "success"
+	Failure = "failure"
+	Denied  = "denied"
+)
+
+// Event - Optional fields of a security event
+type Event struct {
+	UserID   int
+	Username string
+	Details  string
+}
+
+// Record - Store a security event with the client IP and user agent of
+// the request. When the event has no user, the authenticated user of the
+// request (if any) is used.
+func Record(c *gin.Context, eventType, outcome string, event Event) {
+	if event.UserID == 0 {
+		if id, ok := c.Get("user_id"); ok {
+			event.UserID, _ = id.(int)
+		}
+	}
+	if event.Username == "" {
+		event.Username = c.GetString("username")
+	}
+
+	if Events == nil {
+		slog.ErrorContext(c.Request.Context(), "No security event store configured", "event_type", eventType, "outcome", outcome)
+		return
+	}
+
+	// Still record the event when the request was cancelled or timed out
+	ctx, cancel := database.WithQueryTimeout(context.WithoutCancel(c.Request.Context()), "audit")
+	defer cancel()
+
+	var userID *int
+	if event.UserID != 0 {
+		userID = &event.UserID
+	}
+	err := Events.Create(ctx, models.SecurityEvent{
+		EventType: eventType,
+		Outcome:   outcome,
+		UserID:    userID,
+		Username:  optional(event.Username),
+		IPAddress: optional(c.ClientIP()),
+		UserAgent: optional(c.Request.UserAgent()),
+		Details:   optional(event.Details),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record security event", "event_type", eventType, "outcome", outcome, "error", err)
+	}
+}
+
+// optional - nil for an empty string (stored as NULL)
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
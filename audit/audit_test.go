@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// withEvents - Record the events of the test in memory
+func withEvents(t *testing.T) repository.SecurityEventRepository {
+	t.Helper()
+	events := repository.NewMemory().SecurityEvents
+	previous := Events
+	Events = events
+	t.Cleanup(func() { Events = previous })
+	return events
+}
+
+func testContext(ctx context.Context) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/users/login", nil).WithContext(ctx)
+	c.Request.RemoteAddr = "10.0.0.7:4321"
+	c.Request.Header.Set("User-Agent", "books-cli/1.0")
+	return c
+}
+
+func TestRecord(t *testing.T) {
+	events := withEvents(t)
+
+	Record(testContext(context.Background()), EventLogin, Failure, Event{Username: "budi", Details: "invalid password"})
+
+	stored, err := events.List(context.Background(), repository.SecurityEventFilter{Limit: 10})
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("events = %+v, %v", stored, err)
+	}
+	event := stored[0]
+	if event.EventType != EventLogin || event.Outcome != Failure || event.UserID != nil {
+		t.Fatalf("event = %+v", event)
+	}
+	for name, got := range map[string]*string{"username": event.Username, "ip": event.IPAddress, "user agent": event.UserAgent, "details": event.Details} {
+		if got == nil {
+			t.Fatalf("%s not recorded", name)
+		}
+	}
+	if *event.Username != "budi" || *event.IPAddress != "10.0.0.7" || *event.UserAgent != "books-cli/1.0" || *event.Details != "invalid password" {
+		t.Fatalf("event = %s %s %s %s", *event.Username, *event.IPAddress, *event.UserAgent, *event.Details)
+	}
+}
+
+func TestRecordUsesAuthenticatedUser(t *testing.T) {
+	events := withEvents(t)
+	c := testContext(context.Background())
+	c.Set("user_id", 7)
+	c.Set("username", "budi")
+
+	Record(c, EventAPIKeyCreated, Success, Event{})
+	// Explicit fields win over the authenticated user
+	Record(c, EventAccountUnlocked, Success, Event{UserID: 9, Username: "sari"})
+
+	stored, err := events.List(context.Background(), repository.SecurityEventFilter{Limit: 10})
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("events = %+v, %v", stored, err)
+	}
+	unlocked, created := stored[0], stored[1]
+	if created.UserID == nil || *created.UserID != 7 || *created.Username != "budi" || created.Details != nil {
+		t.Fatalf("event without user = %+v", created)
+	}
+	if *unlocked.UserID != 9 || *unlocked.Username != "sari" {
+		t.Fatalf("event with user = %+v", unlocked)
+	}
+}
+
+// contextCheckingEvents - Refuses events whose context is already done,
+// like a database would
+type contextCheckingEvents struct {
+	repository.SecurityEventRepository
+}
+
+func (e contextCheckingEvents) Create(ctx context.Context, event models.SecurityEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.SecurityEventRepository.Create(ctx, event)
+}
+
+func TestRecordAfterCancellation(t *testing.T) {
+	events := withEvents(t)
+	Events = contextCheckingEvents{events}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	Record(testContext(ctx), EventLogin, Denied, Event{Username: "budi"})
+
+	if stored, err := events.List(context.Background(), repository.SecurityEventFilter{Limit: 10}); err != nil || len(stored) != 1 {
+		t.Fatalf("events = %+v, %v; want the event of the cancelled request", stored, err)
+	}
+}
+
+func TestRecordWithoutStore(t *testing.T) {
+	previous := Events
+	Events = nil
+	t.Cleanup(func() { Events = previous })
+
+	// Logged, not a panic
+	Record(testContext(context.Background()), EventLogin, Success, Event{})
+}
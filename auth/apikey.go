@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Scopes that can be granted to an API key
+var KnownScopes = []string{
+	"books:read", "books:write", "books:*",
+	"categories:read", "categories:write", "categories:*",
+}
+
+const apiKeyPrefix = "bk_"
+
+// GenerateAPIKey - Create a new random API key, returning the full key
+// (shown once), a short display prefix and the hash to store
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	prefix = key[:len(apiKeyPrefix)+8]
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey - SHA-256 hash of an API key as stored in the database
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidScope - Whether scope is one of KnownScopes
+func ValidScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeAllows - Whether any granted scope covers the required one,
+// e.g. "categories:*" covers "categories:read"
+func ScopeAllows(granted []string, required string) bool {
+	resource, _, _ := strings.Cut(required, ":")
+	for _, scope := range granted {
+		if scope == required || scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "bk_") || len(key) != len("bk_")+64 {
+		t.Fatalf("key = %q, want bk_ and 64 hex digits", key)
+	}
+	if prefix != key[:11] {
+		t.Fatalf("prefix = %q, want the first 11 characters of the key", prefix)
+	}
+	if hash != HashAPIKey(key) || hash == key || len(hash) != 64 {
+		t.Fatalf("hash = %q, want the SHA-256 of the key", hash)
+	}
+
+	other, _, _, err := GenerateAPIKey()
+	if err != nil || other == key {
+		t.Fatalf("second key = %q, %v; want a different key", other, err)
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for _, scope := range KnownScopes {
+		if !ValidScope(scope) {
+			t.Errorf("ValidScope(%q) = false", scope)
+		}
+	}
+	for _, scope := range []string{"", "books", "books:delete", "users:read", "*", "*:*"} {
+		if ValidScope(scope) {
+			t.Errorf("ValidScope(%q) = true", scope)
+		}
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	for _, tt := range []struct {
+		granted  []string
+		required string
+		want     bool
+	}{
+		{[]string{"books:read"}, "books:read", true},
+		{[]string{"books:read"}, "books:write", false},
+		{[]string{"books:*"}, "books:write", true},
+		{[]string{"books:*"}, "categories:read", false},
+		{[]string{"categories:write", "books:read"}, "books:read", true},
+		{[]string{"categories:*"}, "categories:read", true},
+		{nil, "books:read", false},
+	} {
+		if got := ScopeAllows(tt.granted, tt.required); got != tt.want {
+			t.Errorf("ScopeAllows(%v, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
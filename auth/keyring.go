@@ -0,0 +1,435 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// Keys - Keyring used to sign and verify API tokens (set by InitKeyring)
+var Keys *Keyring
+
+// SigningKey - One key in the keyring, identified by its kid
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	RetiredAt time.Time // zero while the key is the active signing key
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Keyring - Active signing key plus retired keys that keep verifying
+// during the grace period after a rotation
+type Keyring struct {
+	mu         sync.RWMutex
+	algorithm  string
+	dir        string
+	grace      time.Duration
+	current    *SigningKey
+	keys       map[string]*SigningKey
+	lastReload time.Time
+}
+
+// InitKeyring - Build the global keyring from the JWT settings:
+//
+//	JWT_ALGORITHM      HS256 (default), RS256 or EdDSA
+//	JWT_SECRET         shared secret for HS256
+//	JWT_KEYS_DIR       directory of PEM private keys (shared between instances)
+//	JWT_ROTATION_GRACE how long retired keys keep verifying (default 48h)
+func InitKeyring(cfg config.JWT) error {
+	ring, err := NewKeyring(strings.ToUpper(cfg.Algorithm), cfg.Secret, cfg.KeysDir, cfg.RotationGrace)
+	if err != nil {
+		return err
+	}
+	Keys = ring
+	return nil
+}
+
+// NewKeyring - Create a keyring for the given algorithm; secret is only
+// used by HS256
+func NewKeyring(algorithm, secret, dir string, grace time.Duration) (*Keyring, error) {
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+
+	k := &Keyring{algorithm: algorithm, dir: dir, grace: grace, keys: make(map[string]*SigningKey)}
+
+	switch algorithm {
+	case "HS256":
+		if secret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		key := &SigningKey{ID: "hs256", Algorithm: algorithm, CreatedAt: time.Now(), signKey: []byte(secret), verifyKey: []byte(secret)}
+		k.current = key
+		k.keys[key.ID] = key
+		return k, nil
+	case "RS256", "EDDSA":
+		if algorithm == "EDDSA" {
+			k.algorithm = "EdDSA"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", algorithm)
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		// Instances starting together must not each create a first key
+		if err := k.rotateShared(0, true); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	slog.Warn("JWT_KEYS_DIR not set, generated signing key lives in memory only")
+	if err := k.Rotate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Algorithms - Signing algorithms this keyring accepts
+func (k *Keyring) Algorithms() []string {
+	return []string{k.algorithm}
+}
+
+// Sign - Sign claims with the active key, setting the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key := k.current
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// Keyfunc - jwt.Keyfunc resolving the verification key by kid and
+// rejecting tokens whose alg does not match that key
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	if kid == "" && k.algorithm == "HS256" {
+		// Tokens issued before kid headers were introduced
+		key, ok = k.current, true
+	}
+	k.mu.RUnlock()
+
+	// Another instance may have rotated, pick up new keys from the shared dir
+	if !ok && k.dir != "" && k.reloadAllowed() {
+		if err := k.loadDir(); err != nil {
+			slog.Error("Failed to reload JWT keys", "error", err)
+		}
+		k.mu.RLock()
+		key, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing algorithm %q", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// Rotate - Generate a new signing key; the previous one keeps verifying
+// until the grace period has passed
+func (k *Keyring) Rotate() error {
+	if k.algorithm == "HS256" {
+		return errors.New("HS256 keys cannot be rotated automatically, change JWT_SECRET instead")
+	}
+
+	var signKey crypto.Signer
+	var err error
+	if k.algorithm == "RS256" {
+		signKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		_, signKey, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	key := &SigningKey{
+		ID:        fmt.Sprintf("%s-%d", strings.ToLower(k.algorithm), now.UnixNano()),
+		Algorithm: k.algorithm,
+		CreatedAt: now,
+		signKey:   signKey,
+		verifyKey: signKey.Public(),
+	}
+
+	if k.dir != "" {
+		der, err := x509.MarshalPKCS8PrivateKey(signKey)
+		if err != nil {
+			return err
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(k.dir, key.ID+".pem"), data, 0600); err != nil {
+			return err
+		}
+	}
+
+	k.mu.Lock()
+	if k.current != nil {
+		k.current.RetiredAt = now
+	}
+	k.current = key
+	k.keys[key.ID] = key
+	k.mu.Unlock()
+
+	k.prune()
+	slog.Info("JWT signing key rotated", "kid", key.ID)
+	return nil
+}
+
+// StartRotation - Rotate the signing key every interval until stop is
+// closed. With a shared JWT_KEYS_DIR every instance ticks, but only one
+// generates the new key (see rotateShared); the others switch to it.
+func (k *Keyring) StartRotation(interval time.Duration, stop <-chan struct{}) {
+	if k.algorithm == "HS256" || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rotate := k.Rotate
+				if k.dir != "" {
+					rotate = func() error { return k.rotateShared(interval, false) }
+				}
+				if err := rotate(); err != nil {
+					slog.Error("JWT key rotation failed", "error", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// rotationLock - File in the keys dir held by the instance that rotates
+const rotationLock = ".rotation.lock"
+
+// rotationLockStale - Age after which a lock counts as left behind by an
+// instance that died while holding it
+const rotationLockStale = time.Minute
+
+// rotateShared - Rotate in the shared keys dir unless its newest key is
+// younger than (nine tenths of) maxAge; a maxAge of 0 only creates a key
+// when there is none. The decision is made under rotationLock, so of the
+// instances ticking at about the same time only the first rotates and
+// the others load its key. When another instance holds the lock, wait
+// for it or, unless wait is set, leave the rotation to it.
+func (k *Keyring) rotateShared(maxAge time.Duration, wait bool) error {
+	unlock, err := k.lockDir(wait)
+	if err != nil || unlock == nil {
+		return err
+	}
+	defer unlock()
+
+	if err := k.loadDir(); err != nil {
+		return err
+	}
+	k.mu.RLock()
+	current := k.current
+	k.mu.RUnlock()
+	if current != nil && (maxAge == 0 || time.Since(current.CreatedAt) < maxAge*9/10) {
+		return nil
+	}
+	return k.Rotate()
+}
+
+// lockDir - Create rotationLock; unlock is nil when another instance
+// holds it and wait is not set
+func (k *Keyring) lockDir(wait bool) (unlock func(), err error) {
+	path := filepath.Join(k.dir, rotationLock)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > rotationLockStale {
+			slog.Warn("Removing a stale JWT key rotation lock", "path", path)
+			os.Remove(path)
+			continue
+		}
+		if !wait {
+			return nil, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// JWKS - Public keys in JSON Web Key Set format
+func (k *Keyring) JWKS() map[string]interface{} {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := []map[string]string{}
+	for _, key := range k.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": key.ID,
+				"use": "sig",
+				"alg": key.Algorithm,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": key.ID,
+				"use": "sig",
+				"alg": key.Algorithm,
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["kid"] < keys[j]["kid"] })
+
+	return map[string]interface{}{"keys": keys}
+}
+
+// prune - Drop retired keys whose grace period is over
+func (k *Keyring) prune() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for id, key := range k.keys {
+		if key.RetiredAt.IsZero() || time.Since(key.RetiredAt) < k.grace {
+			continue
+		}
+		delete(k.keys, id)
+		if k.dir != "" {
+			os.Remove(filepath.Join(k.dir, id+".pem"))
+		}
+	}
+}
+
+// loadDir - Load all PEM keys from the keys dir; the newest one signs
+func (k *Keyring) loadDir() error {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return err
+	}
+
+	var loaded []*SigningKey
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(k.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		signer, err := parsePrivateKey(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+
+		algorithm := "RS256"
+		if _, ok := signer.(ed25519.PrivateKey); ok {
+			algorithm = "EdDSA"
+		}
+		if algorithm != k.algorithm {
+			continue
+		}
+
+		loaded = append(loaded, &SigningKey{
+			ID:        strings.TrimSuffix(entry.Name(), ".pem"),
+			Algorithm: algorithm,
+			CreatedAt: info.ModTime(),
+			signKey:   signer,
+			verifyKey: signer.Public(),
+		})
+	}
+	if len(loaded) == 0 {
+		return nil
+	}
+
+	// Each key was retired when its successor was created
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].CreatedAt.Before(loaded[j].CreatedAt) })
+	for i := 0; i < len(loaded)-1; i++ {
+		loaded[i].RetiredAt = loaded[i+1].CreatedAt
+	}
+
+	k.mu.Lock()
+	k.keys = make(map[string]*SigningKey)
+	for _, key := range loaded {
+		k.keys[key.ID] = key
+	}
+	k.current = loaded[len(loaded)-1]
+	k.lastReload = time.Now()
+	k.mu.Unlock()
+
+	k.prune()
+	return nil
+}
+
+func (k *Keyring) reloadAllowed() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return time.Since(k.lastReload) > 10*time.Second
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
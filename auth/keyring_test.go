@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// verify - Parse token with the keys of k
+func verify(k *Keyring, token string) error {
+	_, err := jwt.Parse(token, k.Keyfunc, jwt.WithValidMethods(k.Algorithms()))
+	return err
+}
+
+func sign(t *testing.T, k *Keyring) string {
+	t.Helper()
+	token, err := k.Sign(jwt.MapClaims{"sub": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestNewKeyringSettings(t *testing.T) {
+	if _, err := NewKeyring("HS256", "", "", time.Hour); err == nil {
+		t.Error("HS256 without a secret accepted")
+	}
+	if _, err := NewKeyring("ES256", "", "", time.Hour); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+
+	k, err := NewKeyring("", "secret", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algorithms := k.Algorithms(); len(algorithms) != 1 || algorithms[0] != "HS256" {
+		t.Fatalf("default algorithms = %v, want HS256", algorithms)
+	}
+	if err := k.Rotate(); err == nil {
+		t.Error("HS256 keyring rotated")
+	}
+	// A shared secret is never published
+	if keys := k.JWKS()["keys"].([]map[string]string); len(keys) != 0 {
+		t.Fatalf("HS256 JWKS = %v, want no keys", keys)
+	}
+}
+
+func TestKeyringHS256(t *testing.T) {
+	k, err := NewKeyring("HS256", "secret", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(k, sign(t, k)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens from before kid headers still verify
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"}).SignedString([]byte("secret"))
+	if err := verify(k, legacy); err != nil {
+		t.Fatalf("token without kid: %v", err)
+	}
+
+	other, _ := NewKeyring("HS256", "other secret", "", time.Hour)
+	if err := verify(k, sign(t, other)); err == nil {
+		t.Fatal("token of another secret verified")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "EDDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			k, err := NewKeyring(algorithm, "", "", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := sign(t, k)
+
+			if err := k.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			after := sign(t, k)
+
+			// Within the grace period both keys verify and are published
+			for _, token := range []string{before, after} {
+				if err := verify(k, token); err != nil {
+					t.Fatal(err)
+				}
+			}
+			keys := k.JWKS()["keys"].([]map[string]string)
+			if len(keys) != 2 || keys[0]["kid"] == keys[1]["kid"] {
+				t.Fatalf("JWKS = %v, want the two keys", keys)
+			}
+			for _, key := range keys {
+				if key["use"] != "sig" || key["alg"] != k.Algorithms()[0] || (key["n"] == "" && key["x"] == "") {
+					t.Fatalf("JWKS key = %v", key)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyringGraceOver(t *testing.T) {
+	k, err := NewKeyring("EDDSA", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := sign(t, k)
+	if err := k.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(k, before); err == nil {
+		t.Fatal("token of a key past its grace period verified")
+	}
+	if keys := k.JWKS()["keys"].([]map[string]string); len(keys) != 1 {
+		t.Fatalf("JWKS = %v, want only the active key", keys)
+	}
+}
+
+func TestKeyringRejectsOtherAlgorithm(t *testing.T) {
+	k, err := NewKeyring("RS256", "", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 token naming the RSA key: must not be checked as an HMAC
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	token.Header["kid"] = k.current.ID
+	forged, _ := token.SignedString([]byte("guess"))
+	if _, err := k.Keyfunc(mustParseUnverified(t, forged)); err == nil {
+		t.Fatal("Keyfunc accepted an HS256 token for an RSA key")
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "1"})
+	unknown.Header["kid"] = "rs256-unknown"
+	if _, err := k.Keyfunc(unknown); err == nil {
+		t.Fatal("Keyfunc accepted an unknown kid")
+	}
+}
+
+func mustParseUnverified(t *testing.T, token string) *jwt.Token {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestKeyringSharedDir(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewKeyring("EDDSA", "", dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKeyring("EDDSA", "", dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.current.ID != b.current.ID {
+		t.Fatalf("second instance generated its own key %s instead of loading %s", b.current.ID, a.current.ID)
+	}
+	info, err := os.Stat(dir + "/" + a.current.ID + ".pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("key file mode = %v, want 0600", perm)
+	}
+
+	// b picks up the key a rotated to once it sees an unknown kid
+	if err := a.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	b.lastReload = time.Time{}
+	if err := verify(b, sign(t, a)); err != nil {
+		t.Fatalf("token of the rotated key: %v", err)
+	}
+	if b.current.ID != a.current.ID {
+		t.Fatalf("b signs with %s, want the newest key %s", b.current.ID, a.current.ID)
+	}
+}
+
+func TestKeyringSharedRotation(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewKeyring("EDDSA", "", dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKeyring("EDDSA", "", dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := a.current.ID
+
+	// The key is not due yet
+	if err := a.rotateShared(time.Hour, false); err != nil {
+		t.Fatal(err)
+	}
+	if a.current.ID != first {
+		t.Fatal("rotated a key younger than the interval")
+	}
+
+	// Both instances tick; the first rotates, the second takes its key
+	if err := a.rotateShared(time.Nanosecond, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.rotateShared(time.Minute, false); err != nil {
+		t.Fatal(err)
+	}
+	if a.current.ID == first || b.current.ID != a.current.ID {
+		t.Fatalf("a signs with %s, b with %s; want one new key", a.current.ID, b.current.ID)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("keys dir has %d entries, want the two keys and no lock", len(entries))
+	}
+
+	// Whoever holds the lock rotates; the others leave it to them
+	if err := os.WriteFile(filepath.Join(dir, rotationLock), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	current := b.current.ID
+	if err := b.rotateShared(time.Nanosecond, false); err != nil {
+		t.Fatal(err)
+	}
+	if b.current.ID != current {
+		t.Fatal("rotated while another instance held the lock")
+	}
+
+	// unless it died holding it
+	stale := time.Now().Add(-2 * rotationLockStale)
+	os.Chtimes(filepath.Join(dir, rotationLock), stale, stale)
+	if err := b.rotateShared(time.Nanosecond, false); err != nil {
+		t.Fatal(err)
+	}
+	if b.current.ID == current {
+		t.Fatal("stale lock kept the rotation from happening")
+	}
+}
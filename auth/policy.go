@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Names that could be confused with system or staff accounts
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "system": true,
+	"support": true, "security": true, "api": true, "null": true,
+	"undefined": true, "anonymous": true, "moderator": true, "staff": true,
+}
+
+var (
+	breachedOnce      sync.Once
+	breachedPasswords map[string]bool
+)
+
+// ValidateUsername - Check username length, charset and reserved names
+func ValidateUsername(username string) error {
+	minLen := config.Current.Auth.UsernameMinLength
+	maxLen := config.Current.Auth.UsernameMaxLength
+
+	if len(username) < minLen || len(username) > maxLen {
+		return fmt.Errorf("username must be between %d and %d characters", minLen, maxLen)
+	}
+	if !usernamePattern.MatchString(username) {
+		return errors.New("username may only contain lowercase letters, digits, '.', '_' and '-' and must start with a letter or digit")
+	}
+	if reservedUsernames[username] {
+		return errors.New("username is reserved")
+	}
+	return nil
+}
+
+// ValidatePassword - Check a password against the configured policy
+func ValidatePassword(password, username string) error {
+	minLen := config.Current.Auth.PasswordMinLength
+	// bcrypt ignores everything after 72 bytes
+	maxLen := config.Current.Auth.PasswordMaxLength
+	if maxLen > 72 {
+		maxLen = 72
+	}
+
+	if len(password) < minLen {
+		return fmt.Errorf("password must be at least %d characters", minLen)
+	}
+	if len(password) > maxLen {
+		return fmt.Errorf("password must be at most %d bytes", maxLen)
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return errors.New("password must not match the username")
+	}
+	if isBreachedPassword(password) {
+		return errors.New("password appears in a list of breached passwords, choose another one")
+	}
+	return nil
+}
+
+// GeneratePassword - Random password for accounts created by the system
+// (24 URL-safe characters, 144 bits)
+func GeneratePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RegistrationEnabled - Whether open self-registration is allowed
+func RegistrationEnabled() bool {
+	return config.Current.Auth.RegistrationEnabled
+}
+
+// isBreachedPassword - Look the password up in BREACHED_PASSWORDS_FILE
+// (one password per line, loaded once)
+func isBreachedPassword(password string) bool {
+	breachedOnce.Do(loadBreachedPasswords)
+	return breachedPasswords[strings.ToLower(password)]
+}
+
+func loadBreachedPasswords() {
+	breachedPasswords = make(map[string]bool)
+
+	path := config.Current.Auth.BreachedPasswordsFile
+	if path == "" {
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("Failed to open breached password list", "path", path, "error", err)
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			breachedPasswords[strings.ToLower(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Error("Failed to read breached password list", "path", path, "error", err)
+	}
+	slog.Info("Loaded breached passwords", "count", len(breachedPasswords))
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// withBreachedPasswords - Use a breached password list with the given
+// entries for the test
+func withBreachedPasswords(t *testing.T, passwords ...string) {
+	t.Helper()
+	path := t.TempDir() + "/breached.txt"
+	if err := os.WriteFile(path, []byte(strings.Join(passwords, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := config.Current.Auth.BreachedPasswordsFile
+	config.Current.Auth.BreachedPasswordsFile = path
+	breachedOnce, breachedPasswords = sync.Once{}, nil
+	t.Cleanup(func() {
+		config.Current.Auth.BreachedPasswordsFile = previous
+		breachedOnce, breachedPasswords = sync.Once{}, nil
+	})
+}
+
+func TestValidateUsername(t *testing.T) {
+	for _, tt := range []struct {
+		username string
+		valid    bool
+	}{
+		{"budi", true},
+		{"budi.santoso_2-a", true},
+		{"0day", true},
+		{"ab", false},
+		{strings.Repeat("a", 33), false},
+		{"Budi", false},
+		{"budi santoso", false},
+		{".budi", false},
+		{"-budi", false},
+		{"budi@home", false},
+		{"admin", false},
+		{"root", false},
+	} {
+		if err := ValidateUsername(tt.username); (err == nil) != tt.valid {
+			t.Errorf("ValidateUsername(%q) = %v, want valid %v", tt.username, err, tt.valid)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	withBreachedPasswords(t, "password123", "  Qwertyuiop  ", "")
+
+	for _, tt := range []struct {
+		password, username string
+		valid              bool
+	}{
+		{"correct horse", "budi", true},
+		{"short", "budi", false},
+		{strings.Repeat("x", 72), "", true},
+		{strings.Repeat("x", 73), "", false},
+		{"budisantoso", "budisantoso", false},
+		{"BudiSantoso", "budisantoso", false},
+		{"budisantoso", "", true},
+		{"password123", "budi", false},
+		{"PASSWORD123", "budi", false},
+		{"qwertyuiop", "budi", false},
+	} {
+		if err := ValidatePassword(tt.password, tt.username); (err == nil) != tt.valid {
+			t.Errorf("ValidatePassword(%q, %q) = %v, want valid %v", tt.password, tt.username, err, tt.valid)
+		}
+	}
+}
+
+func TestValidatePasswordLengthSettings(t *testing.T) {
+	previous := config.Current.Auth
+	t.Cleanup(func() { config.Current.Auth = previous })
+	config.Current.Auth.PasswordMinLength = 12
+	// More than bcrypt can use is capped at 72 bytes
+	config.Current.Auth.PasswordMaxLength = 100
+
+	if err := ValidatePassword("eleven chrs", ""); err == nil {
+		t.Error("password under PASSWORD_MIN_LENGTH accepted")
+	}
+	if err := ValidatePassword("twelve chars", ""); err != nil {
+		t.Errorf("password of PASSWORD_MIN_LENGTH refused: %v", err)
+	}
+	if err := ValidatePassword(strings.Repeat("x", 73), ""); err == nil {
+		t.Error("password over 72 bytes accepted")
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		password, err := GeneratePassword()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(password) != 24 || seen[password] {
+			t.Fatalf("GeneratePassword = %q, want 24 fresh characters", password)
+		}
+		if err := ValidatePassword(password, ""); err != nil {
+			t.Fatalf("generated password fails the policy: %v", err)
+		}
+		seen[password] = true
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// Cookie and header names for browser sessions
+const (
+	SessionCookie = "session"
+	CSRFCookie    = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// SessionSettings - Cookie attributes for browser sessions
+type SessionSettings struct {
+	TTL      time.Duration
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+// LoadSessionSettings - Read SESSION_TTL (24h), SESSION_COOKIE_SECURE (true),
+// SESSION_COOKIE_SAMESITE (strict|lax) and SESSION_COOKIE_DOMAIN
+func LoadSessionSettings() SessionSettings {
+	cfg := config.Current.Session
+	settings := SessionSettings{
+		TTL:      cfg.TTL,
+		Secure:   cfg.CookieSecure,
+		SameSite: http.SameSiteStrictMode,
+		Domain:   cfg.CookieDomain,
+	}
+	if strings.EqualFold(cfg.CookieSameSite, "lax") {
+		settings.SameSite = http.SameSiteLaxMode
+	}
+	return settings
+}
+
+// GenerateSessionToken - Random opaque token for a session or CSRF cookie
+func GenerateSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSessionToken - SHA-256 hash of a session token as stored in the database
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+func TestLoadSessionSettings(t *testing.T) {
+	previous := config.Current.Session
+	t.Cleanup(func() { config.Current.Session = previous })
+
+	config.Current.Session = config.Session{TTL: time.Hour, CookieSecure: true, CookieSameSite: "strict", CookieDomain: "books.example"}
+	settings := LoadSessionSettings()
+	if settings.TTL != time.Hour || !settings.Secure || settings.SameSite != http.SameSiteStrictMode || settings.Domain != "books.example" {
+		t.Fatalf("settings = %+v", settings)
+	}
+
+	for value, want := range map[string]http.SameSite{"lax": http.SameSiteLaxMode, "Lax": http.SameSiteLaxMode, "": http.SameSiteStrictMode, "none": http.SameSiteStrictMode} {
+		config.Current.Session.CookieSameSite = value
+		if got := LoadSessionSettings().SameSite; got != want {
+			t.Errorf("SESSION_COOKIE_SAMESITE=%q: SameSite = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestSessionTokens(t *testing.T) {
+	token, err := GenerateSessionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 43 {
+		t.Fatalf("token = %q, want 256 bits in unpadded base64url", token)
+	}
+	if other, _ := GenerateSessionToken(); other == token {
+		t.Fatal("the same token twice")
+	}
+
+	hash := HashSessionToken(token)
+	if len(hash) != 64 || hash == token || hash != HashSessionToken(token) {
+		t.Fatalf("hash = %q", hash)
+	}
+}
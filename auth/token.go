@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// Tokens - Token service shared by login and the auth middleware (set by InitTokens)
+var Tokens *TokenService
+
+// Token validation errors, reported to clients in WWW-Authenticate
+var (
+	ErrTokenMissing       = errors.New("authorization header required")
+	ErrInvalidScheme      = errors.New("authorization scheme must be Bearer")
+	ErrTokenMalformed     = errors.New("token is malformed")
+	ErrTokenSignature     = errors.New("token signature is invalid")
+	ErrTokenExpired       = errors.New("token has expired")
+	ErrTokenNotYetValid   = errors.New("token is not valid yet")
+	ErrTokenIssuer        = errors.New("token issuer is not accepted")
+	ErrTokenAudience      = errors.New("token audience is not accepted")
+	ErrTokenInvalidClaims = errors.New("token claims are invalid")
+	ErrTokenPurpose       = errors.New("token cannot be used for this request")
+	ErrTokenRevoked       = errors.New("token has been revoked")
+)
+
+// Token purposes other than normal API access
+const (
+	PurposeMFA            = "mfa"             // password verified, OTP still required
+	PurposeEnroll         = "mfa_enroll"      // 2FA is mandatory but not set up yet
+	PurposePasswordChange = "password_change" // the password must be changed first
+)
+
+// Claims - Claims carried by API tokens
+type Claims struct {
+	Username string `json:"username"`
+	UserID   int    `json:"user_id"`
+	Role     string `json:"role"`
+	Purpose  string `json:"purpose,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenService - Issues and validates API tokens with a fixed issuer,
+// audience, algorithm allow-list and clock skew leeway
+type TokenService struct {
+	keys     *Keyring
+	issuer   string
+	audience string
+	leeway   time.Duration
+	ttl      time.Duration
+}
+
+// InitTokens - Build the global token service from the JWT settings
+// (call after InitKeyring):
+//
+//	JWT_ISSUER   iss claim (default "mini-project-buku")
+//	JWT_AUDIENCE aud claim (default "mini-project-buku-api")
+//	JWT_LEEWAY   allowed clock skew (default 30s)
+//	JWT_TTL      token lifetime (default 24h)
+func InitTokens(cfg config.JWT) {
+	Tokens = NewTokenService(Keys, cfg.Issuer, cfg.Audience, cfg.Leeway, cfg.TTL)
+}
+
+// NewTokenService - Create a token service on top of a keyring
+func NewTokenService(keys *Keyring, issuer, audience string, leeway, ttl time.Duration) *TokenService {
+	return &TokenService{keys: keys, issuer: issuer, audience: audience, leeway: leeway, ttl: ttl}
+}
+
+// Issue - Sign an API token for a user
+func (s *TokenService) Issue(userID int, username, role string) (string, error) {
+	return s.IssuePurpose(userID, username, role, "", s.ttl)
+}
+
+// IssuePurpose - Sign a restricted, usually short-lived token for one step
+// of a login flow (see PurposeMFA, PurposeEnroll)
+func (s *TokenService) IssuePurpose(userID int, username, role, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return s.keys.Sign(Claims{
+		Username: username,
+		UserID:   userID,
+		Role:     role,
+		Purpose:  purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   fmt.Sprint(userID),
+			Audience:  jwt.ClaimStrings{s.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	})
+}
+
+// ParseHeader - Validate the token in an Authorization header value
+func (s *TokenService) ParseHeader(header string) (*Claims, error) {
+	tokenString, err := BearerToken(header)
+	if err != nil {
+		return nil, err
+	}
+	return s.Parse(tokenString)
+}
+
+// Parse - Validate a raw token string
+func (s *TokenService) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.keys.Keyfunc,
+		jwt.WithValidMethods(s.keys.Algorithms()),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithLeeway(s.leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, classifyTokenError(err)
+	}
+	return claims, nil
+}
+
+// BearerToken - Extract the token from "Bearer <token>" (scheme is
+// case-insensitive, exactly one space, no extra fields)
+func BearerToken(header string) (string, error) {
+	if header == "" {
+		return "", ErrTokenMissing
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrInvalidScheme
+	}
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", ErrTokenMalformed
+	}
+	return token, nil
+}
+
+// WWWAuthenticate - Header value describing why authentication failed (RFC 6750)
+func WWWAuthenticate(err error) string {
+	if err == ErrTokenMissing || err == ErrInvalidScheme {
+		return `Bearer realm="api"`
+	}
+	return fmt.Sprintf(`Bearer realm="api", error="invalid_token", error_description=%q`, err.Error())
+}
+
+func classifyTokenError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ErrTokenMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ErrTokenSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrTokenIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrTokenAudience
+	}
+	return ErrTokenInvalidClaims
+}
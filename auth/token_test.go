@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestTokens(t *testing.T) *TokenService {
+	t.Helper()
+	k, err := NewKeyring("HS256", "secret", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTokenService(k, "books", "books-api", 30*time.Second, time.Hour)
+}
+
+// signClaims - Token of s with claims exactly as given
+func signClaims(t *testing.T, s *TokenService, claims Claims) string {
+	t.Helper()
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Username: "budi",
+		UserID:   7,
+		Role:     "user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "books",
+			Audience:  jwt.ClaimStrings{"books-api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	s := newTestTokens(t)
+	token, err := s.Issue(7, "budi", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := s.ParseHeader("Bearer " + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != 7 || claims.Username != "budi" || claims.Role != "admin" || claims.Purpose != "" || claims.Subject != "7" {
+		t.Fatalf("claims = %+v", claims)
+	}
+	if ttl := time.Until(claims.ExpiresAt.Time); ttl < 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("token lifetime = %v, want JWT_TTL", ttl)
+	}
+
+	restricted, err := s.IssuePurpose(7, "budi", "admin", PurposeMFA, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := s.Parse(restricted); err != nil || claims.Purpose != PurposeMFA {
+		t.Fatalf("restricted token = %+v, %v", claims, err)
+	}
+}
+
+func TestTokenValidation(t *testing.T) {
+	s := newTestTokens(t)
+	otherKeys, _ := NewKeyring("HS256", "other secret", "", time.Hour)
+	now := time.Now()
+
+	claims := func(change func(*Claims)) Claims {
+		c := validClaims()
+		change(&c)
+		return c
+	}
+	for _, tt := range []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"malformed", "not-a-token", ErrTokenMalformed},
+		{"other issuer", signClaims(t, s, claims(func(c *Claims) { c.Issuer = "someone-else" })), ErrTokenIssuer},
+		{"other audience", signClaims(t, s, claims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-api"} })), ErrTokenAudience},
+		{"expired", signClaims(t, s, claims(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) })), ErrTokenExpired},
+		{"not valid yet", signClaims(t, s, claims(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) })), ErrTokenNotYetValid},
+		{"issued in the future", signClaims(t, s, claims(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) })), ErrTokenNotYetValid},
+		{"without expiry", signClaims(t, s, claims(func(c *Claims) { c.ExpiresAt = nil })), ErrTokenInvalidClaims},
+		{"other key", signClaims(t, NewTokenService(otherKeys, "books", "books-api", 0, time.Hour), validClaims()), ErrTokenSignature},
+	} {
+		if _, err := s.Parse(tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTokenClockSkew(t *testing.T) {
+	s := newTestTokens(t)
+	now := time.Now()
+
+	// Within JWT_LEEWAY of another instance's clock
+	skewed := validClaims()
+	skewed.IssuedAt = jwt.NewNumericDate(now.Add(10 * time.Second))
+	skewed.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second))
+	if _, err := s.Parse(signClaims(t, s, skewed)); err != nil {
+		t.Fatalf("token from a clock 10s ahead: %v", err)
+	}
+
+	justExpired := validClaims()
+	justExpired.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+	if _, err := s.Parse(signClaims(t, s, justExpired)); err != nil {
+		t.Fatalf("token expired 10s ago: %v", err)
+	}
+}
+
+func TestTokenAlgorithmPinned(t *testing.T) {
+	s := newTestTokens(t)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Parse(unsigned); err == nil {
+		t.Fatal("unsigned token accepted")
+	}
+
+	// Same secret, but an algorithm the keyring does not use
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, validClaims())
+	token.Header["kid"] = "hs256"
+	other, _ := token.SignedString([]byte("secret"))
+	if _, err := s.Parse(other); !errors.Is(err, ErrTokenSignature) {
+		t.Fatalf("HS512 token: err = %v, want %v", err, ErrTokenSignature)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		token  string
+		err    error
+	}{
+		{"Bearer abc.def.ghi", "abc.def.ghi", nil},
+		{"bearer abc", "abc", nil},
+		{"", "", ErrTokenMissing},
+		{"Basic dXNlcjpwYXNz", "", ErrInvalidScheme},
+		{"Bearer", "", ErrInvalidScheme},
+		{"Bearer ", "", ErrTokenMalformed},
+		{"Bearer  abc", "", ErrTokenMalformed},
+		{"Bearer abc def", "", ErrTokenMalformed},
+	} {
+		token, err := BearerToken(tt.header)
+		if token != tt.token || err != tt.err {
+			t.Errorf("BearerToken(%q) = %q, %v; want %q, %v", tt.header, token, err, tt.token, tt.err)
+		}
+	}
+}
+
+func TestWWWAuthenticate(t *testing.T) {
+	if got := WWWAuthenticate(ErrTokenMissing); got != `Bearer realm="api"` {
+		t.Errorf("missing token: %s", got)
+	}
+	got := WWWAuthenticate(ErrTokenExpired)
+	if !strings.Contains(got, `error="invalid_token"`) || !strings.Contains(got, `error_description="token has expired"`) {
+		t.Errorf("expired token: %s", got)
+	}
+}
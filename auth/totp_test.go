@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret - The SHA-1 test key of RFC 6238 ("12345678901234567890")
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, last six digits
+	for _, tt := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/30 {
+			t.Errorf("ValidateTOTP(%s at %d) = %d, %v; want step %d", tt.code, tt.unix, step, ok, tt.unix/30)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	at := time.Unix(1111111109, 0)
+	for _, tt := range []struct {
+		offset time.Duration
+		ok     bool
+	}{
+		{0, true},
+		{30 * time.Second, true},
+		{-30 * time.Second, true},
+		{60 * time.Second, false},
+		{-60 * time.Second, false},
+	} {
+		if _, ok := ValidateTOTP(rfc6238Secret, "081804", at.Add(tt.offset)); ok != tt.ok {
+			t.Errorf("code checked %v later: ok = %v, want %v", tt.offset, ok, tt.ok)
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	at := time.Unix(59, 0)
+	for _, tt := range []struct {
+		name, secret, code string
+		ok                 bool
+	}{
+		{"lowercase secret", strings.ToLower(rfc6238Secret), "287082", true},
+		{"padded secret", rfc6238Secret + "====", "287082", true},
+		{"wrong code", rfc6238Secret, "287083", false},
+		{"short code", rfc6238Secret, "28708", false},
+		{"long code", rfc6238Secret, "2870820", false},
+		{"invalid secret", "not base32!", "287082", false},
+		{"empty secret", "", "287082", false},
+	} {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, at); ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 160 bits in unpadded base32
+	if len(secret) != 32 || strings.Trim(secret, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+		t.Fatalf("secret = %q", secret)
+	}
+	if other, _ := GenerateTOTPSecret(); other == secret {
+		t.Fatal("the same secret twice")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	raw := TOTPProvisioningURI("Mini Project Buku", "budi", rfc6238Secret)
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Mini Project Buku:budi" {
+		t.Fatalf("URI = %s", raw)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfc6238Secret || q.Get("issuer") != "Mini Project Buku" || q.Get("digits") != "6" || q.Get("period") != "30" || q.Get("algorithm") != "SHA1" {
+		t.Fatalf("URI parameters = %v", q)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if !format.MatchString(code) || seen[code] {
+			t.Fatalf("codes = %v", codes)
+		}
+		seen[code] = true
+	}
+
+	// Typed with other spacing, dashes or case, a code still matches
+	hash := HashRecoveryCode("abcde-fghij")
+	for _, typed := range []string{"abcdefghij", " ABCDE-FGHIJ ", "abc-de-fghij"} {
+		if HashRecoveryCode(typed) != hash {
+			t.Errorf("HashRecoveryCode(%q) differs", typed)
+		}
+	}
+	if HashRecoveryCode("abcde-fghik") == hash {
+		t.Error("different codes share a hash")
+	}
+}
@@ -0,0 +1,151 @@
+// Command mock-oidc is a minimal OpenID Connect provider for local
+// development. It approves every authorization request without a login
+// page, so the OIDC flow of the API can be exercised end to end:
+//
+//	go run ./cmd/mock-oidc
+//	OIDC_ISSUER_URL=http://localhost:9999 OIDC_CLIENT_ID=books-api \
+//	OIDC_REDIRECT_URL=http://localhost:8080/api/users/oidc/callback go run .
+//
+// The subject is taken from the login_hint parameter (default "mock-user").
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"mini-project-buku-sb-go-73-Agil/auth"
+)
+
+type authRequest struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	subject     string
+	expiresAt   time.Time
+}
+
+func main() {
+	port := os.Getenv("MOCK_OIDC_PORT")
+	if port == "" {
+		port = "9999"
+	}
+	issuer := "http://localhost:" + port
+
+	keys, err := auth.NewKeyring("RS256", "", "", time.Hour)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	codes := make(map[string]authRequest)
+
+	r := gin.Default()
+
+	r.GET("/.well-known/openid-configuration", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": keys.Algorithms(),
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	r.GET("/jwks", func(c *gin.Context) {
+		c.JSON(http.StatusOK, keys.JWKS())
+	})
+
+	r.GET("/authorize", func(c *gin.Context) {
+		redirectURI, err := url.Parse(c.Query("redirect_uri"))
+		if err != nil || c.Query("response_type") != "code" || c.Query("code_challenge_method") != "S256" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		subject := c.DefaultQuery("login_hint", "mock-user")
+		code := randomString()
+
+		mu.Lock()
+		codes[code] = authRequest{
+			clientID:    c.Query("client_id"),
+			redirectURI: c.Query("redirect_uri"),
+			nonce:       c.Query("nonce"),
+			challenge:   c.Query("code_challenge"),
+			subject:     subject,
+			expiresAt:   time.Now().Add(time.Minute),
+		}
+		mu.Unlock()
+
+		query := redirectURI.Query()
+		query.Set("code", code)
+		query.Set("state", c.Query("state"))
+		redirectURI.RawQuery = query.Encode()
+		c.Redirect(http.StatusFound, redirectURI.String())
+	})
+
+	r.POST("/token", func(c *gin.Context) {
+		code := c.PostForm("code")
+
+		mu.Lock()
+		req, ok := codes[code]
+		delete(codes, code)
+		mu.Unlock()
+
+		challenge := sha256.Sum256([]byte(c.PostForm("code_verifier")))
+		if !ok || time.Now().After(req.expiresAt) ||
+			c.PostForm("redirect_uri") != req.redirectURI ||
+			base64.RawURLEncoding.EncodeToString(challenge[:]) != req.challenge {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+
+		now := time.Now()
+		idToken, err := keys.Sign(jwt.MapClaims{
+			"iss":                issuer,
+			"sub":                req.subject,
+			"aud":                req.clientID,
+			"nonce":              req.nonce,
+			"iat":                now.Unix(),
+			"exp":                now.Add(5 * time.Minute).Unix(),
+			"preferred_username": req.subject,
+			"email":              req.subject + "@example.com",
+			"email_verified":     true,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": randomString(),
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idToken,
+		})
+	})
+
+	log.Printf("Mock OIDC provider listening on %s\n", issuer)
+	if err := r.Run(":" + port); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
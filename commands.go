@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/seed"
+)
+
+// runCommand - Handle CLI subcommands (anything other than serving the API)
+func runCommand(args []string) error {
+	// "config" also works with an invalid configuration, to inspect it
+	if args[0] == "config" {
+		return runConfig(args[1:])
+	}
+	if err := config.Current.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:])
+	case "seed":
+		return runSeed(args[1:])
+	case "user":
+		return runUser(args[1:])
+	}
+	return fmt.Errorf("unknown command %q (available: config, migrate, seed, user)", args[0])
+}
+
+// runConfig - config print [--redacted] | check
+func runConfig(args []string) error {
+	usage := fmt.Errorf("usage: config print [--redacted]|check")
+	if len(args) == 0 {
+		return usage
+	}
+
+	cfg := config.Current
+	switch args[0] {
+	case "print":
+		flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+		redacted := flags.Bool("redacted", false, "mask passwords, secrets and replica DSNs")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *redacted {
+			cfg = cfg.Redacted()
+		}
+		out, err := cfg.YAML()
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+		return nil
+	case "check":
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration:\n%v", err)
+		}
+		fmt.Println("Configuration is valid")
+		return nil
+	}
+	return usage
+}
+
+// runMigrate - migrate up | down [steps] | status | create <name>
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status|create <name>")
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: migrate create <name>")
+		}
+		name, err := database.CreateMigration(database.MigrationsDir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s/*/%s.up.sql and .down.sql, one pair per dialect\n", database.MigrationsDir, name)
+		return nil
+	}
+
+	switch args[0] {
+	case "up", "down", "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "up":
+		return database.MigrateUp()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		return database.MigrateDown(steps)
+	case "status":
+		statuses, err := database.GetMigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	}
+	return nil
+}
+
+// runSeed - seed [-fake N] [-seed S] [fixtures.yaml|fixtures.json ...]
+// Loads fixture files and/or N generated books, applying pending
+// migrations first. Safe to run repeatedly.
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fake := flags.Int("fake", 0, "also generate `N` fake books")
+	randSeed := flags.Uint64("seed", 1, "random seed for -fake (same seed, same books)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *fake < 0 || (*fake == 0 && flags.NArg() == 0) {
+		return fmt.Errorf("usage: seed [-fake N] [-seed S] [fixtures.yaml|fixtures.json ...]")
+	}
+
+	fixtures := &seed.Fixtures{}
+	for _, path := range flags.Args() {
+		loaded, err := seed.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		fixtures.Append(loaded)
+	}
+	if *fake > 0 {
+		fixtures.Append(seed.Fake(*fake, *randSeed))
+	}
+	if err := fixtures.Validate(); err != nil {
+		return err
+	}
+
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.DB.Close()
+	if err := database.MigrateUp(); err != nil {
+		return err
+	}
+
+	result, err := seed.Apply(context.Background(), database.DB, fixtures)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("categories: %s\nbooks: %s\nusers: %s\n", result.Categories, result.Books, result.Users)
+	return nil
+}
+
+// runUser - user create-admin [-username NAME] [-password-file PATH]
+// Creates an admin account, or recovers an existing one (new password,
+// admin role, unlocked). Without -password-file ("-" reads stdin) a
+// password is generated and printed. It must be changed at the next login.
+func runUser(args []string) error {
+	usage := fmt.Errorf("usage: user create-admin [-username NAME] [-password-file PATH]")
+	if len(args) == 0 || args[0] != "create-admin" {
+		return usage
+	}
+
+	flags := flag.NewFlagSet("user create-admin", flag.ContinueOnError)
+	username := flags.String("username", config.Current.Admin.Username, "account to create or recover")
+	passwordFile := flags.String("password-file", "", "read the password from the first line of `PATH` (- for stdin)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usage
+	}
+
+	admin := config.Admin{Username: *username, PasswordFile: *passwordFile}
+	if *passwordFile == "-" {
+		admin.PasswordFile = "/dev/stdin"
+	}
+	password, generated, err := database.AdminPassword(admin)
+	if err != nil {
+		return err
+	}
+
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.DB.Close()
+	if err := database.MigrateUp(); err != nil {
+		return err
+	}
+
+	created, err := database.CreateAdmin(context.Background(), *username, password)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Printf("Created admin account %q\n", *username)
+	} else {
+		fmt.Printf("Recovered account %q: admin role, new password, unlocked, sessions, API keys and tokens revoked\n", *username)
+	}
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	fmt.Println("The password must be changed at the next login.")
+	return nil
+}
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/joho/godotenv"
+)
+
+const (
+	// PlaceholderJWTSecret - JWT_SECRET shipped in .env, refused in production
+	PlaceholderJWTSecret = "your-secret-key-change-in-production"
+	// LegacyAdminPassword - Password older versions gave the admin account,
+	// refused in production
+	LegacyAdminPassword = "password123"
+)
+
+// Config - All settings of the API. Every field can be set in the YAML
+// file (yaml tag) or through the environment (env tag; the first variable
+// that is set wins).
+type Config struct {
+	Env       string    `yaml:"env" env:"APP_ENV"`
+	Server    Server    `yaml:"server"`
+	Log       Log       `yaml:"log"`
+	Database  Database  `yaml:"database"`
+	JWT       JWT       `yaml:"jwt"`
+	Session   Session   `yaml:"session"`
+	Auth      Auth      `yaml:"auth"`
+	Login     Login     `yaml:"login"`
+	BasicAuth BasicAuth `yaml:"basic_auth"`
+	Mail      Mail      `yaml:"mail"`
+	OIDC      OIDC      `yaml:"oidc"`
+	Admin     Admin     `yaml:"admin"`
+}
+
+// Server - HTTP listener
+type Server struct {
+	Port              string        `yaml:"port" env:"PORT,SERVER_PORT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// ShutdownTimeout - How long in-flight requests may take to finish
+	// after SIGINT/SIGTERM before their connections are closed
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// HealthCheckTimeout - Bound of the database checks behind /readyz and /health
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	// TrustedProxies - IPs or CIDRs of reverse proxies whose X-Forwarded-For
+	// gives the client IP (login throttling, audit log); none by default
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// Log - Structured logging; the level can also be changed at runtime
+// through the admin API
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// Database - Primary connection, pool, timeouts and read replicas
+type Database struct {
+	Driver string `yaml:"driver" env:"DB_DRIVER"`
+	Host   string `yaml:"host" env:"DB_HOST"`
+	// Port - Empty means the driver's default (5432, 3306)
+	Port     string `yaml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" env:"DB_USER"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"sslmode" env:"DB_SSLMODE"`
+	// Path - Database file for the sqlite driver
+	Path string `yaml:"path" env:"DB_PATH"`
+
+	MaxOpenConns      int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns      int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime   time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime   time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	ConnectAttempts   int           `yaml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" env:"DB_CONNECT_BACKOFF"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff" env:"DB_CONNECT_MAX_BACKOFF"`
+
+	// QueryTimeout - Default for endpoint groups without an entry in
+	// QueryTimeouts (DB_QUERY_TIMEOUT_<GROUP>); zero disables it
+	QueryTimeout  time.Duration            `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+	QueryTimeouts map[string]time.Duration `yaml:"query_timeouts" env:"DB_QUERY_TIMEOUT_*"`
+
+	ReplicaDSNs          []string      `yaml:"replica_dsns" env:"DB_REPLICA_DSNS" secret:"true"`
+	ReplicaMaxLag        time.Duration `yaml:"replica_max_lag" env:"DB_REPLICA_MAX_LAG"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL"`
+	ReadYourWritesWindow time.Duration `yaml:"read_your_writes_window" env:"DB_READ_YOUR_WRITES_WINDOW"`
+}
+
+// JWT - Token signing and validation
+type JWT struct {
+	Algorithm string `yaml:"algorithm" env:"JWT_ALGORITHM"`
+	Secret    string `yaml:"secret" env:"JWT_SECRET" secret:"true"`
+	KeysDir   string `yaml:"keys_dir" env:"JWT_KEYS_DIR"`
+	// RotationInterval - Zero disables automatic key rotation
+	RotationInterval time.Duration `yaml:"rotation_interval" env:"JWT_ROTATION_INTERVAL"`
+	RotationGrace    time.Duration `yaml:"rotation_grace" env:"JWT_ROTATION_GRACE"`
+	Issuer           string        `yaml:"issuer" env:"JWT_ISSUER"`
+	Audience         string        `yaml:"audience" env:"JWT_AUDIENCE"`
+	Leeway           time.Duration `yaml:"leeway" env:"JWT_LEEWAY"`
+	TTL              time.Duration `yaml:"ttl" env:"JWT_TTL"`
+}
+
+// Session - Browser session cookies
+type Session struct {
+	TTL            time.Duration `yaml:"ttl" env:"SESSION_TTL"`
+	CookieSecure   bool          `yaml:"cookie_secure" env:"SESSION_COOKIE_SECURE"`
+	CookieSameSite string        `yaml:"cookie_samesite" env:"SESSION_COOKIE_SAMESITE"`
+	CookieDomain   string        `yaml:"cookie_domain" env:"SESSION_COOKIE_DOMAIN"`
+}
+
+// Auth - Registration, credential policy, two-factor and password reset
+type Auth struct {
+	RegistrationEnabled    bool          `yaml:"registration_enabled" env:"REGISTRATION_ENABLED"`
+	UsernameMinLength      int           `yaml:"username_min_length" env:"USERNAME_MIN_LENGTH"`
+	UsernameMaxLength      int           `yaml:"username_max_length" env:"USERNAME_MAX_LENGTH"`
+	PasswordMinLength      int           `yaml:"password_min_length" env:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength      int           `yaml:"password_max_length" env:"PASSWORD_MAX_LENGTH"`
+	BreachedPasswordsFile  string        `yaml:"breached_passwords_file" env:"BREACHED_PASSWORDS_FILE"`
+	RequireAdmin2FA        bool          `yaml:"require_admin_2fa" env:"REQUIRE_ADMIN_2FA"`
+	TOTPIssuer             string        `yaml:"totp_issuer" env:"TOTP_ISSUER"`
+	MFATokenTTL            time.Duration `yaml:"mfa_token_ttl" env:"MFA_TOKEN_TTL"`
+	MFAEnrollTokenTTL      time.Duration `yaml:"mfa_enroll_token_ttl" env:"MFA_ENROLL_TOKEN_TTL"`
+	PasswordChangeTokenTTL time.Duration `yaml:"password_change_token_ttl" env:"PASSWORD_CHANGE_TOKEN_TTL"`
+	PasswordResetTTL       time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+	PasswordResetURL       string        `yaml:"password_reset_url" env:"PASSWORD_RESET_URL"`
+	// PasswordResetMaxTokens - Unused, unexpired reset tokens a user can
+	// have; further requests send no mail
+	PasswordResetMaxTokens int `yaml:"password_reset_max_tokens" env:"PASSWORD_RESET_MAX_TOKENS"`
+}
+
+// Login - Brute-force protection of the login endpoints
+type Login struct {
+	BackoffFreeAttempts int           `yaml:"backoff_free_attempts" env:"LOGIN_BACKOFF_FREE_ATTEMPTS"`
+	IPFreeAttempts      int           `yaml:"ip_free_attempts" env:"LOGIN_IP_FREE_ATTEMPTS"`
+	BackoffBase         time.Duration `yaml:"backoff_base" env:"LOGIN_BACKOFF_BASE"`
+	BackoffMax          time.Duration `yaml:"backoff_max" env:"LOGIN_BACKOFF_MAX"`
+	AttemptWindow       time.Duration `yaml:"attempt_window" env:"LOGIN_ATTEMPT_WINDOW"`
+	LockThreshold       int           `yaml:"lock_threshold" env:"LOGIN_LOCK_THRESHOLD"`
+	LockDuration        time.Duration `yaml:"lock_duration" env:"LOGIN_LOCK_DURATION"`
+}
+
+// BasicAuth - Legacy Basic auth on selected route groups
+type BasicAuth struct {
+	Groups   []string      `yaml:"groups" env:"BASIC_AUTH_GROUPS"`
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"BASIC_AUTH_CACHE_TTL"`
+}
+
+// Mail - Delivery of password reset emails
+type Mail struct {
+	Driver       string `yaml:"driver" env:"MAIL_DRIVER"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	File         string `yaml:"file" env:"MAIL_FILE"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// OIDC - Optional single sign-on, disabled while IssuerURL is empty
+type OIDC struct {
+	IssuerURL    string   `yaml:"issuer_url" env:"OIDC_ISSUER_URL"`
+	ClientID     string   `yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes       []string `yaml:"scopes" env:"OIDC_SCOPES" sep:" "`
+}
+
+// Admin - Account created on first start (when there is no admin yet).
+// Without Password or PasswordFile a random password is generated and
+// printed once.
+type Admin struct {
+	Username     string `yaml:"username" env:"ADMIN_USERNAME"`
+	Password     string `yaml:"password" env:"ADMIN_PASSWORD" secret:"true"`
+	PasswordFile string `yaml:"password_file" env:"ADMIN_PASSWORD_FILE"`
+}
+
+// Current - Configuration in use; the defaults until Load is called
+var Current = Default()
+
+// Default - Configuration without any file or environment
+func Default() *Config {
+	return &Config{
+		Env: "development",
+		Server: Server{
+			Port:               "8080",
+			ReadTimeout:        15 * time.Second,
+			ReadHeaderTimeout:  5 * time.Second,
+			WriteTimeout:       30 * time.Second,
+			IdleTimeout:        60 * time.Second,
+			ShutdownTimeout:    15 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Database: Database{
+			Driver:               "postgres",
+			Path:                 "books.db",
+			MaxOpenConns:         25,
+			MaxIdleConns:         10,
+			ConnMaxLifetime:      30 * time.Minute,
+			ConnMaxIdleTime:      5 * time.Minute,
+			ConnectAttempts:      10,
+			ConnectBackoff:       500 * time.Millisecond,
+			ConnectMaxBackoff:    10 * time.Second,
+			QueryTimeout:         5 * time.Second,
+			QueryTimeouts:        map[string]time.Duration{},
+			ReplicaMaxLag:        10 * time.Second,
+			ReplicaCheckInterval: 5 * time.Second,
+			ReadYourWritesWindow: 5 * time.Second,
+		},
+		JWT: JWT{
+			Algorithm:     "HS256",
+			Secret:        PlaceholderJWTSecret,
+			RotationGrace: 48 * time.Hour,
+			Issuer:        "mini-project-buku",
+			Audience:      "mini-project-buku-api",
+			Leeway:        30 * time.Second,
+			TTL:           24 * time.Hour,
+		},
+		Session: Session{
+			TTL:            24 * time.Hour,
+			CookieSecure:   true,
+			CookieSameSite: "strict",
+		},
+		Auth: Auth{
+			RegistrationEnabled: true,
+			UsernameMinLength:   3,
+			UsernameMaxLength:   32,
+			PasswordMinLength:   8,
+			// bcrypt ignores everything after 72 bytes
+			PasswordMaxLength:      72,
+			TOTPIssuer:             "Mini Project Buku",
+			MFATokenTTL:            5 * time.Minute,
+			MFAEnrollTokenTTL:      15 * time.Minute,
+			PasswordChangeTokenTTL: 15 * time.Minute,
+			PasswordResetTTL:       time.Hour,
+			PasswordResetMaxTokens: 3,
+		},
+		Login: Login{
+			BackoffFreeAttempts: 3,
+			IPFreeAttempts:      20,
+			BackoffBase:         time.Second,
+			BackoffMax:          15 * time.Minute,
+			AttemptWindow:       15 * time.Minute,
+			LockThreshold:       10,
+			LockDuration:        15 * time.Minute,
+		},
+		BasicAuth: BasicAuth{CacheTTL: 5 * time.Minute},
+		Mail: Mail{
+			Driver:   "log",
+			File:     "mail.log",
+			SMTPPort: "587",
+		},
+		OIDC:  OIDC{Scopes: []string{"openid", "profile", "email"}},
+		Admin: Admin{Username: "admin"},
+	}
+}
+
+// Load - Read the configuration, in increasing precedence: the defaults,
+// the YAML file named by CONFIG_FILE (default config.yaml, skipped when
+// missing), .env and the process environment. The result becomes Current;
+// call Validate before using it.
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	cfg := Default()
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit || path == "" {
+		path = "config.yaml"
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.UnmarshalWithOptions(data, cfg, yaml.DisallowUnknownField()); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	case explicit || !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	if err := loadEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	Current = cfg
+	return cfg, nil
+}
+
+// Production - Whether APP_ENV is production
+func (c *Config) Production() bool {
+	return c.Env == "production"
+}
+
+// Validate - Check the configuration as a whole, reporting every problem.
+// Production additionally refuses the placeholder JWT secret and the
+// default admin password.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == "development" || c.Env == "production", "APP_ENV must be development or production, got %q", c.Env)
+	check(c.Server.Port != "", "PORT is required")
+	check(c.Server.ReadTimeout >= 0 && c.Server.ReadHeaderTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"SERVER_READ_TIMEOUT, SERVER_READ_HEADER_TIMEOUT, SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT must not be negative (0 means no timeout)")
+	check(c.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT must be positive")
+	check(c.Server.HealthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT must be positive")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "TRUSTED_PROXIES must list IPs or CIDRs, got %q", proxy)
+	}
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level)
+	check(oneOf(strings.ToLower(c.Log.Format), "json", "text"), "LOG_FORMAT must be json or text, got %q", c.Log.Format)
+
+	db := c.Database
+	check(oneOf(db.Driver, "postgres", "sqlite", "mysql"), "DB_DRIVER must be postgres, sqlite or mysql, got %q", db.Driver)
+	check(db.Driver != "sqlite" || db.Path != "", "DB_PATH is required for DB_DRIVER=sqlite")
+	check(len(db.ReplicaDSNs) == 0 || db.Driver == "postgres", "DB_REPLICA_DSNS is only supported with DB_DRIVER=postgres")
+	check(db.ReplicaCheckInterval > 0 && db.ReplicaMaxLag >= 0 && db.ReadYourWritesWindow >= 0, "DB_REPLICA_CHECK_INTERVAL must be positive, DB_REPLICA_MAX_LAG and DB_READ_YOUR_WRITES_WINDOW not negative")
+	check(db.MaxOpenConns >= 0 && db.MaxIdleConns >= 0, "DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative")
+	check(db.ConnMaxLifetime >= 0 && db.ConnMaxIdleTime >= 0, "DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(db.ConnectAttempts > 0, "DB_CONNECT_ATTEMPTS must be at least 1")
+	check(db.ConnectBackoff >= 0 && db.ConnectMaxBackoff >= 0, "DB_CONNECT_BACKOFF and DB_CONNECT_MAX_BACKOFF must not be negative")
+	check(db.QueryTimeout >= 0, "DB_QUERY_TIMEOUT must not be negative")
+	for group, timeout := range db.QueryTimeouts {
+		check(timeout >= 0, "DB_QUERY_TIMEOUT_%s must not be negative", strings.ToUpper(group))
+	}
+
+	jwt := c.JWT
+	check(oneOf(strings.ToUpper(jwt.Algorithm), "HS256", "RS256", "EDDSA"), "JWT_ALGORITHM must be HS256, RS256 or EdDSA, got %q", jwt.Algorithm)
+	check(strings.ToUpper(jwt.Algorithm) != "HS256" || jwt.Secret != "", "JWT_SECRET is required for HS256")
+	check(jwt.RotationInterval >= 0, "JWT_ROTATION_INTERVAL must not be negative")
+	check(jwt.TTL > 0, "JWT_TTL must be positive")
+
+	check(oneOf(strings.ToLower(c.Session.CookieSameSite), "strict", "lax"), "SESSION_COOKIE_SAMESITE must be strict or lax, got %q", c.Session.CookieSameSite)
+	check(c.Session.TTL > 0, "SESSION_TTL must be positive")
+
+	a := c.Auth
+	check(a.UsernameMinLength > 0 && a.UsernameMinLength <= a.UsernameMaxLength, "USERNAME_MIN_LENGTH must be between 1 and USERNAME_MAX_LENGTH")
+	check(a.PasswordMinLength > 0 && a.PasswordMinLength <= a.PasswordMaxLength, "PASSWORD_MIN_LENGTH must be between 1 and PASSWORD_MAX_LENGTH")
+	check(a.PasswordMaxLength <= 72, "PASSWORD_MAX_LENGTH must not exceed 72 (bcrypt ignores the rest)")
+	check(a.MFATokenTTL > 0 && a.MFAEnrollTokenTTL > 0 && a.PasswordChangeTokenTTL > 0 && a.PasswordResetTTL > 0, "MFA_TOKEN_TTL, MFA_ENROLL_TOKEN_TTL, PASSWORD_CHANGE_TOKEN_TTL and PASSWORD_RESET_TTL must be positive")
+	check(a.PasswordResetMaxTokens > 0, "PASSWORD_RESET_MAX_TOKENS must be at least 1")
+	if a.PasswordResetURL != "" {
+		u, err := url.Parse(a.PasswordResetURL)
+		check(err == nil && u.IsAbs(), "PASSWORD_RESET_URL must be an absolute URL, got %q", a.PasswordResetURL)
+	}
+
+	l := c.Login
+	check(l.BackoffFreeAttempts > 0 && l.IPFreeAttempts > 0 && l.LockThreshold > 0, "LOGIN_BACKOFF_FREE_ATTEMPTS, LOGIN_IP_FREE_ATTEMPTS and LOGIN_LOCK_THRESHOLD must be at least 1")
+	check(l.BackoffBase > 0 && l.BackoffMax >= l.BackoffBase, "LOGIN_BACKOFF_BASE must be positive and not above LOGIN_BACKOFF_MAX")
+	check(l.AttemptWindow > 0 && l.LockDuration > 0, "LOGIN_ATTEMPT_WINDOW and LOGIN_LOCK_DURATION must be positive")
+
+	check(c.BasicAuth.CacheTTL >= 0, "BASIC_AUTH_CACHE_TTL must not be negative")
+
+	m := c.Mail
+	check(oneOf(m.Driver, "log", "file", "smtp"), "MAIL_DRIVER must be log, file or smtp, got %q", m.Driver)
+	check(m.Driver != "smtp" || (m.SMTPHost != "" && m.From != ""), "MAIL_DRIVER=smtp requires SMTP_HOST and MAIL_FROM")
+
+	check(c.OIDC.IssuerURL == "" || (c.OIDC.ClientID != "" && c.OIDC.RedirectURL != ""), "OIDC_ISSUER_URL requires OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+
+	check(c.Admin.Username != "", "ADMIN_USERNAME must not be empty")
+	check(c.Admin.Password == "" || c.Admin.PasswordFile == "", "set only one of ADMIN_PASSWORD and ADMIN_PASSWORD_FILE")
+
+	if c.Production() {
+		check(strings.ToUpper(jwt.Algorithm) != "HS256" || jwt.Secret != PlaceholderJWTSecret, "JWT_SECRET still has the placeholder value; set a random secret for production")
+		check(c.Admin.Password != LegacyAdminPassword, "ADMIN_PASSWORD is the old default password; set another one for production")
+	}
+
+	return errors.Join(errs...)
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
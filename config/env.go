@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// loadEnv - Override fields of cfg with the environment variables named in
+// their env tags. Empty variables count as unset. A tag ending in "*" is a
+// prefix: DB_QUERY_TIMEOUT_BOOKS=2s sets QueryTimeouts["books"].
+func loadEnv(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		tag := field.Tag.Get("env")
+		if tag == "" {
+			return nil
+		}
+
+		if prefix, ok := strings.CutSuffix(tag, "*"); ok {
+			for _, entry := range os.Environ() {
+				key, raw, _ := strings.Cut(entry, "=")
+				name, ok := strings.CutPrefix(key, prefix)
+				if !ok || name == "" || raw == "" {
+					continue
+				}
+				elem := reflect.New(value.Type().Elem()).Elem()
+				if err := setValue(elem, raw, ""); err != nil {
+					return fmt.Errorf("%s: %v", key, err)
+				}
+				if value.IsNil() {
+					value.Set(reflect.MakeMap(value.Type()))
+				}
+				value.SetMapIndex(reflect.ValueOf(strings.ToLower(name)), elem)
+			}
+			return nil
+		}
+
+		for _, key := range strings.Split(tag, ",") {
+			if raw := os.Getenv(key); raw != "" {
+				if err := setValue(value, raw, field.Tag.Get("sep")); err != nil {
+					return fmt.Errorf("%s: %v", key, err)
+				}
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// walk - Call fn for every leaf field of the struct v, depth first
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := walk(value, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setValue - Parse raw into a string, bool, int, duration or list field.
+// Lists are comma separated unless sep says otherwise.
+func setValue(value reflect.Value, raw, sep string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetInt(int64(n))
+	case reflect.Slice:
+		if sep == "" {
+			sep = ","
+		}
+		items := []string{}
+		for _, item := range strings.Split(raw, sep) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", value.Type())
+	}
+	return nil
+}
+
+// Redacted - Copy of the configuration with secrets (secret tag) masked
+func (c *Config) Redacted() *Config {
+	copied := *c
+	walk(reflect.ValueOf(&copied).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		if field.Tag.Get("secret") != "true" || value.IsZero() {
+			return nil
+		}
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString("[redacted]")
+		case reflect.Slice:
+			masked := make([]string, value.Len())
+			for i := range masked {
+				masked[i] = "[redacted]"
+			}
+			value.Set(reflect.ValueOf(masked))
+		}
+		return nil
+	})
+	return &copied
+}
+
+// YAML - The configuration in the format of the config file
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/logging"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminHandler - Account administration and the security event log
+type AdminHandler struct {
+	users  repository.UserRepository
+	events repository.SecurityEventRepository
+}
+
+// NewAdminHandler - Admin endpoints backed by the given repositories
+func NewAdminHandler(users repository.UserRepository, events repository.SecurityEventRepository) *AdminHandler {
+	return &AdminHandler{users: users, events: events}
+}
+
+// UnlockUser - Clear failed login attempts and lockout for a user
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	unlocked, err := h.users.Unlock(c.Request.Context(), id, c.GetString("username"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	login.Attempts.Reset(login.UserKey(unlocked))
+	login.Credentials.ForgetUser(id)
+	audit.Record(c, audit.EventAccountUnlocked, audit.Success, audit.Event{Details: "unlocked_user=" + unlocked})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+// GetSecurityEvents - List security events, newest first. Filters:
+// event_type, outcome, username, user_id, ip, since, until (RFC3339),
+// limit (default 100, max 1000) and offset
+func (h *AdminHandler) GetSecurityEvents(c *gin.Context) {
+	filter := repository.SecurityEventFilter{
+		EventType: c.Query("event_type"),
+		Outcome:   c.Query("outcome"),
+		Username:  c.Query("username"),
+		IPAddress: c.Query("ip"),
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		filter.UserID = userID
+	}
+	for param, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + ", expected RFC3339"})
+				return
+			}
+			*bound = t
+		}
+	}
+
+	var err error
+	filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || filter.Limit < 1 || filter.Limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+	filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	events, err := h.events.List(c.Request.Context(), filter)
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetDBStats - Connection pool statistics for tuning DB_MAX_OPEN_CONNS and friends
+func GetDBStats(c *gin.Context) {
+	stats := database.DB.Stats()
+	settings := database.LoadPoolSettings()
+
+	replicas := []database.ReplicaStatus{}
+	if database.Replicas != nil {
+		replicas = database.Replicas.Status()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_idle_time_closed": stats.MaxIdleTimeClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		"settings": gin.H{
+			"max_open_conns":     settings.MaxOpenConns,
+			"max_idle_conns":     settings.MaxIdleConns,
+			"conn_max_lifetime":  settings.ConnMaxLifetime.String(),
+			"conn_max_idle_time": settings.ConnMaxIdleTime.String(),
+		},
+		"replicas": replicas,
+	})
+}
+
+// GetLogLevel - Minimum level currently logged
+func GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": strings.ToLower(logging.Level().String())})
+}
+
+// SetLogLevel - Change the minimum log level (debug, info, warn, error)
+// until the next restart, which goes back to LOG_LEVEL
+func SetLogLevel(c *gin.Context) {
+	var req models.LogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous := strings.ToLower(logging.Level().String())
+	if err := logging.SetLevel(req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	level := strings.ToLower(logging.Level().String())
+
+	audit.Record(c, audit.EventLogLevelChanged, audit.Success, audit.Event{Details: previous + " -> " + level})
+	c.JSON(http.StatusOK, gin.H{"level": level, "previous": previous})
+}
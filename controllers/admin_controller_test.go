@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+	"mini-project-buku-sb-go-73-Agil/logging"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestUnlockUser(t *testing.T) {
+	// Both the lock and the username backoff kick in after two failures
+	withLoginSettings(t, config.Login{
+		BackoffFreeAttempts: 2,
+		IPFreeAttempts:      100,
+		BackoffBase:         time.Minute,
+		BackoffMax:          time.Hour,
+		AttemptWindow:       time.Hour,
+		LockThreshold:       3,
+		LockDuration:        time.Hour,
+	})
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	s.as = gin.H{"username": "boss", "user_id": 99, "role": "admin", "auth_method": "jwt"}
+
+	for i := 0; i < 3; i++ {
+		s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "wrong"})
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"}), http.StatusTooManyRequests)
+
+	expectStatus(t, s.do(http.MethodPost, "/api/admin/users/abc/unlock", nil), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPost, "/api/admin/users/"+itoa(user.ID+100)+"/unlock", nil), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodPost, "/api/admin/users/"+itoa(user.ID)+"/unlock", nil), http.StatusOK)
+
+	// Lock and backoff are both gone
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"}), http.StatusOK)
+
+	events, err := s.repos.SecurityEvents.List(context.Background(), repository.SecurityEventFilter{EventType: audit.EventAccountUnlocked, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Username == nil || *events[0].Username != "boss" || events[0].Details == nil || *events[0].Details != "unlocked_user=budi" {
+		t.Fatalf("unlock events = %+v, want one by boss for budi", events)
+	}
+}
+
+func TestGetSecurityEvents(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "wrong"})
+	s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "nobody", Password: "wrong"})
+	s.as = gin.H{"username": "boss", "user_id": 99, "role": "admin", "auth_method": "jwt"}
+
+	list := func(query string) []models.SecurityEvent {
+		t.Helper()
+		w := s.do(http.MethodGet, "/api/admin/security-events"+query, nil)
+		expectStatus(t, w, http.StatusOK)
+		return decodeJSON[[]models.SecurityEvent](t, w)
+	}
+
+	all := list("")
+	if len(all) != 3 || all[0].Username == nil || *all[0].Username != "nobody" {
+		t.Fatalf("events = %+v, want three, newest first", all)
+	}
+	for query, want := range map[string]int{
+		"?outcome=failure":                  2,
+		"?username=budi":                    2,
+		"?user_id=" + itoa(user.ID):         2,
+		"?event_type=login&outcome=success": 1,
+		"?event_type=register":              0,
+		"?ip=192.0.2.1":                     3,
+		"?limit=1":                          1,
+		"?offset=2":                         1,
+		"?since=2000-01-01T00:00:00Z":       3,
+		"?until=2000-01-01T00:00:00Z":       0,
+	} {
+		if got := list(query); len(got) != want {
+			t.Errorf("%s: %d events, want %d", query, len(got), want)
+		}
+	}
+
+	for _, query := range []string{"?user_id=abc", "?since=yesterday", "?limit=0", "?limit=1001", "?offset=-1"} {
+		expectStatus(t, s.do(http.MethodGet, "/api/admin/security-events"+query, nil), http.StatusBadRequest)
+	}
+}
+
+// failingEvents - Security events whose store answers with a driver error
+type failingEvents struct {
+	repository.SecurityEventRepository
+}
+
+func (failingEvents) List(ctx context.Context, filter repository.SecurityEventFilter) ([]models.SecurityEvent, error) {
+	return nil, errors.New(`pq: relation "security_events" does not exist`)
+}
+
+func TestGetSecurityEventsHidesDriverError(t *testing.T) {
+	repos := repository.NewMemory()
+	router := gin.New()
+	router.GET("/api/admin/security-events", NewAdminHandler(repos.Users, failingEvents{repos.SecurityEvents}).GetSecurityEvents)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/security-events", nil))
+
+	// The error stays in the log
+	expectStatus(t, w, http.StatusInternalServerError)
+	if body := w.Body.String(); strings.Contains(body, "relation") || strings.Contains(body, "security_events") {
+		t.Fatalf("body %s carries the driver error", body)
+	}
+}
+
+func TestGetDBStats(t *testing.T) {
+	dbtest.Open(t, "sqlite")
+	router := gin.New()
+	router.GET("/api/admin/db/stats", GetDBStats)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/db/stats", nil))
+	expectStatus(t, w, http.StatusOK)
+
+	stats := decodeJSON[struct {
+		MaxOpenConnections int `json:"max_open_connections"`
+		OpenConnections    int `json:"open_connections"`
+		Settings           struct {
+			MaxOpenConns    int    `json:"max_open_conns"`
+			ConnMaxLifetime string `json:"conn_max_lifetime"`
+		} `json:"settings"`
+	}](t, w)
+	if stats.MaxOpenConnections != 1 || stats.OpenConnections < 1 {
+		t.Errorf("stats = %+v, want the single SQLite connection open", stats)
+	}
+	if stats.Settings.MaxOpenConns != config.Current.Database.MaxOpenConns || stats.Settings.ConnMaxLifetime != config.Current.Database.ConnMaxLifetime.String() {
+		t.Errorf("settings = %+v, want the configured pool settings", stats.Settings)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	previous := logging.Level()
+	t.Cleanup(func() { logging.SetLevel(previous.String()) })
+	logging.SetLevel("info")
+	s := newTestServer(t)
+	s.as = gin.H{"username": "boss", "user_id": 99, "role": "admin", "auth_method": "jwt"}
+
+	w := s.do(http.MethodGet, "/api/admin/log-level", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[map[string]string](t, w); resp["level"] != "info" {
+		t.Fatalf("level = %v, want info", resp)
+	}
+
+	w = s.do(http.MethodPut, "/api/admin/log-level", models.LogLevelRequest{Level: "DEBUG"})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[map[string]string](t, w); resp["level"] != "debug" || resp["previous"] != "info" {
+		t.Fatalf("response = %v, want debug after info", resp)
+	}
+
+	expectStatus(t, s.do(http.MethodPut, "/api/admin/log-level", models.LogLevelRequest{Level: "verbose"}), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPut, "/api/admin/log-level", nil), http.StatusBadRequest)
+	if level := logging.Level().String(); level != "DEBUG" {
+		t.Fatalf("level = %s after rejected changes, want DEBUG", level)
+	}
+
+	events, err := s.repos.SecurityEvents.List(context.Background(), repository.SecurityEventFilter{EventType: audit.EventLogLevelChanged, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Details == nil || *events[0].Details != "info -> debug" {
+		t.Fatalf("events = %+v, want one change from info to debug", events)
+	}
+}
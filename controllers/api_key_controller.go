@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyHandler - Management of the current user's API keys
+type APIKeyHandler struct {
+	keys repository.APIKeyRepository
+}
+
+// NewAPIKeyHandler - API key endpoints backed by the given repository
+func NewAPIKeyHandler(keys repository.APIKeyRepository) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// CreateAPIKey - Create an API key for the current user (key is shown once)
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	if !requireInteractiveLogin(c) {
+		return
+	}
+
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope, "valid_scopes": auth.KnownScopes})
+			return
+		}
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	resp := models.APIKeyResponse{Key: key}
+	resp.Name = req.Name
+	resp.Prefix = prefix
+	resp.Scopes = req.Scopes
+
+	// Keys without expires_in_days never expire
+	lifetime := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	err = h.keys.Create(c.Request.Context(), currentUserID(c), &resp.APIKey, hash, lifetime)
+	if err != nil {
+		dbError(c, err, "Failed to create API key")
+		return
+	}
+
+	audit.Record(c, audit.EventAPIKeyCreated, audit.Success, audit.Event{Details: "prefix=" + prefix + " scopes=" + strings.Join(req.Scopes, ",")})
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetAPIKeys - List the current user's active API keys
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	if !requireInteractiveLogin(c) {
+		return
+	}
+
+	keys, err := h.keys.ListActive(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// DeleteAPIKey - Revoke one of the current user's API keys
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	if !requireInteractiveLogin(c) {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	err = h.keys.Revoke(c.Request.Context(), id, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	audit.Record(c, audit.EventAPIKeyRevoked, audit.Success, audit.Event{Details: "api_key_id=" + c.Param("id")})
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+// requireInteractiveLogin - API keys cannot be used to manage API keys
+func requireInteractiveLogin(c *gin.Context) bool {
+	if method, _ := c.Get("auth_method"); method == "api_key" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires a user login"})
+		return false
+	}
+	return true
+}
+
+func currentUserID(c *gin.Context) int {
+	id, _ := c.Get("user_id")
+	userID, _ := id.(int)
+	return userID
+}
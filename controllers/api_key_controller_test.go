@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+func TestAPIKeyCRUD(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	other := s.createUser(t, "sari", "correct horse")
+	s.as["user_id"] = user.ID
+
+	w := s.do(http.MethodPost, "/api/users/me/api-keys", models.APIKeyRequest{Name: "ci", Scopes: []string{"books:read", "categories:*"}, ExpiresInDays: 30})
+	expectStatus(t, w, http.StatusCreated)
+	created := decodeJSON[models.APIKeyResponse](t, w)
+	if created.ID == 0 || created.Key == "" || created.Prefix != created.Key[:len(created.Prefix)] || created.ExpiresAt == nil {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// Only the hash is stored
+	key, owner, err := s.repos.APIKeys.Authenticate(context.Background(), auth.HashAPIKey(created.Key))
+	if err != nil || key.ID != created.ID || owner.ID != user.ID {
+		t.Fatalf("Authenticate = %+v, %+v, %v", key, owner, err)
+	}
+
+	w = s.do(http.MethodGet, "/api/users/me/api-keys", nil)
+	expectStatus(t, w, http.StatusOK)
+	if keys := decodeJSON[[]models.APIKey](t, w); len(keys) != 1 || keys[0].Name != "ci" {
+		t.Fatalf("keys = %+v", keys)
+	}
+
+	// Somebody else's key is not found
+	s.as["user_id"] = other.ID
+	expectStatus(t, s.do(http.MethodDelete, "/api/users/me/api-keys/"+itoa(created.ID), nil), http.StatusNotFound)
+
+	s.as["user_id"] = user.ID
+	expectStatus(t, s.do(http.MethodDelete, "/api/users/me/api-keys/"+itoa(created.ID), nil), http.StatusOK)
+	expectStatus(t, s.do(http.MethodDelete, "/api/users/me/api-keys/"+itoa(created.ID), nil), http.StatusNotFound)
+	if _, _, err := s.repos.APIKeys.Authenticate(context.Background(), auth.HashAPIKey(created.Key)); err == nil {
+		t.Fatal("revoked key still authenticates")
+	}
+}
+
+func TestAPIKeyValidation(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	s.as["user_id"] = user.ID
+
+	for _, tt := range []struct {
+		name string
+		req  models.APIKeyRequest
+	}{
+		{"unknown scope", models.APIKeyRequest{Name: "ci", Scopes: []string{"users:read"}}},
+		{"no scopes", models.APIKeyRequest{Name: "ci"}},
+		{"no name", models.APIKeyRequest{Scopes: []string{"books:read"}}},
+		{"negative lifetime", models.APIKeyRequest{Name: "ci", Scopes: []string{"books:read"}, ExpiresInDays: -1}},
+	} {
+		if w := s.do(http.MethodPost, "/api/users/me/api-keys", tt.req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, w.Code)
+		}
+	}
+	expectStatus(t, s.do(http.MethodDelete, "/api/users/me/api-keys/abc", nil), http.StatusBadRequest)
+
+	// An API key cannot manage API keys
+	s.as["auth_method"] = "api_key"
+	expectStatus(t, s.do(http.MethodGet, "/api/users/me/api-keys", nil), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/api-keys", models.APIKeyRequest{Name: "ci", Scopes: []string{"books:read"}}), http.StatusForbidden)
+}
@@ -1,88 +1,206 @@
 package controllers
 
 import (
-    "net/http"
-    "time"
-    "github.com/gin-gonic/gin"
-    "golang.org/x/crypto/bcrypt"
-    "github.com/golang-jwt/jwt/v5"
-    "mini-project-buku-sb-go-73-Agil/models"
-    "mini-project-buku-sb-go-73-Agil/database"
-    "os"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
 )
 
-func Login(c *gin.Context) {
-    var req models.LoginRequest
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    // Query user from database
-    var user models.User
-    query := "SELECT id, username, password FROM users WHERE username = $1"
-    err := database.DB.QueryRow(query, req.Username).Scan(&user.ID, &user.Username, &user.Password)
-    
-    if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-        return
-    }
-
-    // Check password
-    err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
-    if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-        return
-    }
-
-    // Create JWT token
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-        "username": user.Username,
-        "user_id":  user.ID,
-        "exp":      time.Now().Add(time.Hour * 24).Unix(),
-    })
-
-    jwtSecret := os.Getenv("JWT_SECRET")
-    if jwtSecret == "" {
-        jwtSecret = "your-secret-key-change-in-production"
-    }
-
-    tokenString, err := token.SignedString([]byte(jwtSecret))
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-        return
-    }
-
-    c.JSON(http.StatusOK, models.LoginResponse{Token: tokenString})
+// AuthHandler - Login (password, 2FA, OIDC), sessions, token refresh,
+// registration and the password and 2FA settings of the current user
+type AuthHandler struct {
+	users     repository.UserRepository
+	twoFactor repository.TwoFactorRepository
+	resets    repository.PasswordResetRepository
+	sessions  repository.SessionRepository
+	verifier  *login.Verifier
+}
+
+// NewAuthHandler - Auth endpoints backed by the given repositories
+func NewAuthHandler(users repository.UserRepository, twoFactor repository.TwoFactorRepository,
+	resets repository.PasswordResetRepository, sessions repository.SessionRepository) *AuthHandler {
+	return &AuthHandler{users: users, twoFactor: twoFactor, resets: resets, sessions: sessions, verifier: login.NewVerifier(users)}
+}
+
+// Login - Exchange username and password for an API token
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.verifier.Verify(c, "password", req.Username, req.Password)
+	var retry *login.RetryError
+	switch {
+	case errors.As(err, &retry):
+		login.TooManyAttempts(c, retry.Wait)
+		return
+	case errors.Is(err, login.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	case err != nil:
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	h.continueLogin(c, user, "password")
+}
+
+// continueLogin - What follows the first factor, the same for every login
+// method (password, OIDC): a locked account is refused, then the OTP is
+// asked for, and the rest is up to finishLogin
+func (h *AuthHandler) continueLogin(c *gin.Context, user models.User, method string) {
+	if refuseLocked(c, user, method) {
+		return
+	}
+
+	// Second step: OTP required
+	if user.TOTPEnabled {
+		issueMFAChallenge(c, user, auth.PurposeMFA)
+		return
+	}
+	h.finishLogin(c, user, method)
+}
+
+// finishLogin - What follows the last factor (the OTP step and the
+// mandatory enrollment get here too): a locked account is refused, a
+// pending password change comes next, then mandatory 2FA enrollment, and
+// only then the token or session is issued
+func (h *AuthHandler) finishLogin(c *gin.Context, user models.User, method string) {
+	if refuseLocked(c, user, method) {
+		return
+	}
+	// The password must be replaced before anything else, 2FA enrollment included
+	if user.MustChangePassword {
+		issuePasswordChange(c, user)
+		return
+	}
+	if twoFactorRequired(user) && !user.TOTPEnabled {
+		issueMFAChallenge(c, user, auth.PurposeEnroll)
+		return
+	}
+
+	h.completeLogin(c, user, method)
+}
+
+// refuseLocked - Answer 429 when the account is locked
+func refuseLocked(c *gin.Context, user models.User, method string) bool {
+	if user.LockedFor <= 0 {
+		return false
+	}
+	audit.Record(c, audit.EventLogin, audit.Denied, audit.Event{UserID: user.ID, Username: user.Username, Details: "account locked, method=" + method})
+	login.TooManyAttempts(c, user.LockedFor)
+	return true
+}
+
+// completeLogin - Issue the API token (or a cookie session) for an
+// authenticated user (shared by password, 2FA and OIDC login)
+func (h *AuthHandler) completeLogin(c *gin.Context, user models.User, method string) {
+	audit.Record(c, audit.EventLogin, audit.Success, audit.Event{UserID: user.ID, Username: user.Username, Details: "method=" + method})
+
+	if wantsCookieSession(c) {
+		h.startSession(c, user)
+		return
+	}
+
+	tokenString, err := auth.Tokens.Issue(user.ID, user.Username, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LoginResponse{Token: tokenString, RecoveryCodes: c.GetStringSlice("recovery_codes")})
+}
+
+// RefreshToken - Exchange a valid Bearer token for a fresh one
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	if method := c.GetString("auth_method"); method != "jwt" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only Bearer tokens can be refreshed"})
+		return
+	}
+
+	// Re-read the user so role changes and deleted accounts take effect
+	user, err := h.users.GetByID(c.Request.Context(), currentUserID(c))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	if err != nil {
+		audit.Record(c, audit.EventTokenRefresh, audit.Failure, audit.Event{Details: "user not found"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	tokenString, err := auth.Tokens.Issue(user.ID, user.Username, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	audit.Record(c, audit.EventTokenRefresh, audit.Success, audit.Event{UserID: user.ID, Username: user.Username})
+	c.JSON(http.StatusOK, models.LoginResponse{Token: tokenString})
+}
+
+// GetJWKS - Public signing keys so other services can verify tokens
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.Keys.JWKS())
 }
 
 // Register - Optional endpoint for user registration
-func Register(c *gin.Context) {
-    var req models.LoginRequest
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    // Hash password
-    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-        return
-    }
-
-    // Insert user into database
-    query := "INSERT INTO users (username, password, created_by) VALUES ($1, $2, $3) RETURNING id"
-    var userID int
-    err = database.DB.QueryRow(query, req.Username, string(hashedPassword), "system").Scan(&userID)
-    
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user: " + err.Error()})
-        return
-    }
-
-    c.JSON(http.StatusCreated, gin.H{
-        "message": "User created successfully",
-        "user_id": userID,
-    })
-}
\ No newline at end of file
+func (h *AuthHandler) Register(c *gin.Context) {
+	if !auth.RegistrationEnabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+		return
+	}
+
+	var req models.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate username and password policy
+	if err := auth.ValidateUsername(req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := auth.ValidatePassword(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Insert user into database
+	user := models.User{Username: req.Username, Password: string(hashedPassword), Email: req.Email, CreatedBy: "system"}
+	err = h.users.Create(c.Request.Context(), &user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		audit.Record(c, audit.EventRegister, audit.Failure, audit.Event{Username: req.Username, Details: "username taken"})
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Failed to create user")
+		return
+	}
+
+	audit.Record(c, audit.EventRegister, audit.Success, audit.Event{UserID: user.ID, Username: user.Username})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "User created successfully",
+		"user_id": user.ID,
+	})
+}
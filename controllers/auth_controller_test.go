@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+// withLoginSettings - Use login for the test and restore the previous settings
+func withLoginSettings(t *testing.T, login config.Login) {
+	t.Helper()
+	previous := config.Current.Login
+	config.Current.Login = login
+	t.Cleanup(func() { config.Current.Login = previous })
+}
+
+// createUser - Store a user with password (hashed at the minimum cost)
+func (s *testServer) createUser(t *testing.T, username, password string) models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: username, Password: string(hash), Role: "user", CreatedBy: "test"}
+	if err := s.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// loginEvents - Outcomes of the recorded login events, oldest first
+func (s *testServer) loginEvents(t *testing.T) []string {
+	t.Helper()
+	events, err := s.repos.SecurityEvents.List(context.Background(), repository.SecurityEventFilter{EventType: audit.EventLogin, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes := make([]string, len(events))
+	for i, event := range events {
+		outcomes[len(events)-1-i] = event.Outcome
+	}
+	return outcomes
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser(t, "budi", "correct horse")
+
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.LoginResponse](t, w); resp.Token == "" {
+		t.Fatal("login returned no token")
+	}
+
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "wrong"}), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "nobody", Password: "wrong"}), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", map[string]string{"username": "budi"}), http.StatusBadRequest)
+
+	outcomes := s.loginEvents(t)
+	want := []string{audit.Success, audit.Failure, audit.Failure}
+	if len(outcomes) != len(want) {
+		t.Fatalf("login events = %v, want %v", outcomes, want)
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Fatalf("login events = %v, want %v", outcomes, want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	// Generous backoff allowances, so only the account lock stops the attempts
+	withLoginSettings(t, config.Login{
+		BackoffFreeAttempts: 100,
+		IPFreeAttempts:      100,
+		BackoffBase:         time.Second,
+		BackoffMax:          time.Minute,
+		AttemptWindow:       time.Hour,
+		LockThreshold:       3,
+		LockDuration:        15 * time.Minute,
+	})
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+
+	for i := 0; i < 3; i++ {
+		expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "wrong"}), http.StatusUnauthorized)
+	}
+
+	// Locked: the right password is refused too
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("locked login without Retry-After")
+	}
+
+	stored, err := s.repos.Users.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LockedFor <= 0 || stored.LockedFor > 15*time.Minute {
+		t.Fatalf("LockedFor = %v, want within the lock duration", stored.LockedFor)
+	}
+
+	outcomes := s.loginEvents(t)
+	if len(outcomes) != 4 || outcomes[3] != audit.Denied {
+		t.Fatalf("login events = %v, want three failures and a denial", outcomes)
+	}
+
+	// Unlocking lets the user back in
+	if _, err := s.repos.Users.Unlock(context.Background(), user.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"}), http.StatusOK)
+}
+
+func TestLoginBackoff(t *testing.T) {
+	withLoginSettings(t, config.Login{
+		BackoffFreeAttempts: 2,
+		IPFreeAttempts:      100,
+		BackoffBase:         time.Minute,
+		BackoffMax:          time.Hour,
+		AttemptWindow:       time.Hour,
+		LockThreshold:       100,
+		LockDuration:        time.Minute,
+	})
+	s := newTestServer(t)
+	s.createUser(t, "budi", "correct horse")
+
+	for i := 0; i < 3; i++ {
+		expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "wrong"}), http.StatusUnauthorized)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"}), http.StatusTooManyRequests)
+
+	// Unknown usernames are tracked the same way
+	for i := 0; i < 3; i++ {
+		expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "nobody", Password: "wrong"}), http.StatusUnauthorized)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "nobody", Password: "wrong"}), http.StatusTooManyRequests)
+}
+
+func TestRegister(t *testing.T) {
+	s := newTestServer(t)
+
+	register := func(username, password, email string) int {
+		return s.do(http.MethodPost, "/api/users/register", models.RegisterRequest{Username: username, Password: password, Email: email}).Code
+	}
+	for _, tt := range []struct {
+		name                      string
+		username, password, email string
+		want                      int
+	}{
+		{"valid", "budi", "correct horse", "budi@example.com", http.StatusCreated},
+		{"username taken", "budi", "correct horse", "", http.StatusConflict},
+		{"username with capitals", "Sari", "correct horse", "", http.StatusBadRequest},
+		{"reserved username", "admin", "correct horse", "", http.StatusBadRequest},
+		{"short password", "sari", "short", "", http.StatusBadRequest},
+		{"password is the username", "sarisari", "SARISARI", "", http.StatusBadRequest},
+		{"invalid email", "sari", "correct horse", "not-an-address", http.StatusBadRequest},
+	} {
+		if got := register(tt.username, tt.password, tt.email); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	user, err := s.repos.Users.GetByUsername(context.Background(), "budi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != "user" || user.Email != "budi@example.com" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("correct horse")) != nil {
+		t.Fatalf("registered user = %+v", user)
+	}
+
+	previous := config.Current.Auth.RegistrationEnabled
+	config.Current.Auth.RegistrationEnabled = false
+	t.Cleanup(func() { config.Current.Auth.RegistrationEnabled = previous })
+	if got := register("sari", "correct horse", ""); got != http.StatusForbidden {
+		t.Fatalf("registration disabled: status = %d, want 403", got)
+	}
+}
+
+// failingLockout - Users whose failed login counter cannot be written
+type failingLockout struct {
+	repository.UserRepository
+}
+
+func (failingLockout) RecordFailedLogin(ctx context.Context, id, threshold int, lockFor time.Duration) error {
+	return errors.New("counter unavailable")
+}
+
+func TestLoginFailsWithoutLockoutCounter(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser(t, "budi", "correct horse")
+	authHandler := NewAuthHandler(failingLockout{s.repos.Users}, s.repos.TwoFactor, s.repos.PasswordResets, s.repos.Sessions)
+	router := gin.New()
+	router.POST("/api/users/login", authHandler.Login)
+
+	// Guessing must not go on without the lockout counting it
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users/login", strings.NewReader(`{"username":"budi","password":"wrong"}`)))
+	expectStatus(t, w, http.StatusInternalServerError)
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func itoa(id int) string {
+	return strconv.Itoa(id)
+}
+
+func TestBookCRUD(t *testing.T) {
+	s := newTestServer(t)
+	category := decodeJSON[models.Category](t, s.do(http.MethodPost, "/api/categories", models.Category{Name: "Fiksi"}))
+
+	w := s.do(http.MethodPost, "/api/books", models.BookRequest{
+		Title: "Laskar Pelangi", ReleaseYear: 2005, Price: 85000, TotalPage: 529, CategoryID: category.ID,
+	})
+	expectStatus(t, w, http.StatusCreated)
+	created := decodeJSON[models.Book](t, w)
+	if created.ID == 0 || created.Thickness != "tebal" || created.CreatedBy != "tester" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	w = s.do(http.MethodGet, "/api/books/"+itoa(created.ID), nil)
+	expectStatus(t, w, http.StatusOK)
+	got := decodeJSON[models.Book](t, w)
+	if got.Title != "Laskar Pelangi" || got.Category == nil || got.Category.Name != "Fiksi" {
+		t.Fatalf("got %+v", got)
+	}
+
+	w = s.do(http.MethodPut, "/api/books/"+itoa(created.ID), models.BookRequest{
+		Title: "Laskar Pelangi (edisi baru)", ReleaseYear: 2006, Price: 90000, TotalPage: 80,
+	})
+	expectStatus(t, w, http.StatusOK)
+	updated := decodeJSON[models.Book](t, w)
+	if updated.Thickness != "tipis" || updated.CategoryID != 0 || updated.CreatedBy != "tester" || updated.ModifiedBy != "tester" {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	w = s.do(http.MethodGet, "/api/books", nil)
+	expectStatus(t, w, http.StatusOK)
+	if books := decodeJSON[[]models.Book](t, w); len(books) != 1 || books[0].Title != "Laskar Pelangi (edisi baru)" {
+		t.Fatalf("books = %+v", books)
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/books/"+itoa(created.ID), nil), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, "/api/books/"+itoa(created.ID), nil), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, "/api/books/"+itoa(created.ID), nil), http.StatusNotFound)
+}
+
+func TestBookErrors(t *testing.T) {
+	s := newTestServer(t)
+	valid := models.BookRequest{Title: "Bumi Manusia", ReleaseYear: 1980, Price: 1, TotalPage: 1}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"missing title", http.MethodPost, "/api/books", models.BookRequest{ReleaseYear: 2000, Price: 1, TotalPage: 1}, http.StatusBadRequest},
+		{"release year too old", http.MethodPost, "/api/books", models.BookRequest{Title: "x", ReleaseYear: 1979, Price: 1, TotalPage: 1}, http.StatusBadRequest},
+		{"release year too new", http.MethodPost, "/api/books", models.BookRequest{Title: "x", ReleaseYear: 2025, Price: 1, TotalPage: 1}, http.StatusBadRequest},
+		{"unknown category", http.MethodPost, "/api/books", models.BookRequest{Title: "x", ReleaseYear: 2000, Price: 1, TotalPage: 1, CategoryID: 99}, http.StatusUnprocessableEntity},
+		{"invalid id", http.MethodGet, "/api/books/abc", nil, http.StatusBadRequest},
+		{"unknown book", http.MethodGet, "/api/books/99", nil, http.StatusNotFound},
+		{"update unknown book", http.MethodPut, "/api/books/99", valid, http.StatusNotFound},
+		{"update invalid id", http.MethodPut, "/api/books/abc", valid, http.StatusBadRequest},
+		{"delete invalid id", http.MethodDelete, "/api/books/abc", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, s.do(tt.method, tt.path, tt.body), tt.status)
+		})
+	}
+
+	// A valid book with the boundary values is accepted
+	expectStatus(t, s.do(http.MethodPost, "/api/books", valid), http.StatusCreated)
+}
+
+// slowBooks - Book storage whose listing only ends with the context
+type slowBooks struct {
+	repository.BookRepository
+}
+
+func (slowBooks) List(ctx context.Context) ([]models.Book, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGetBooksTimeout(t *testing.T) {
+	router := gin.New()
+	router.GET("/api/books", NewBookHandler(slowBooks{}).GetBooks)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/books", nil).WithContext(ctx))
+	expectStatus(t, w, http.StatusGatewayTimeout)
+	if body := w.Body.String(); !strings.Contains(body, "timed out") {
+		t.Fatalf("body = %s, want the timeout reported", body)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/books", nil).WithContext(ctx))
+	expectStatus(t, w, 499)
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+func TestCategoryCRUD(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.do(http.MethodPost, "/api/categories", models.Category{Name: "Fiksi"})
+	expectStatus(t, w, http.StatusCreated)
+	created := decodeJSON[models.Category](t, w)
+	if created.ID == 0 || created.Name != "Fiksi" || created.CreatedBy != "tester" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	w = s.do(http.MethodGet, "/api/categories/"+itoa(created.ID), nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := decodeJSON[models.Category](t, w); got.Name != "Fiksi" {
+		t.Fatalf("got %+v", got)
+	}
+
+	w = s.do(http.MethodGet, "/api/categories", nil)
+	expectStatus(t, w, http.StatusOK)
+	if list := decodeJSON[[]models.Category](t, w); len(list) != 1 {
+		t.Fatalf("listed %d categories, want 1", len(list))
+	}
+
+	w = s.do(http.MethodDelete, "/api/categories/"+itoa(created.ID), nil)
+	expectStatus(t, w, http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, "/api/categories/"+itoa(created.ID), nil), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, "/api/categories/"+itoa(created.ID), nil), http.StatusNotFound)
+}
+
+func TestCategoryValidation(t *testing.T) {
+	s := newTestServer(t)
+
+	expectStatus(t, s.do(http.MethodPost, "/api/categories", map[string]string{}), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodGet, "/api/categories/abc", nil), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodDelete, "/api/categories/abc", nil), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodGet, "/api/categories/abc/books", nil), http.StatusBadRequest)
+}
+
+func TestDeleteCategoryWithBooks(t *testing.T) {
+	s := newTestServer(t)
+
+	category := decodeJSON[models.Category](t, s.do(http.MethodPost, "/api/categories", models.Category{Name: "Sains"}))
+	book := decodeJSON[models.Book](t, s.do(http.MethodPost, "/api/books", models.BookRequest{
+		Title: "Kosmos", ReleaseYear: 2001, Price: 100, TotalPage: 300, CategoryID: category.ID,
+	}))
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/categories/"+itoa(category.ID), nil), http.StatusConflict)
+
+	w := s.do(http.MethodGet, "/api/categories/"+itoa(category.ID)+"/books", nil)
+	expectStatus(t, w, http.StatusOK)
+	if books := decodeJSON[[]models.Book](t, w); len(books) != 1 || books[0].ID != book.ID {
+		t.Fatalf("books in category = %+v", books)
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/books/"+itoa(book.ID), nil), http.StatusOK)
+	expectStatus(t, s.do(http.MethodDelete, "/api/categories/"+itoa(category.ID), nil), http.StatusOK)
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	jwtConfig := config.Current.JWT
+	jwtConfig.Secret = "controllers-test-secret"
+	if err := auth.InitKeyring(jwtConfig); err != nil {
+		panic(err)
+	}
+	auth.InitTokens(jwtConfig)
+
+	os.Exit(m.Run())
+}
+
+// testServer - The handlers on in-memory repositories. Protected routes
+// see the request as made by the user in as (a plain user unless a test
+// changes it).
+type testServer struct {
+	repos  *repository.Repositories
+	router *gin.Engine
+	as     gin.H
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	repos := repository.NewMemory()
+	previousEvents := audit.Events
+	audit.Events = repos.SecurityEvents
+	t.Cleanup(func() { audit.Events = previousEvents })
+
+	// The login guard is process-wide; start every test without backoff
+	login.Attempts = login.NewGuard()
+
+	s := &testServer{repos: repos, router: gin.New()}
+	authHandler := NewAuthHandler(repos.Users, repos.TwoFactor, repos.PasswordResets, repos.Sessions)
+	bookHandler := NewBookHandler(repos.Books)
+	categoryHandler := NewCategoryHandler(repos.Categories, repos.Books)
+	adminHandler := NewAdminHandler(repos.Users, repos.SecurityEvents)
+	apiKeyHandler := NewAPIKeyHandler(repos.APIKeys)
+
+	s.router.POST("/api/users/login", authHandler.Login)
+	s.router.POST("/api/users/register", authHandler.Register)
+	s.router.POST("/api/users/login/2fa", authHandler.LoginTwoFactor)
+	s.router.POST("/api/users/password/forgot", authHandler.ForgotPassword)
+	s.router.POST("/api/users/password/reset", authHandler.ResetPassword)
+	s.router.GET("/api/users/oidc/callback", authHandler.OIDCCallback)
+
+	api := s.router.Group("/api", func(c *gin.Context) {
+		for key, value := range s.as {
+			c.Set(key, value)
+		}
+	})
+	api.POST("/users/me/password", authHandler.ChangePassword)
+	api.GET("/users/me/api-keys", apiKeyHandler.GetAPIKeys)
+	api.POST("/users/me/api-keys", apiKeyHandler.CreateAPIKey)
+	api.DELETE("/users/me/api-keys/:id", apiKeyHandler.DeleteAPIKey)
+	api.POST("/users/me/2fa/enroll", authHandler.EnrollTwoFactor)
+	api.POST("/users/me/2fa/confirm", authHandler.ConfirmTwoFactor)
+	api.POST("/users/me/2fa/disable", authHandler.DisableTwoFactor)
+	api.GET("/users/me/sessions", authHandler.GetSessions)
+	api.DELETE("/users/me/sessions/:id", authHandler.DeleteSession)
+	api.POST("/users/logout", authHandler.Logout)
+	api.POST("/admin/users/:id/unlock", adminHandler.UnlockUser)
+	api.GET("/admin/security-events", adminHandler.GetSecurityEvents)
+	api.GET("/admin/log-level", GetLogLevel)
+	api.PUT("/admin/log-level", SetLogLevel)
+	api.GET("/categories", categoryHandler.GetCategories)
+	api.POST("/categories", categoryHandler.CreateCategory)
+	api.GET("/categories/:id", categoryHandler.GetCategoryByID)
+	api.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+	api.GET("/categories/:id/books", categoryHandler.GetBooksByCategory)
+	api.GET("/books", bookHandler.GetBooks)
+	api.POST("/books", bookHandler.CreateBook)
+	api.GET("/books/:id", bookHandler.GetBookByID)
+	api.PUT("/books/:id", bookHandler.UpdateBook)
+	api.DELETE("/books/:id", bookHandler.DeleteBook)
+
+	s.as = gin.H{"username": "tester", "user_id": 1, "role": "user", "auth_method": "jwt"}
+	return s
+}
+
+// do - Send a request with body (JSON encoded unless nil) and return the response
+func (s *testServer) do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// expectStatus - Fail unless the response has the given status
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d (body %s)", w.Code, status, w.Body.String())
+	}
+}
+
+// decodeJSON - The response body decoded into a T
+func decodeJSON[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return v
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"net/http"
+)
+
+// dbError - Respond to a failed query: 409/422 for constraint violations,
+// 504 when it ran past the request deadline, nothing useful when the
+// client already went away (499, as nginx logs it), otherwise 500 with
+// message. message goes to the client and must not carry the driver
+// error, which names tables, columns and constraints; the error (or the
+// violated constraint) is logged with the request ID.
+func dbError(c *gin.Context, err error, message string) {
+	switch {
+	case database.IsUniqueViolation(err):
+		constraintViolation(c, err)
+		c.JSON(http.StatusConflict, gin.H{"error": "A record with the same value already exists"})
+	case database.IsForeignKeyViolation(err):
+		constraintViolation(c, err)
+		c.JSON(http.StatusConflict, gin.H{"error": "The request conflicts with related records"})
+	case database.IsCheckViolation(err):
+		constraintViolation(c, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "A value is outside the allowed range"})
+	case database.IsTimeout(err):
+		slog.ErrorContext(c.Request.Context(), "Database query timed out", "error", err)
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Database query timed out"})
+	case database.IsCanceled(err):
+		c.AbortWithStatus(499)
+	default:
+		slog.ErrorContext(c.Request.Context(), "Database query failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// constraintViolation - Log which constraint err violated
+func constraintViolation(c *gin.Context, err error) {
+	slog.InfoContext(c.Request.Context(), "Constraint violation", "constraint", database.ConstraintName(err))
+}
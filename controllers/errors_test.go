@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestDBError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err    error
+		status int
+	}{
+		"unique":      {&pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "users_username_key"`, Constraint: "users_username_key"}, http.StatusConflict},
+		"foreign key": {&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`books_db`.`books`, CONSTRAINT `books_ibfk_1`)"}, http.StatusConflict},
+		"check":       {&pq.Error{Code: "23514", Message: `new row for relation "books" violates check constraint "chk_release_year"`, Constraint: "chk_release_year"}, http.StatusUnprocessableEntity},
+		"timeout":     {context.DeadlineExceeded, http.StatusGatewayTimeout},
+		"canceled":    {context.Canceled, 499},
+		"other":       {errors.New(`pq: relation "books" does not exist`), http.StatusInternalServerError},
+	} {
+		router := gin.New()
+		router.GET("/", func(c *gin.Context) { dbError(c, tc.err, "Failed to create book") })
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if w.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, tc.status)
+			continue
+		}
+		body := w.Body.String()
+		if strings.Contains(body, "books\"") || strings.Contains(body, "relation") || strings.Contains(body, "books_db") {
+			t.Errorf("%s: body %s carries the driver error", name, body)
+		}
+		// Schema names stay out of the response
+		if strings.Contains(body, "constraint") || strings.Contains(body, "_key") || strings.Contains(body, "ibfk") || strings.Contains(body, "chk_") {
+			t.Errorf("%s: body %s names the constraint", name, body)
+		}
+		if tc.status == http.StatusInternalServerError && !strings.Contains(body, "Failed to create book") {
+			t.Errorf("%s: body = %s, want the message", name, body)
+		}
+		if tc.status == 499 && body != "" {
+			t.Errorf("%s: body = %s, want none", name, body)
+		}
+	}
+}
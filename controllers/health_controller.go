@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/lifecycle"
+)
+
+// Livez - Liveness probe: the process is up and serving HTTP. It does not
+// look at the database, so an outage does not get the instance restarted.
+func Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz - Readiness probe: 200 only while the server is not shutting down,
+// the database answers within HEALTH_CHECK_TIMEOUT and every migration is
+// applied. Pool saturation and replica health are reported but do not fail
+// the check; taking a busy instance out of rotation only moves its load.
+func Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), config.Current.Server.HealthCheckTimeout)
+	defer cancel()
+
+	state := lifecycle.Current()
+	dbCheck := checkDatabase(ctx)
+	migrationCheck := checkMigrations(ctx)
+
+	ready := state == lifecycle.Ready && dbCheck["status"] == "ok" && migrationCheck["status"] == "ok"
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+
+	replicas := []database.ReplicaStatus{}
+	if database.Replicas != nil {
+		replicas = database.Replicas.Status()
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": gin.H{
+			"lifecycle":  gin.H{"status": state.String()},
+			"database":   dbCheck,
+			"migrations": migrationCheck,
+			"pool":       poolUsage(),
+		},
+		"replicas": replicas,
+	})
+}
+
+// Health - Short form of Readyz for existing monitors
+func Health(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), config.Current.Server.HealthCheckTimeout)
+	defer cancel()
+
+	if state := lifecycle.Current(); state != lifecycle.Ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": state.String()})
+		return
+	}
+	if check := checkDatabase(ctx); check["status"] != "ok" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":   "unavailable",
+			"database": "unreachable",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "OK",
+		"database": "connected",
+	})
+}
+
+// Version - Build information of the running binary
+func Version(c *gin.Context) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"version": "unknown"})
+		return
+	}
+
+	version := gin.H{
+		"module":     info.Main.Path,
+		"version":    info.Main.Version,
+		"go_version": info.GoVersion,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version["commit"] = setting.Value
+		case "vcs.time":
+			version["commit_time"] = setting.Value
+		case "vcs.modified":
+			version["dirty"] = setting.Value == "true"
+		}
+	}
+	c.JSON(http.StatusOK, version)
+}
+
+// checkDatabase - Ping the primary
+func checkDatabase(ctx context.Context) gin.H {
+	start := time.Now()
+	if err := database.DB.PingContext(ctx); err != nil {
+		return failedCheck(ctx, "database", err)
+	}
+	return gin.H{"status": "ok", "latency_ms": time.Since(start).Milliseconds()}
+}
+
+// checkMigrations - Whether the schema is up to date with this binary
+func checkMigrations(ctx context.Context) gin.H {
+	pending, err := database.PendingMigrations(ctx)
+	if err != nil {
+		return failedCheck(ctx, "migrations", err)
+	}
+	if len(pending) > 0 {
+		return gin.H{"status": "pending", "pending": pending}
+	}
+	return gin.H{"status": "ok"}
+}
+
+// failedCheck - The probes are unauthenticated, so the details (hosts,
+// driver messages) only go to the log
+func failedCheck(ctx context.Context, name string, err error) gin.H {
+	slog.WarnContext(ctx, "Readiness check failed", "check", name, "error", err)
+	reason := "unavailable"
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = "timeout"
+	}
+	return gin.H{"status": "error", "error": reason}
+}
+
+// poolUsage - How much of the primary pool is in use. Saturation is in_use
+// over DB_MAX_OPEN_CONNS (absent when the pool is unlimited); a growing
+// wait_count means requests queue for a connection.
+func poolUsage() gin.H {
+	stats := database.DB.Stats()
+	usage := gin.H{
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+	}
+	if stats.MaxOpenConnections > 0 {
+		usage["saturation"] = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	}
+	return usage
+}
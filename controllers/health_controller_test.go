@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+	"mini-project-buku-sb-go-73-Agil/lifecycle"
+)
+
+// probe - Answer of the health endpoint at path while the process is in state
+func probe(t *testing.T, state lifecycle.State, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	lifecycle.Set(state)
+	t.Cleanup(func() { lifecycle.Set(lifecycle.Starting) })
+
+	router := gin.New()
+	router.GET("/livez", Livez)
+	router.GET("/readyz", Readyz)
+	router.GET("/health", Health)
+	router.GET("/version", Version)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+// readiness - The parts of the Readyz answer the tests look at
+type readiness struct {
+	Status string `json:"status"`
+	Checks struct {
+		Lifecycle  map[string]interface{} `json:"lifecycle"`
+		Database   map[string]interface{} `json:"database"`
+		Migrations map[string]interface{} `json:"migrations"`
+		Pool       map[string]interface{} `json:"pool"`
+	} `json:"checks"`
+	Replicas []database.ReplicaStatus `json:"replicas"`
+}
+
+func TestReadyz(t *testing.T) {
+	dbtest.Open(t, "sqlite")
+
+	w := probe(t, lifecycle.Ready, "/readyz")
+	expectStatus(t, w, http.StatusOK)
+	ready := decodeJSON[readiness](t, w)
+	if ready.Status != "ready" || ready.Checks.Database["status"] != "ok" || ready.Checks.Migrations["status"] != "ok" {
+		t.Fatalf("readyz = %+v, want every check ok", ready)
+	}
+	if ready.Checks.Pool["max_open_connections"] != float64(1) || ready.Replicas == nil {
+		t.Fatalf("readyz = %+v, want the pool usage and an empty replica list", ready)
+	}
+
+	w = probe(t, lifecycle.Draining, "/readyz")
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	if ready := decodeJSON[readiness](t, w); ready.Checks.Lifecycle["status"] != "shutting_down" {
+		t.Fatalf("readyz while draining = %+v", ready)
+	}
+
+	if err := database.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	w = probe(t, lifecycle.Ready, "/readyz")
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	if ready := decodeJSON[readiness](t, w); ready.Checks.Migrations["status"] != "pending" {
+		t.Fatalf("readyz with a pending migration = %+v", ready)
+	}
+}
+
+func TestProbesWithoutDatabase(t *testing.T) {
+	dbtest.Open(t, "sqlite")
+	database.DB.Close()
+
+	expectStatus(t, probe(t, lifecycle.Ready, "/livez"), http.StatusOK)
+
+	w := probe(t, lifecycle.Ready, "/readyz")
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	if ready := decodeJSON[readiness](t, w); ready.Checks.Database["error"] != "unavailable" {
+		t.Fatalf("readyz = %+v, want the database unavailable", ready)
+	}
+	if body := w.Body.String(); strings.Contains(body, "closed") {
+		t.Fatalf("readyz leaks the driver error: %s", body)
+	}
+
+	w = probe(t, lifecycle.Ready, "/health")
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	if body := w.Body.String(); !strings.Contains(body, `"database":"unreachable"`) {
+		t.Fatalf("health = %s, want the database unreachable", body)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	dbtest.Open(t, "sqlite")
+
+	w := probe(t, lifecycle.Ready, "/health")
+	expectStatus(t, w, http.StatusOK)
+	if body := w.Body.String(); !strings.Contains(body, `"database":"connected"`) {
+		t.Fatalf("health = %s", body)
+	}
+
+	w = probe(t, lifecycle.Starting, "/health")
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	if body := w.Body.String(); !strings.Contains(body, `"status":"starting"`) {
+		t.Fatalf("health while starting = %s", body)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	w := probe(t, lifecycle.Ready, "/version")
+	expectStatus(t, w, http.StatusOK)
+	if version := decodeJSON[map[string]interface{}](t, w); version["version"] == nil {
+		t.Fatalf("version = %v, want a version", version)
+	}
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/oidc"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// OIDC - External identity provider (nil when OIDC login is disabled, set from main)
+var OIDC *oidc.Provider
+
+const oidcFlowCookie = "oidc_flow"
+
+var invalidUsernameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// OIDCLogin - Redirect the browser to the identity provider
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := oidc.NewVerifier()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := OIDC.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "OIDC login failed", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	mode := "token"
+	if wantsCookieSession(c) {
+		mode = "cookie"
+	}
+
+	// The flow secrets stay in the browser, bound to this login attempt
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, state+"."+nonce+"."+verifier+"."+mode, 600, "/api/users/oidc", "", isSecureRequest(c), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback - Complete the authorization code flow and issue an API token
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+
+	flow, _ := c.Cookie(oidcFlowCookie)
+	c.SetCookie(oidcFlowCookie, "", -1, "/api/users/oidc", "", isSecureRequest(c), true)
+
+	parts := strings.Split(flow, ".")
+	state := c.Query("state")
+	if len(parts) != 4 || state == "" || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was rejected by the identity provider: " + providerErr})
+		return
+	}
+
+	claims, err := OIDC.Exchange(c.Request.Context(), c.Query("code"), parts[2], parts[1])
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "OIDC callback failed", "error", err)
+		audit.Record(c, audit.EventLogin, audit.Failure, audit.Event{Details: "oidc exchange failed"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider login failed"})
+		return
+	}
+
+	user, err := h.findOrCreateOIDCUser(c.Request.Context(), claims)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "OIDC user mapping failed", "error", err)
+		dbError(c, err, "Failed to map identity to a user")
+		return
+	}
+
+	c.Set("session_mode", parts[3])
+	h.continueLogin(c, user, "oidc")
+}
+
+// findOrCreateOIDCUser - Map issuer + subject to a users row, creating
+// the user on first login
+func (h *AuthHandler) findOrCreateOIDCUser(ctx context.Context, claims *oidc.IDClaims) (models.User, error) {
+	user, err := h.users.GetByIdentity(ctx, claims.Issuer, claims.Subject)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return user, err
+	}
+
+	// Local password login is not possible for SSO users until they reset it
+	randomPassword := make([]byte, 32)
+	if _, err := rand.Read(randomPassword); err != nil {
+		return user, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(randomPassword)), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+
+	base := oidcUsername(claims)
+	for attempt := 0; attempt < 5; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix := make([]byte, 2)
+			rand.Read(suffix)
+			username = fmt.Sprintf("%s-%s", base, hex.EncodeToString(suffix))
+		}
+
+		user = models.User{Username: username, Password: string(hashedPassword), Email: email, CreatedBy: "oidc"}
+		err = h.users.CreateWithIdentity(ctx, &user, claims.Issuer, claims.Subject)
+		if !errors.Is(err, repository.ErrDuplicate) {
+			user.Password = ""
+			return user, err
+		}
+
+		// Another request may have linked this identity concurrently
+		user, err = h.users.GetByIdentity(ctx, claims.Issuer, claims.Subject)
+		if !errors.Is(err, repository.ErrNotFound) {
+			return user, err
+		}
+	}
+	return user, fmt.Errorf("could not find a free username for %q", base)
+}
+
+// oidcUsername - Derive a valid local username from the provider claims
+func oidcUsername(claims *oidc.IDClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+	candidate = invalidUsernameChars.ReplaceAllString(strings.ToLower(candidate), "-")
+	candidate = strings.TrimLeft(candidate, "._-")
+	if len(candidate) > 24 {
+		candidate = candidate[:24]
+	}
+	if auth.ValidateUsername(candidate) != nil {
+		candidate = "sso-user"
+	}
+	return candidate
+}
+
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
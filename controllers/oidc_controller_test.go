@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/oidc"
+)
+
+// fakeIdP - Identity provider that signs in subject for every code
+type fakeIdP struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	subject string
+	nonce   string
+}
+
+// newFakeIdP - Start the provider and make it the one controllers.OIDC uses
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   encode(key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, oidc.IDClaims{
+			Nonce:             idp.nonce,
+			PreferredUsername: idp.subject,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    idp.server.URL,
+				Subject:   idp.subject,
+				Audience:  jwt.ClaimStrings{"books-api"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	previous := OIDC
+	OIDC = oidc.New(config.OIDC{IssuerURL: idp.server.URL, ClientID: "books-api", RedirectURL: "http://localhost/api/users/oidc/callback"})
+	t.Cleanup(func() { OIDC = previous })
+	return idp
+}
+
+// oidcCallback - Return to the API from the provider as subject
+func (s *testServer) oidcCallback(idp *fakeIdP, subject string) *httptest.ResponseRecorder {
+	idp.subject, idp.nonce = subject, "nonce-"+subject
+	req := httptest.NewRequest(http.MethodGet, "/api/users/oidc/callback?state=state&code=code", nil)
+	req.AddCookie(&http.Cookie{Name: oidcFlowCookie, Value: "state." + idp.nonce + ".verifier.token"})
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// linkUser - Store user linked to subject at idp
+func (s *testServer) linkUser(t *testing.T, idp *fakeIdP, subject string, user models.User) models.User {
+	t.Helper()
+	user.Password, user.CreatedBy = "x", "test"
+	if err := s.repos.Users.CreateWithIdentity(context.Background(), &user, idp.server.URL, subject); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	s := newTestServer(t)
+	idp := newFakeIdP(t)
+
+	w := s.oidcCallback(idp, "alice")
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.LoginResponse](t, w); resp.Token == "" {
+		t.Fatal("no token for a new OIDC user")
+	}
+	user, err := s.repos.Users.GetByIdentity(context.Background(), idp.server.URL, "alice")
+	if err != nil || user.Username != "alice" {
+		t.Fatalf("linked user = %+v, %v", user, err)
+	}
+
+	// Wrong state
+	req := httptest.NewRequest(http.MethodGet, "/api/users/oidc/callback?state=other&code=code", nil)
+	req.AddCookie(&http.Cookie{Name: oidcFlowCookie, Value: "state.nonce.verifier.token"})
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestOIDCCallbackFollowsLoginSteps(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	idp := newFakeIdP(t)
+
+	// Locked accounts are refused like on password login
+	locked := s.linkUser(t, idp, "locked", models.User{Username: "locked", Role: "user"})
+	if err := s.repos.Users.RecordFailedLogin(ctx, locked.ID, 1, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.oidcCallback(idp, "locked"), http.StatusTooManyRequests)
+
+	// TOTP still has to be entered
+	totp := s.linkUser(t, idp, "totp", models.User{Username: "totp", Role: "user"})
+	if err := s.repos.TwoFactor.SetPendingSecret(ctx, totp.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repos.TwoFactor.Enable(ctx, totp.ID, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := s.oidcCallback(idp, "totp")
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.MFAChallengeResponse](t, w); !resp.MFARequired || resp.MFAToken == "" {
+		t.Fatalf("TOTP user got %s, want an MFA challenge", w.Body.String())
+	}
+
+	// A pending password change comes first
+	s.linkUser(t, idp, "pending", models.User{Username: "pending", Role: "user", MustChangePassword: true})
+	w = s.oidcCallback(idp, "pending")
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.PasswordChangeResponse](t, w); !resp.PasswordChangeRequired {
+		t.Fatalf("user who must change the password got %s", w.Body.String())
+	}
+
+	// Admins enroll first when 2FA is mandatory for them
+	previous := config.Current.Auth.RequireAdmin2FA
+	config.Current.Auth.RequireAdmin2FA = true
+	t.Cleanup(func() { config.Current.Auth.RequireAdmin2FA = previous })
+	s.linkUser(t, idp, "admin", models.User{Username: "boss", Role: "admin"})
+	w = s.oidcCallback(idp, "admin")
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.MFAChallengeResponse](t, w); !resp.EnrollmentRequired {
+		t.Fatalf("admin got %s, want an enrollment challenge", w.Body.String())
+	}
+}
@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/mailer"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Mailer - Delivery channel for password reset emails (set from main)
+var Mailer mailer.Mailer = &mailer.LogMailer{}
+
+// background - Work handlers start that outlives their request
+var background sync.WaitGroup
+
+// WaitBackground - Wait until work started in the background by handlers
+// (password reset mails) has finished, or until ctx is done
+func WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// Finished work wins over an expired deadline
+		select {
+		case <-done:
+			return nil
+		case <-time.After(10 * time.Millisecond):
+			return ctx.Err()
+		}
+	}
+}
+
+// ForgotPassword - Request a password reset token. Requests go through
+// the login backoff per username and per client IP (on keys of their own),
+// so nobody can flood an inbox or the mail server.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userKey, ipKey := "reset:"+login.UserKey(req.Username), "reset:"+login.IPKey(c.ClientIP())
+	if wait := login.Attempts.RetryAfter(userKey, ipKey); wait > 0 {
+		audit.Record(c, audit.EventPasswordReset, audit.Denied, audit.Event{Username: req.Username, Details: "reset requests throttled"})
+		login.TooManyAttempts(c, wait)
+		return
+	}
+	settings := login.CurrentSettings()
+	login.Attempts.Fail(userKey, settings.UserFreeAttempts)
+	login.Attempts.Fail(ipKey, settings.IPFreeAttempts)
+
+	// Issue the token in the background so the response (and its timing)
+	// is the same whether or not the username exists. It outlives the
+	// request, so it gets its own deadline; it keeps the request ID.
+	ctx := context.WithoutCancel(c.Request.Context())
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		ctx, cancel := database.WithQueryTimeout(ctx, "auth")
+		defer cancel()
+		h.issuePasswordReset(ctx, req.Username)
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset link has been sent"})
+}
+
+// ResetPassword - Set a new password using a reset token
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tokenHash := hashResetToken(req.Token)
+	invalidToken := func() {
+		audit.Record(c, audit.EventPasswordReset, audit.Failure, audit.Event{Details: "invalid or expired token"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+	}
+
+	// The password policy needs the username, which only the token knows
+	userID, err := h.resets.Lookup(ctx, tokenHash)
+	var user models.User
+	if err == nil {
+		user, err = h.users.GetByID(ctx, userID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		invalidToken()
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Failed to reset password")
+		return
+	}
+	if err := auth.ValidatePassword(req.Password, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Consume the token, set the password and invalidate the user's other
+	// tokens together, so a token can only be used once
+	userID, err = h.resets.Reset(ctx, tokenHash, string(hashedPassword))
+	if errors.Is(err, repository.ErrNotFound) {
+		invalidToken()
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Failed to reset password")
+		return
+	}
+	login.Credentials.ForgetUser(userID)
+
+	audit.Record(c, audit.EventPasswordReset, audit.Success, audit.Event{UserID: userID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully"})
+}
+
+// ChangePassword - Replace the current user's password, which ends all
+// of the account's logins. Also accepts the restricted token login hands
+// out while a password change is required; either way the user logs in
+// again with the new password.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	if !requireInteractiveLogin(c) {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.users.GetCredentials(ctx, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)) != nil {
+		audit.Record(c, audit.EventPasswordChanged, audit.Failure, audit.Event{UserID: user.ID, Username: user.Username, Details: "invalid current password"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current one"})
+		return
+	}
+	if err := auth.ValidatePassword(req.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = h.users.SetPassword(ctx, user.ID, string(hashedPassword), user.Username)
+	if err != nil {
+		dbError(c, err, "Failed to change password")
+		return
+	}
+	login.Credentials.ForgetUser(user.ID)
+	// The new password ended every login, this one included
+	if c.GetString("auth_method") == "session" {
+		clearSessionCookies(c)
+	}
+
+	audit.Record(c, audit.EventPasswordChanged, audit.Success, audit.Event{UserID: user.ID, Username: user.Username})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, log in again with the new password"})
+}
+
+// issuePasswordChange - Respond with a short-lived token that can only
+// change the password (the account must choose a new one first)
+func issuePasswordChange(c *gin.Context, user models.User) {
+	token, err := auth.Tokens.IssuePurpose(user.ID, user.Username, user.Role, auth.PurposePasswordChange, config.Current.Auth.PasswordChangeTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	audit.Record(c, audit.EventLogin, audit.Denied, audit.Event{UserID: user.ID, Username: user.Username, Details: "password change required"})
+	c.JSON(http.StatusOK, models.PasswordChangeResponse{PasswordChangeRequired: true, PasswordChangeToken: token, RecoveryCodes: c.GetStringSlice("recovery_codes")})
+}
+
+func (h *AuthHandler) issuePasswordReset(ctx context.Context, username string) {
+	user, err := h.users.GetByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(ctx, "Password reset lookup failed", "error", err)
+		}
+		return
+	}
+	if user.Email == "" {
+		slog.InfoContext(ctx, "Password reset requested for a user without an email address", "user_id", user.ID)
+		return
+	}
+
+	active, err := h.resets.CountActive(ctx, user.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count password reset tokens", "error", err)
+		return
+	}
+	if active >= config.Current.Auth.PasswordResetMaxTokens {
+		slog.InfoContext(ctx, "Password reset skipped, the user has the maximum of unused tokens", "user_id", user.ID)
+		return
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate password reset token", "error", err)
+		return
+	}
+
+	ttl := config.Current.Auth.PasswordResetTTL
+	if err := h.resets.Create(ctx, user.ID, hashResetToken(token), ttl); err != nil {
+		slog.ErrorContext(ctx, "Failed to store password reset token", "error", err)
+		return
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nUse this token to reset your password: %s\n", username, token)
+	if link, err := resetLink(config.Current.Auth.PasswordResetURL, token); err != nil {
+		slog.ErrorContext(ctx, "Invalid PASSWORD_RESET_URL, sending the token only", "error", err)
+	} else if link != "" {
+		body += fmt.Sprintf("\nOr open: %s\n", link)
+	}
+	body += fmt.Sprintf("\nThe token expires in %s. If you did not request this, ignore this email.\n", ttl)
+
+	err = Mailer.Send(mailer.Message{To: user.Email, Subject: "Password reset", Body: body})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to send password reset email", "error", err)
+	}
+}
+
+// resetLink - PASSWORD_RESET_URL with the token added to its query, or ""
+// when no URL is configured
+func resetLink(resetURL, token string) (string, error) {
+	if resetURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(resetURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func generateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
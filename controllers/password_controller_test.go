@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/mailer"
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+// recordingMailer - Keeps the messages instead of sending them
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *recordingMailer) sent() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.messages...)
+}
+
+// withMailer - Deliver the password reset mails of the test to a recordingMailer
+func withMailer(t *testing.T) *recordingMailer {
+	t.Helper()
+	mail := &recordingMailer{}
+	previous := Mailer
+	Mailer = mail
+	t.Cleanup(func() { Mailer = previous })
+	return mail
+}
+
+var resetTokenPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// requestReset - Ask for a reset of username and wait until the mail is out
+func (s *testServer) requestReset(t *testing.T, username string) {
+	t.Helper()
+	w := s.do(http.MethodPost, "/api/users/password/forgot", models.ForgotPasswordRequest{Username: username})
+	expectStatus(t, w, http.StatusOK)
+	if err := WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	mail := withMailer(t)
+	s := newTestServer(t)
+	s.createUser(t, "budi", "old password")
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	withEmail := models.User{Username: "sari", Password: string(hash), Email: "sari@example.com", Role: "user", MustChangePassword: true, CreatedBy: "test"}
+	if err := s.repos.Users.Create(context.Background(), &withEmail); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown users and users without an address get the same answer, and no mail
+	s.requestReset(t, "nobody")
+	s.requestReset(t, "budi")
+	if sent := mail.sent(); len(sent) != 0 {
+		t.Fatalf("mails = %+v, want none", sent)
+	}
+
+	s.requestReset(t, "sari")
+	sent := mail.sent()
+	if len(sent) != 1 || sent[0].To != "sari@example.com" {
+		t.Fatalf("mails = %+v, want one to sari", sent)
+	}
+	token := resetTokenPattern.FindString(sent[0].Body)
+	if token == "" {
+		t.Fatalf("no token in %q", sent[0].Body)
+	}
+
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/reset", models.ResetPasswordRequest{Token: token, Password: "short"}), http.StatusBadRequest)
+	wrong := "0" + token[1:]
+	if wrong == token {
+		wrong = "1" + token[1:]
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/reset", models.ResetPasswordRequest{Token: wrong, Password: "new password"}), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/reset", models.ResetPasswordRequest{Token: token, Password: "new password"}), http.StatusOK)
+
+	// The token works once and the reset also settles a pending password change
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/reset", models.ResetPasswordRequest{Token: token, Password: "other password"}), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "sari", Password: "old password"}), http.StatusUnauthorized)
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "sari", Password: "new password"})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.LoginResponse](t, w); resp.Token == "" {
+		t.Fatalf("login after reset = %s, want a token", w.Body.String())
+	}
+}
+
+func TestResetPasswordPolicy(t *testing.T) {
+	mail := withMailer(t)
+	s := newTestServer(t)
+	previousAuth := config.Current.Auth
+	config.Current.Auth.PasswordResetURL = "https://books.example/reset?lang=id"
+	t.Cleanup(func() { config.Current.Auth = previousAuth })
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	user := models.User{Username: "kartini21", Password: string(hash), Email: "kartini@example.com", Role: "user", CreatedBy: "test"}
+	if err := s.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	s.requestReset(t, "kartini21")
+	sent := mail.sent()
+	if len(sent) != 1 {
+		t.Fatalf("mails = %+v, want one", sent)
+	}
+	token := resetTokenPattern.FindString(sent[0].Body)
+	if link := "https://books.example/reset?lang=id&token=" + token; !strings.Contains(sent[0].Body, link) {
+		t.Fatalf("mail body %q, want the link %s", sent[0].Body, link)
+	}
+
+	// The policy knows whose password it is
+	w := s.do(http.MethodPost, "/api/users/password/reset", models.ResetPasswordRequest{Token: token, Password: "Kartini21"})
+	expectStatus(t, w, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), "username") {
+		t.Fatalf("body = %s, want the username rule", w.Body.String())
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/reset", models.ResetPasswordRequest{Token: token, Password: "new password"}), http.StatusOK)
+}
+
+func TestResetLink(t *testing.T) {
+	if link, err := resetLink("", "abc"); err != nil || link != "" {
+		t.Fatalf("without a URL = %q, %v", link, err)
+	}
+	if link, err := resetLink("https://books.example/reset#form", "a&b"); err != nil || link != "https://books.example/reset?token=a%26b#form" {
+		t.Fatalf("link = %q, %v", link, err)
+	}
+	if _, err := resetLink("https://books.example/%zz", "abc"); err == nil {
+		t.Fatal("invalid URL accepted")
+	}
+}
+
+func TestForgotPasswordThrottled(t *testing.T) {
+	mail := withMailer(t)
+	s := newTestServer(t)
+	withLoginSettings(t, config.Login{
+		BackoffFreeAttempts: 2,
+		IPFreeAttempts:      3,
+		BackoffBase:         time.Minute,
+		BackoffMax:          time.Hour,
+		AttemptWindow:       time.Hour,
+	})
+	previousAuth := config.Current.Auth
+	config.Current.Auth.PasswordResetMaxTokens = 2
+	t.Cleanup(func() { config.Current.Auth = previousAuth })
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	user := models.User{Username: "sari", Password: string(hash), Email: "sari@example.com", Role: "user", CreatedBy: "test"}
+	if err := s.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests beyond the outstanding token limit send nothing
+	for i := 0; i < 3; i++ {
+		s.requestReset(t, "sari")
+	}
+	if sent := mail.sent(); len(sent) != 2 {
+		t.Fatalf("mails = %d, want 2 (the token limit)", len(sent))
+	}
+
+	// Then the username backs off, and the client IP soon after
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/forgot", models.ForgotPasswordRequest{Username: "sari"}), http.StatusTooManyRequests)
+	s.requestReset(t, "nobody")
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/forgot", models.ForgotPasswordRequest{Username: "other"}), http.StatusTooManyRequests)
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "old password")
+	s.as["user_id"] = user.ID
+	s.as["username"] = user.Username
+
+	change := func(current, next string) int {
+		return s.do(http.MethodPost, "/api/users/me/password", models.ChangePasswordRequest{CurrentPassword: current, NewPassword: next}).Code
+	}
+	for _, tt := range []struct {
+		name          string
+		current, next string
+		want          int
+	}{
+		{"wrong current password", "wrong", "new password", http.StatusUnauthorized},
+		{"unchanged", "old password", "old password", http.StatusBadRequest},
+		{"too short", "old password", "short", http.StatusBadRequest},
+	} {
+		if got := change(tt.current, tt.next); got != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// API keys cannot change the password of their owner
+	s.as["auth_method"] = "api_key"
+	if got := change("old password", "new password"); got != http.StatusForbidden {
+		t.Fatalf("with an API key: status = %d, want 403", got)
+	}
+	s.as["auth_method"] = "jwt"
+
+	s.as["token_purpose"] = auth.PurposePasswordChange
+	w := s.do(http.MethodPost, "/api/users/me/password", models.ChangePasswordRequest{CurrentPassword: "old password", NewPassword: "new password"})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[map[string]string](t, w); resp["message"] != "Password changed, log in again with the new password" {
+		t.Fatalf("message = %q", resp["message"])
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "new password"}), http.StatusOK)
+}
+
+func TestLoginRequiresPasswordChange(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("first password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := models.User{Username: "admin", Password: string(hash), Role: "admin", MustChangePassword: true, CreatedBy: "system"}
+	if err := s.repos.Users.Create(ctx, &admin); err != nil {
+		t.Fatal(err)
+	}
+
+	// No token for the API, only one for changing the password
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "admin", Password: "first password"})
+	expectStatus(t, w, http.StatusOK)
+	resp := decodeJSON[map[string]interface{}](t, w)
+	if resp["password_change_required"] != true || resp["token"] != nil {
+		t.Fatalf("login response = %v, want a password change instead of a token", resp)
+	}
+	claims, err := auth.Tokens.Parse(resp["password_change_token"].(string))
+	if err != nil || claims.Purpose != auth.PurposePasswordChange || claims.UserID != admin.ID {
+		t.Fatalf("password change token = %+v, %v", claims, err)
+	}
+
+	s.as = gin.H{"username": "admin", "user_id": admin.ID, "role": "admin", "auth_method": "jwt", "token_purpose": claims.Purpose}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/password", models.ChangePasswordRequest{CurrentPassword: "first password", NewPassword: "second password"}), http.StatusOK)
+
+	user, err := s.repos.Users.GetByID(ctx, admin.ID)
+	if err != nil || user.MustChangePassword {
+		t.Fatalf("user = %+v, %v; want the password change done", user, err)
+	}
+	w = s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "admin", Password: "second password"})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.LoginResponse](t, w); resp.Token == "" {
+		t.Fatal("login after the change returned no token")
+	}
+}
+
+// blockingMailer - Holds every mail until release is closed
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(msg mailer.Message) error {
+	<-m.release
+	return nil
+}
+
+func TestWaitBackground(t *testing.T) {
+	mail := &blockingMailer{release: make(chan struct{})}
+	previous := Mailer
+	Mailer = mail
+	t.Cleanup(func() { Mailer = previous })
+
+	s := newTestServer(t)
+	user := models.User{Username: "sari", Password: "x", Email: "sari@example.com", Role: "user", CreatedBy: "test"}
+	if err := s.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/password/forgot", models.ForgotPasswordRequest{Username: "sari"}), http.StatusOK)
+
+	// The mail is still being sent
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitBackground(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("WaitBackground = %v, want the deadline exceeded", err)
+	}
+
+	close(mail.release)
+	if err := WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
+	"strconv"
+)
+
+// GetSessions - List the current user's active browser sessions
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	currentSession, _ := c.Get("session_id")
+
+	sessions, err := h.sessions.ListActive(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = currentSession == sessions[i].ID
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// DeleteSession - Revoke one of the current user's sessions
+func (h *AuthHandler) DeleteSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	err = h.sessions.Revoke(c.Request.Context(), id, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	audit.Record(c, audit.EventSessionRevoked, audit.Success, audit.Event{Details: "session_id=" + c.Param("id")})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// Logout - End the current browser session (Bearer tokens simply expire)
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if sessionID, ok := c.Get("session_id"); ok {
+		id, _ := sessionID.(int)
+		if err := h.sessions.Revoke(c.Request.Context(), id, currentUserID(c)); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Failed to revoke session at logout", "session_id", id, "error", err)
+		}
+		clearSessionCookies(c)
+	}
+	audit.Record(c, audit.EventLogout, audit.Success, audit.Event{Details: "method=" + c.GetString("auth_method")})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// wantsCookieSession - Clients opt into cookie sessions with ?session=cookie
+// or the X-Session-Mode: cookie header
+func wantsCookieSession(c *gin.Context) bool {
+	return c.Query("session") == "cookie" || c.GetHeader("X-Session-Mode") == "cookie" || c.GetString("session_mode") == "cookie"
+}
+
+// startSession - Create a session row and set the session and CSRF cookies
+func (h *AuthHandler) startSession(c *gin.Context, user models.User) {
+	settings := auth.LoadSessionSettings()
+
+	sessionToken, err := auth.GenerateSessionToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	csrfToken, err := auth.GenerateSessionToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	session := models.Session{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(), CSRFToken: csrfToken}
+	err = h.sessions.Create(c.Request.Context(), user.ID, &session, auth.HashSessionToken(sessionToken), settings.TTL)
+	if err != nil {
+		dbError(c, err, "Failed to create session")
+		return
+	}
+
+	maxAge := int(settings.TTL.Seconds())
+	c.SetSameSite(settings.SameSite)
+	c.SetCookie(auth.SessionCookie, sessionToken, maxAge, "/", settings.Domain, settings.Secure, true)
+	// Readable by the frontend so it can echo it in the X-CSRF-Token header
+	c.SetCookie(auth.CSRFCookie, csrfToken, maxAge, "/", settings.Domain, settings.Secure, false)
+
+	c.JSON(http.StatusOK, models.SessionResponse{
+		Message:       "Logged in successfully",
+		CSRFToken:     csrfToken,
+		ExpiresAt:     session.ExpiresAt,
+		RecoveryCodes: c.GetStringSlice("recovery_codes"),
+	})
+}
+
+func clearSessionCookies(c *gin.Context) {
+	settings := auth.LoadSessionSettings()
+	c.SetSameSite(settings.SameSite)
+	c.SetCookie(auth.SessionCookie, "", -1, "/", settings.Domain, settings.Secure, true)
+	c.SetCookie(auth.CSRFCookie, "", -1, "/", settings.Domain, settings.Secure, false)
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+// cookieLogin - Log in as username asking for a cookie session
+func (s *testServer) cookieLogin(t *testing.T, username, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := s.do(http.MethodPost, "/api/users/login?session=cookie", models.LoginRequest{Username: username, Password: password})
+	expectStatus(t, w, http.StatusOK)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestCookieSessionLogin(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+
+	w := s.cookieLogin(t, "budi", "correct horse")
+	resp := decodeJSON[models.SessionResponse](t, w)
+	session, csrf := responseCookie(w, auth.SessionCookie), responseCookie(w, auth.CSRFCookie)
+	if session == nil || csrf == nil {
+		t.Fatalf("cookies = %v, want session and CSRF cookies", w.Result().Cookies())
+	}
+
+	// The session cookie is out of reach of scripts, the CSRF cookie is not
+	if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("session cookie = %+v", session)
+	}
+	if csrf.HttpOnly || csrf.Value != resp.CSRFToken || resp.CSRFToken == "" {
+		t.Fatalf("CSRF cookie = %+v, response token %q", csrf, resp.CSRFToken)
+	}
+
+	stored, owner, err := s.repos.Sessions.Authenticate(context.Background(), auth.HashSessionToken(session.Value))
+	if err != nil || owner.ID != user.ID || stored.CSRFToken != resp.CSRFToken {
+		t.Fatalf("stored session = %+v, %+v, %v", stored, owner, err)
+	}
+
+	// The header works as well as the query parameter
+	req := httptest.NewRequest(http.MethodPost, "/api/users/login", strings.NewReader(`{"username":"budi","password":"correct horse"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Session-Mode", "cookie")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusOK)
+	if responseCookie(w, auth.SessionCookie) == nil {
+		t.Fatal("X-Session-Mode: cookie login set no session cookie")
+	}
+
+	w = s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	if responseCookie(w, auth.SessionCookie) != nil {
+		t.Fatal("Bearer login set a session cookie")
+	}
+}
+
+func TestSessionManagement(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	other := s.createUser(t, "sari", "correct horse")
+
+	first := responseCookie(s.cookieLogin(t, "budi", "correct horse"), auth.SessionCookie)
+	s.cookieLogin(t, "budi", "correct horse")
+	s.cookieLogin(t, "sari", "correct horse")
+	current, _, err := s.repos.Sessions.Authenticate(context.Background(), auth.HashSessionToken(first.Value))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.as["user_id"], s.as["auth_method"], s.as["session_id"] = user.ID, "session", current.ID
+	w := s.do(http.MethodGet, "/api/users/me/sessions", nil)
+	expectStatus(t, w, http.StatusOK)
+	sessions := decodeJSON[[]models.Session](t, w)
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %+v, want budi's two", sessions)
+	}
+	for _, session := range sessions {
+		if session.Current != (session.ID == current.ID) {
+			t.Fatalf("sessions = %+v, want only %d current", sessions, current.ID)
+		}
+	}
+
+	// Sessions of other users are not found
+	othersSessions, _ := s.repos.Sessions.ListActive(context.Background(), other.ID)
+	expectStatus(t, s.do(http.MethodDelete, "/api/users/me/sessions/"+itoa(othersSessions[0].ID), nil), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, "/api/users/me/sessions/abc", nil), http.StatusBadRequest)
+
+	for _, session := range sessions {
+		if session.ID != current.ID {
+			expectStatus(t, s.do(http.MethodDelete, "/api/users/me/sessions/"+itoa(session.ID), nil), http.StatusOK)
+		}
+	}
+
+	// Logout ends the current session and clears the cookies
+	w = s.do(http.MethodPost, "/api/users/logout", nil)
+	expectStatus(t, w, http.StatusOK)
+	if cookie := responseCookie(w, auth.SessionCookie); cookie == nil || cookie.MaxAge >= 0 {
+		t.Fatalf("session cookie after logout = %+v, want it deleted", cookie)
+	}
+	if active, _ := s.repos.Sessions.ListActive(context.Background(), user.ID); len(active) != 0 {
+		t.Fatalf("active sessions after logout = %+v", active)
+	}
+}
@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+// EnrollTwoFactor - Generate a new TOTP secret for the current user
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	if !requireInteractiveLogin(c) {
+		return
+	}
+
+	userID := currentUserID(c)
+	username, _ := c.Get("username")
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	// The secret stays pending until a code is confirmed
+	err = h.twoFactor.SetPendingSecret(c.Request.Context(), userID, secret)
+	if errors.Is(err, repository.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	issuer := config.Current.Auth.TOTPIssuer
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(issuer, fmt.Sprint(username), secret),
+		"message":          "Scan the provisioning URI as a QR code, then confirm with a code from the app",
+	})
+}
+
+// ConfirmTwoFactor - Verify the first code, enable 2FA and return recovery
+// codes. A mandatory enrollment is the last login step and ends like any
+// other login, with a token or (in cookie mode) a session.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	if !requireInteractiveLogin(c) {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+
+	// The account may have been locked since the enrollment token was issued
+	var user models.User
+	mandatory := c.GetString("token_purpose") == auth.PurposeEnroll
+	if mandatory {
+		var err error
+		user, err = h.users.GetByID(c.Request.Context(), userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, "Internal server error")
+			return
+		}
+		if refuseLocked(c, user, "mfa_enrollment") {
+			return
+		}
+	}
+
+	secret, enabled, err := h.twoFactor.GetSecret(c.Request.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment first"})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(secret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	if err := h.twoFactor.Enable(c.Request.Context(), userID, step, hashes); err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+
+	audit.Record(c, audit.EventMFAEnabled, audit.Success, audit.Event{})
+
+	if mandatory {
+		// The login response carries the recovery codes
+		c.Set("recovery_codes", codes)
+		user.TOTPEnabled = true
+		h.finishLogin(c, user, "mfa_enrollment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor - Turn off 2FA after re-checking password and code
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	if !requireInteractiveLogin(c) {
+		return
+	}
+
+	var req models.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+
+	user, err := h.users.GetCredentials(c.Request.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if twoFactorRequired(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for this account"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		audit.Record(c, audit.EventMFADisabled, audit.Failure, audit.Event{Details: "invalid credentials"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	valid, err := h.verifySecondFactor(c.Request.Context(), userID, req.Code, "")
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	if !valid {
+		audit.Record(c, audit.EventMFADisabled, audit.Failure, audit.Event{Details: "invalid credentials"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := h.twoFactor.Disable(c.Request.Context(), userID); err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	audit.Record(c, audit.EventMFADisabled, audit.Success, audit.Event{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginTwoFactor - Second login step: exchange the MFA token and an OTP
+// (or recovery code) for an API token, or a session in cookie mode
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := auth.Tokens.Parse(req.MFAToken)
+	if err == nil && claims.Purpose != auth.PurposeMFA {
+		err = auth.ErrTokenPurpose
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA token: " + err.Error()})
+		return
+	}
+
+	key := "mfa:" + fmt.Sprint(claims.UserID)
+	if wait := login.Attempts.RetryAfter(key); wait > 0 {
+		audit.Record(c, audit.EventLoginMFA, audit.Denied, audit.Event{UserID: claims.UserID, Username: claims.Username, Details: "backoff active"})
+		login.TooManyAttempts(c, wait)
+		return
+	}
+
+	method := "password+totp"
+	if req.RecoveryCode != "" {
+		method = "password+recovery_code"
+	}
+
+	user, err := h.users.GetByID(c.Request.Context(), claims.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	// Checked before the code, so a locked account does not use up a
+	// recovery code
+	if refuseLocked(c, user, method) {
+		return
+	}
+
+	valid, err := h.verifySecondFactor(c.Request.Context(), claims.UserID, req.Code, req.RecoveryCode)
+	if err != nil {
+		dbError(c, err, "Internal server error")
+		return
+	}
+	if !valid {
+		login.Attempts.Fail(key, login.CurrentSettings().UserFreeAttempts)
+		audit.Record(c, audit.EventLoginMFA, audit.Failure, audit.Event{UserID: claims.UserID, Username: claims.Username, Details: "invalid code"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	login.Attempts.Reset(key)
+
+	h.finishLogin(c, user, method)
+}
+
+// verifySecondFactor - Check a TOTP code (each time step usable once) or
+// consume a recovery code. err is only set when the database failed.
+func (h *AuthHandler) verifySecondFactor(ctx context.Context, userID int, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return h.twoFactor.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(recoveryCode))
+	}
+
+	secret, enabled, err := h.twoFactor.GetSecret(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (!enabled || secret == "")) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// Reject replays of an already used code
+	return h.twoFactor.UseStep(ctx, userID, step)
+}
+
+// issueMFAChallenge - Respond with a short-lived token for the next login step
+func issueMFAChallenge(c *gin.Context, user models.User, purpose string) {
+	ttl := config.Current.Auth.MFATokenTTL
+	if purpose == auth.PurposeEnroll {
+		ttl = config.Current.Auth.MFAEnrollTokenTTL
+	}
+
+	token, err := auth.Tokens.IssuePurpose(user.ID, user.Username, user.Role, purpose, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if purpose == auth.PurposeEnroll {
+		c.JSON(http.StatusOK, models.MFAChallengeResponse{EnrollmentRequired: true, EnrollmentToken: token})
+		return
+	}
+	c.JSON(http.StatusOK, models.MFAChallengeResponse{MFARequired: true, MFAToken: token})
+}
+
+// twoFactorRequired - Admins must use 2FA when REQUIRE_ADMIN_2FA=true
+func twoFactorRequired(user models.User) bool {
+	return user.Role == "admin" && config.Current.Auth.RequireAdmin2FA
+}
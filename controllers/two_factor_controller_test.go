@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+// totpCode - The code an authenticator app shows for secret at time at
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+// enrollTwoFactor - Turn on 2FA for the user in s.as with the code for
+// time at; returns the secret and the recovery codes. Tests pass the same
+// at to totpCode, so a time step boundary in between changes nothing.
+func (s *testServer) enrollTwoFactor(t *testing.T, at time.Time) (string, []string) {
+	t.Helper()
+	w := s.do(http.MethodPost, "/api/users/me/2fa/enroll", nil)
+	expectStatus(t, w, http.StatusOK)
+	secret := decodeJSON[map[string]string](t, w)["secret"]
+
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/confirm", models.TwoFactorCodeRequest{Code: "000000"}), http.StatusUnauthorized)
+	w = s.do(http.MethodPost, "/api/users/me/2fa/confirm", models.TwoFactorCodeRequest{Code: totpCode(t, secret, at)})
+	expectStatus(t, w, http.StatusOK)
+	resp := decodeJSON[struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}](t, w)
+	return secret, resp.RecoveryCodes
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	withLoginSettings(t, config.Login{BackoffFreeAttempts: 100, IPFreeAttempts: 100, BackoffBase: time.Second, BackoffMax: time.Minute, AttemptWindow: time.Minute, LockThreshold: 100, LockDuration: time.Minute})
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	s.as["user_id"], s.as["username"] = user.ID, user.Username
+
+	now := time.Now()
+	secret, recoveryCodes := s.enrollTwoFactor(t, now)
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("recovery codes = %v, want 10", recoveryCodes)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/enroll", nil), http.StatusConflict)
+
+	// The password alone only gets the challenge
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	expectStatus(t, w, http.StatusOK)
+	challenge := decodeJSON[models.MFAChallengeResponse](t, w)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("login = %s, want an MFA challenge", w.Body.String())
+	}
+	secondStep := func(code, recoveryCode string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPost, "/api/users/login/2fa", models.TwoFactorLoginRequest{MFAToken: challenge.MFAToken, Code: code, RecoveryCode: recoveryCode})
+	}
+
+	// The code used for the enrollment cannot log in; the next one can, once
+	expectStatus(t, secondStep(totpCode(t, secret, now), ""), http.StatusUnauthorized)
+	next := totpCode(t, secret, now.Add(30*time.Second))
+	w = secondStep(next, "")
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.LoginResponse](t, w); resp.Token == "" {
+		t.Fatalf("second step = %s, want a token", w.Body.String())
+	}
+	expectStatus(t, secondStep(next, ""), http.StatusUnauthorized)
+
+	// Recovery codes work once
+	expectStatus(t, secondStep("", recoveryCodes[0]), http.StatusOK)
+	expectStatus(t, secondStep("", recoveryCodes[0]), http.StatusUnauthorized)
+	expectStatus(t, secondStep("", "aaaaa-bbbbb"), http.StatusUnauthorized)
+
+	// Only the MFA token opens the second step
+	token := decodeJSON[models.LoginResponse](t, secondStep("", recoveryCodes[1])).Token
+	w = s.do(http.MethodPost, "/api/users/login/2fa", models.TwoFactorLoginRequest{MFAToken: token, RecoveryCode: recoveryCodes[2]})
+	expectStatus(t, w, http.StatusUnauthorized)
+}
+
+func TestTwoFactorSecondStepBackoff(t *testing.T) {
+	withLoginSettings(t, config.Login{BackoffFreeAttempts: 2, IPFreeAttempts: 100, BackoffBase: time.Minute, BackoffMax: time.Hour, AttemptWindow: time.Hour, LockThreshold: 100, LockDuration: time.Minute})
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	s.as["user_id"], s.as["username"] = user.ID, user.Username
+	_, recoveryCodes := s.enrollTwoFactor(t, time.Now())
+
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	challenge := decodeJSON[models.MFAChallengeResponse](t, w)
+	for i := 0; i < 3; i++ {
+		expectStatus(t, s.do(http.MethodPost, "/api/users/login/2fa", models.TwoFactorLoginRequest{MFAToken: challenge.MFAToken, Code: "000000"}), http.StatusUnauthorized)
+	}
+	// Even a valid recovery code waits for the backoff
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login/2fa", models.TwoFactorLoginRequest{MFAToken: challenge.MFAToken, RecoveryCode: recoveryCodes[0]}), http.StatusTooManyRequests)
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	s.as["user_id"], s.as["username"] = user.ID, user.Username
+
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/disable", models.TwoFactorDisableRequest{Password: "correct horse", Code: "000000"}), http.StatusBadRequest)
+
+	now := time.Now()
+	secret, _ := s.enrollTwoFactor(t, now)
+	next := totpCode(t, secret, now.Add(30*time.Second))
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/disable", models.TwoFactorDisableRequest{Password: "wrong", Code: next}), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/disable", models.TwoFactorDisableRequest{Password: "correct horse", Code: "000000"}), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/disable", models.TwoFactorDisableRequest{Password: "correct horse", Code: next}), http.StatusOK)
+
+	// Back to password-only login
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.LoginResponse](t, w); resp.Token == "" {
+		t.Fatalf("login = %s, want a token", w.Body.String())
+	}
+}
+
+func TestDisableTwoFactorMandatoryForAdmins(t *testing.T) {
+	previous := config.Current.Auth.RequireAdmin2FA
+	config.Current.Auth.RequireAdmin2FA = true
+	t.Cleanup(func() { config.Current.Auth.RequireAdmin2FA = previous })
+
+	s := newTestServer(t)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	admin := models.User{Username: "boss", Password: string(hash), Role: "admin", CreatedBy: "test"}
+	if err := s.repos.Users.Create(context.Background(), &admin); err != nil {
+		t.Fatal(err)
+	}
+	s.as = gin.H{"user_id": admin.ID, "username": admin.Username, "role": "admin", "auth_method": "jwt"}
+
+	now := time.Now()
+	secret, _ := s.enrollTwoFactor(t, now)
+	next := totpCode(t, secret, now.Add(30*time.Second))
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/disable", models.TwoFactorDisableRequest{Password: "correct horse", Code: next}), http.StatusForbidden)
+}
+
+func TestTwoFactorLoginRechecksLock(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser(t, "budi", "correct horse")
+	s.as["user_id"], s.as["username"] = user.ID, user.Username
+	_, recoveryCodes := s.enrollTwoFactor(t, time.Now())
+
+	w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: "budi", Password: "correct horse"})
+	challenge := decodeJSON[models.MFAChallengeResponse](t, w)
+	secondStep := models.TwoFactorLoginRequest{MFAToken: challenge.MFAToken, RecoveryCode: recoveryCodes[0]}
+
+	// Locked between the two steps: refused, and the recovery code is kept
+	ctx := context.Background()
+	if err := s.repos.Users.RecordFailedLogin(ctx, user.ID, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/login/2fa", secondStep), http.StatusTooManyRequests)
+
+	if _, err := s.repos.Users.Unlock(ctx, user.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	w = s.do(http.MethodPost, "/api/users/login/2fa?session=cookie", secondStep)
+	expectStatus(t, w, http.StatusOK)
+	if cookie := responseCookie(w, auth.SessionCookie); cookie == nil || cookie.Value == "" {
+		t.Fatalf("second step in cookie mode set no session cookie (body %s)", w.Body.String())
+	}
+}
+
+func TestMandatoryTwoFactorEnrollment(t *testing.T) {
+	previous := config.Current.Auth.RequireAdmin2FA
+	config.Current.Auth.RequireAdmin2FA = true
+	t.Cleanup(func() { config.Current.Auth.RequireAdmin2FA = previous })
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	// enroll - Log in as a new admin and start the mandatory enrollment
+	// with the token the login hands out; returns the admin and the secret
+	enroll := func(username string) (models.User, string) {
+		t.Helper()
+		hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+		admin := models.User{Username: username, Password: string(hash), Role: "admin", CreatedBy: "test"}
+		if err := s.repos.Users.Create(ctx, &admin); err != nil {
+			t.Fatal(err)
+		}
+		w := s.do(http.MethodPost, "/api/users/login", models.LoginRequest{Username: username, Password: "correct horse"})
+		expectStatus(t, w, http.StatusOK)
+		if challenge := decodeJSON[models.MFAChallengeResponse](t, w); !challenge.EnrollmentRequired {
+			t.Fatalf("login = %s, want an enrollment challenge", w.Body.String())
+		}
+
+		s.as = gin.H{"user_id": admin.ID, "username": admin.Username, "role": "admin", "auth_method": "jwt", "token_purpose": auth.PurposeEnroll}
+		w = s.do(http.MethodPost, "/api/users/me/2fa/enroll", nil)
+		expectStatus(t, w, http.StatusOK)
+		return admin, decodeJSON[map[string]string](t, w)["secret"]
+	}
+
+	// The enrollment ends the login with a token and the recovery codes
+	_, secret := enroll("boss")
+	w := s.do(http.MethodPost, "/api/users/me/2fa/confirm", models.TwoFactorCodeRequest{Code: totpCode(t, secret, time.Now())})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decodeJSON[models.LoginResponse](t, w); resp.Token == "" || len(resp.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("confirm = %s, want a token and %d recovery codes", w.Body.String(), recoveryCodeCount)
+	}
+
+	// A locked account does not get 2FA enabled, nor a login
+	admin, secret := enroll("chief")
+	if err := s.repos.Users.RecordFailedLogin(ctx, admin.ID, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/users/me/2fa/confirm", models.TwoFactorCodeRequest{Code: totpCode(t, secret, time.Now())}), http.StatusTooManyRequests)
+	if _, enabled, err := s.repos.TwoFactor.GetSecret(ctx, admin.ID); err != nil || enabled {
+		t.Fatalf("2FA enabled = %v, %v for a locked account", enabled, err)
+	}
+
+	// Cookie mode ends with a session
+	if _, err := s.repos.Users.Unlock(ctx, admin.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	w = s.do(http.MethodPost, "/api/users/me/2fa/confirm?session=cookie", models.TwoFactorCodeRequest{Code: totpCode(t, secret, time.Now())})
+	expectStatus(t, w, http.StatusOK)
+	if cookie := responseCookie(w, auth.SessionCookie); cookie == nil || cookie.Value == "" {
+		t.Fatalf("confirm in cookie mode set no session cookie (body %s)", w.Body.String())
+	}
+	if resp := decodeJSON[models.SessionResponse](t, w); len(resp.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("confirm = %s, want %d recovery codes", w.Body.String(), recoveryCodeCount)
+	}
+}
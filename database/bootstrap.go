@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// PasswordNotice - Where BootstrapAdmin writes a generated password
+var PasswordNotice io.Writer = os.Stderr
+
+// BootstrapAdmin - On first start, when no account has the admin role,
+// create ADMIN_USERNAME with the password from ADMIN_PASSWORD or
+// ADMIN_PASSWORD_FILE, or with a generated one written once to stderr. The
+// account has to change its password at the first login. Admins that
+// still have the old default password stop a production start.
+func BootstrapAdmin() error {
+	cfg := config.Current
+
+	admins, err := legacyPasswordAdmins()
+	if err != nil {
+		return err
+	}
+	for _, username := range admins.legacy {
+		if cfg.Production() {
+			return fmt.Errorf("admin %q still has the old default password; reset it with \"user create-admin -username %s\"", username, username)
+		}
+		slog.Warn("Admin still has the old default password", "username", username, "password", config.LegacyAdminPassword)
+	}
+	if admins.count > 0 {
+		return nil
+	}
+
+	password, generated, err := AdminPassword(cfg.Admin)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec(`
+        INSERT INTO users (username, password, role, must_change_password, created_by)
+        VALUES ($1, $2, 'admin', TRUE, 'system')
+    `, cfg.Admin.Username, string(hashedPassword))
+	if IsUniqueViolation(err) {
+		return adminUsernameTaken(cfg.Admin.Username)
+	}
+	if err != nil {
+		return err
+	}
+
+	if generated {
+		// Not through the log, which is shipped and kept elsewhere
+		fmt.Fprintf(PasswordNotice, "\nAdmin account %q created with the generated password\n\n    %s\n\nIt is not shown again and must be changed at the first login.\n\n", cfg.Admin.Username, password)
+		slog.Warn("Admin account created with a generated password, written to stderr", "username", cfg.Admin.Username)
+	} else {
+		slog.Info("Admin account created; the password must be changed at the first login", "username", cfg.Admin.Username)
+	}
+	return nil
+}
+
+// adminUsernameTaken - ADMIN_USERNAME already exists: an admin when
+// another instance bootstrapped at the same time, otherwise a plain user
+// who must not silently leave the installation without an admin
+func adminUsernameTaken(username string) error {
+	var role string
+	if err := DB.QueryRow("SELECT role FROM users WHERE username = $1", username).Scan(&role); err != nil {
+		return err
+	}
+	if role == "admin" {
+		return nil
+	}
+	return fmt.Errorf("ADMIN_USERNAME %q belongs to an account without the admin role; choose another ADMIN_USERNAME or promote it with \"user create-admin -username %s\"", username, username)
+}
+
+type adminAccounts struct {
+	count  int
+	legacy []string
+}
+
+// legacyPasswordAdmins - Count the admins and find those whose password is
+// still config.LegacyAdminPassword
+func legacyPasswordAdmins() (adminAccounts, error) {
+	var admins adminAccounts
+	rows, err := DB.Query("SELECT username, password FROM users WHERE role = 'admin' ORDER BY id")
+	if err != nil {
+		return admins, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username, hash string
+		if err := rows.Scan(&username, &hash); err != nil {
+			return admins, err
+		}
+		admins.count++
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(config.LegacyAdminPassword)) == nil {
+			admins.legacy = append(admins.legacy, username)
+		}
+	}
+	return admins, rows.Err()
+}
+
+// AdminPassword - Initial admin password: ADMIN_PASSWORD, the first line of
+// ADMIN_PASSWORD_FILE, or else a generated one (generated is true)
+func AdminPassword(cfg config.Admin) (password string, generated bool, err error) {
+	switch {
+	case cfg.Password != "":
+		password = cfg.Password
+	case cfg.PasswordFile != "":
+		data, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return "", false, err
+		}
+		password, _, _ = strings.Cut(string(data), "\n")
+		password = strings.TrimRight(password, "\r")
+	default:
+		password, err = auth.GeneratePassword()
+		return password, true, err
+	}
+
+	if password == config.LegacyAdminPassword {
+		return "", false, fmt.Errorf("admin password must not be the old default password")
+	}
+	if err := auth.ValidatePassword(password, cfg.Username); err != nil {
+		return "", false, fmt.Errorf("admin password: %v", err)
+	}
+	return password, false, nil
+}
+
+// CreateAdmin - Create an admin account, or recover an existing account:
+// it gets the admin role and the new password, is unlocked, and its browser
+// sessions, API keys and previously issued Bearer tokens stop working. Either way the password must be changed at the next login.
+func CreateAdmin(ctx context.Context, username, password string) (created bool, err error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+
+	err = WithTx(ctx, DB, nil, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE username = $1"+Dialect.ForUpdate(), username).Scan(&id)
+		if err == sql.ErrNoRows {
+			created = true
+			_, err = tx.ExecContext(ctx, `
+                INSERT INTO users (username, password, role, must_change_password, created_by)
+                VALUES ($1, $2, 'admin', TRUE, 'system')
+            `, username, string(hashedPassword))
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		created = false
+		_, err = tx.ExecContext(ctx, `
+            UPDATE users
+            SET password = $1, role = 'admin', must_change_password = TRUE,
+                failed_login_attempts = 0, locked_until = NULL,
+                tokens_valid_after = CURRENT_TIMESTAMP,
+                modified_at = CURRENT_TIMESTAMP, modified_by = 'system'
+            WHERE id = $2
+        `, string(hashedPassword), id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1", id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", id)
+		return err
+	})
+	return created, err
+}
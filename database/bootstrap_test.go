@@ -0,0 +1,264 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestCreateAdminNewAccount(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		repos := repository.NewSQL(database.DB, nil)
+
+		created, err := database.CreateAdmin(ctx, "root", "Recovery-Passw0rd")
+		if err != nil || !created {
+			t.Fatalf("CreateAdmin = %v, %v; want created", created, err)
+		}
+
+		user, err := repos.Users.GetByUsername(ctx, "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != "admin" || !user.MustChangePassword {
+			t.Fatalf("user = %+v, want an admin who must change the password", user)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("Recovery-Passw0rd")) != nil {
+			t.Fatal("password not stored")
+		}
+	})
+}
+
+func TestCreateAdminRecoversAccount(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		repos := repository.NewSQL(database.DB, nil)
+
+		user := models.User{Username: "budi", Password: "x", Role: "user", CreatedBy: "test"}
+		if err := repos.Users.Create(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := repos.Users.RecordFailedLogin(ctx, user.ID, 3, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+		key := models.APIKey{Name: "ci", Prefix: "bk_test", Scopes: []string{"books:read"}}
+		if err := repos.APIKeys.Create(ctx, user.ID, &key, "key-hash", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		session := models.Session{CSRFToken: "csrf"}
+		if err := repos.Sessions.Create(ctx, user.ID, &session, "session-hash", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		issuedBefore := time.Now().Add(-time.Minute)
+
+		created, err := database.CreateAdmin(ctx, "budi", "Recovery-Passw0rd")
+		if err != nil || created {
+			t.Fatalf("CreateAdmin = %v, %v; want the account recovered", created, err)
+		}
+
+		recovered, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recovered.Role != "admin" || !recovered.MustChangePassword || recovered.LockedFor > 0 {
+			t.Fatalf("recovered = %+v, want an unlocked admin who must change the password", recovered)
+		}
+
+		if _, _, err := repos.APIKeys.Authenticate(ctx, "key-hash"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("API key after recovery: err = %v, want ErrNotFound", err)
+		}
+		if _, _, err := repos.Sessions.Authenticate(ctx, "session-hash"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("session after recovery: err = %v, want ErrNotFound", err)
+		}
+
+		if revoked, err := repos.Users.TokenRevoked(ctx, user.ID, issuedBefore); err != nil || !revoked {
+			t.Fatalf("TokenRevoked(before recovery) = %v, %v; want true", revoked, err)
+		}
+		if revoked, err := repos.Users.TokenRevoked(ctx, user.ID, time.Now().Add(2*time.Second)); err != nil || revoked {
+			t.Fatalf("TokenRevoked(after recovery) = %v, %v; want false", revoked, err)
+		}
+	})
+}
+
+func TestTokenRevokedWithoutRecovery(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		repos := repository.NewSQL(database.DB, nil)
+
+		user := models.User{Username: "budi", Password: "x", Role: "user", CreatedBy: "test"}
+		if err := repos.Users.Create(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := repos.Users.TokenRevoked(ctx, user.ID, time.Now().Add(-time.Hour)); err != nil || revoked {
+			t.Fatalf("TokenRevoked = %v, %v; want false", revoked, err)
+		}
+		if _, err := repos.Users.TokenRevoked(ctx, user.ID+1, time.Now()); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("TokenRevoked(unknown user) err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// withAdminSettings - Use admin and env for the test
+func withAdminSettings(t *testing.T, env string, admin config.Admin) {
+	t.Helper()
+	previousEnv, previousAdmin := config.Current.Env, config.Current.Admin
+	config.Current.Env, config.Current.Admin = env, admin
+	t.Cleanup(func() { config.Current.Env, config.Current.Admin = previousEnv, previousAdmin })
+}
+
+func TestAdminPassword(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "admin-password")
+	if err := os.WriteFile(file, []byte("From-File-Passw0rd\r\nignored\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		admin     config.Admin
+		password  string
+		generated bool
+	}{
+		{config.Admin{Username: "admin", Password: "Configured-Passw0rd"}, "Configured-Passw0rd", false},
+		{config.Admin{Username: "admin", PasswordFile: file}, "From-File-Passw0rd", false},
+	} {
+		password, generated, err := database.AdminPassword(tc.admin)
+		if err != nil || password != tc.password || generated != tc.generated {
+			t.Errorf("AdminPassword(%+v) = %q, %v, %v", tc.admin, password, generated, err)
+		}
+	}
+
+	password, generated, err := database.AdminPassword(config.Admin{Username: "admin"})
+	if err != nil || !generated || auth.ValidatePassword(password, "admin") != nil {
+		t.Errorf("generated password = %q, %v, %v; want a valid one", password, generated, err)
+	}
+
+	for _, admin := range []config.Admin{
+		{Username: "admin", Password: config.LegacyAdminPassword},
+		{Username: "admin", Password: "short"},
+		{Username: "admin", PasswordFile: filepath.Join(t.TempDir(), "missing")},
+	} {
+		if _, _, err := database.AdminPassword(admin); err == nil {
+			t.Errorf("AdminPassword(%+v) accepted", admin)
+		}
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		repos := repository.NewSQL(database.DB, nil)
+		withAdminSettings(t, "development", config.Admin{Username: "root", Password: "Configured-Passw0rd"})
+
+		if err := database.BootstrapAdmin(); err != nil {
+			t.Fatal(err)
+		}
+		admin, err := repos.Users.GetByUsername(ctx, "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if admin.Role != "admin" || !admin.MustChangePassword || bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte("Configured-Passw0rd")) != nil {
+			t.Fatalf("admin = %+v, want the configured password to be changed at the first login", admin)
+		}
+
+		// Nothing happens once there is an admin
+		withAdminSettings(t, "development", config.Admin{Username: "other", Password: "Configured-Passw0rd"})
+		if err := database.BootstrapAdmin(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repos.Users.GetByUsername(ctx, "other"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("second admin: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestBootstrapAdminGeneratedPassword(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		repos := repository.NewSQL(database.DB, nil)
+		withAdminSettings(t, "development", config.Admin{Username: "root"})
+
+		var notice, logged bytes.Buffer
+		previousNotice, previousLogger := database.PasswordNotice, slog.Default()
+		database.PasswordNotice = &notice
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logged, nil)))
+		t.Cleanup(func() {
+			database.PasswordNotice = previousNotice
+			slog.SetDefault(previousLogger)
+		})
+
+		if err := database.BootstrapAdmin(); err != nil {
+			t.Fatal(err)
+		}
+		admin, err := repos.Users.GetByUsername(context.Background(), "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var password string
+		for _, line := range strings.Split(notice.String(), "\n") {
+			if candidate := strings.TrimSpace(line); bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(candidate)) == nil {
+				password = candidate
+			}
+		}
+		if password == "" {
+			t.Fatalf("notice %q does not show the password", notice.String())
+		}
+		if strings.Contains(logged.String(), password) {
+			t.Fatalf("log %q contains the generated password", logged.String())
+		}
+	})
+}
+
+func TestBootstrapAdminUsernameTaken(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		repos := repository.NewSQL(database.DB, nil)
+		user := models.User{Username: "root", Password: "x", Role: "user", CreatedBy: "test"}
+		if err := repos.Users.Create(context.Background(), &user); err != nil {
+			t.Fatal(err)
+		}
+
+		// No admin at all would be left otherwise
+		withAdminSettings(t, "development", config.Admin{Username: "root", Password: "Configured-Passw0rd"})
+		err := database.BootstrapAdmin()
+		if err == nil || !strings.Contains(err.Error(), "user create-admin") {
+			t.Fatalf("err = %v, want a pointer to user create-admin", err)
+		}
+	})
+}
+
+func TestBootstrapAdminLegacyPassword(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		repos := repository.NewSQL(database.DB, nil)
+		hash, err := bcrypt.GenerateFromPassword([]byte(config.LegacyAdminPassword), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy := models.User{Username: "admin", Password: string(hash), Role: "admin", CreatedBy: "test"}
+		if err := repos.Users.Create(context.Background(), &legacy); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only a warning in development
+		withAdminSettings(t, "development", config.Admin{Username: "admin"})
+		if err := database.BootstrapAdmin(); err != nil {
+			t.Fatalf("development start: %v", err)
+		}
+		withAdminSettings(t, "production", config.Admin{Username: "admin"})
+		if err := database.BootstrapAdmin(); err == nil {
+			t.Fatal("production start with the old default admin password")
+		}
+	})
+}
@@ -1,138 +1,104 @@
 package database
 
 import (
-    "database/sql"
-    "fmt"
-    "log"
-    "os"
+	"database/sql"
+	"fmt"
+	"log/slog"
 
-    "golang.org/x/crypto/bcrypt"
-    _ "github.com/lib/pq"
-    "github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"mini-project-buku-sb-go-73-Agil/config"
+	_ "modernc.org/sqlite"
 )
 
 var DB *sql.DB
 
+// ConnectDB - Open the database, apply pending migrations, make sure
+// an admin account exists and connect the read replicas
 func ConnectDB() error {
-    err := godotenv.Load()
-    if err != nil {
-        log.Println("No .env file found, using environment variables")
-    }
+	err := Open()
+	if err != nil {
+		return err
+	}
 
-    connStr := fmt.Sprintf(
-        "host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_PORT"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"),
-        os.Getenv("DB_SSLMODE"),
-    )
+	// Apply pending schema migrations
+	if err = MigrateUp(); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
 
-    DB, err = sql.Open("postgres", connStr)
-    if err != nil {
-        return err
-    }
+	// Create the first admin account if there is none
+	if err = BootstrapAdmin(); err != nil {
+		return fmt.Errorf("failed to bootstrap admin account: %v", err)
+	}
 
-    err = DB.Ping()
-    if err != nil {
-        return err
-    }
+	// Optional read replicas (DB_REPLICA_DSNS)
+	Replicas, err = OpenReplicas(DB)
+	if err != nil {
+		return fmt.Errorf("failed to open read replicas: %v", err)
+	}
 
-    log.Println("Connected to database successfully")
-    
-    // Create tables if not exists
-    if err := createTables(); err != nil {
-        return fmt.Errorf("failed to create tables: %v", err)
-    }
-    
-    // Insert default admin user if not exists
-    if err := createDefaultUser(); err != nil {
-        return fmt.Errorf("failed to create default user: %v", err)
-    }
-
-    return nil
+	return nil
 }
 
-func createTables() error {
-    tables := []string{
-        // Users table
-        `CREATE TABLE IF NOT EXISTS users (
-            id SERIAL PRIMARY KEY,
-            username VARCHAR(100) UNIQUE NOT NULL,
-            password VARCHAR(255) NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            created_by VARCHAR(100),
-            modified_at TIMESTAMP,
-            modified_by VARCHAR(100)
-        )`,
-        
-        // Categories table
-        `CREATE TABLE IF NOT EXISTS categories (
-            id SERIAL PRIMARY KEY,
-            name VARCHAR(100) NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            created_by VARCHAR(100),
-            modified_at TIMESTAMP,
-            modified_by VARCHAR(100)
-        )`,
-        
-        // Books table with check constraint
-        `CREATE TABLE IF NOT EXISTS books (
-            id SERIAL PRIMARY KEY,
-            title VARCHAR(255) NOT NULL,
-            description TEXT,
-            image_url VARCHAR(500),
-            release_year INTEGER NOT NULL,
-            price INTEGER NOT NULL,
-            total_page INTEGER NOT NULL,
-            thickness VARCHAR(50),
-            category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            created_by VARCHAR(100),
-            modified_at TIMESTAMP,
-            modified_by VARCHAR(100),
-            CONSTRAINT chk_release_year CHECK (release_year >= 1980 AND release_year <= 2024)
-        )`,
-    }
+// Open - Connect to the database without touching the schema.
+// The driver is postgres (default, DB_HOST, DB_PORT, ...), mysql (same
+// settings, MySQL 8 or MariaDB 10.5+) or sqlite (a single file at
+// DB_PATH, default books.db, no server needed).
+func Open() error {
+	cfg := config.Current.Database
 
-    for _, table := range tables {
-        _, err := DB.Exec(table)
-        if err != nil {
-            return err
-        }
-    }
-    
-    log.Println("Tables created/verified successfully")
-    return nil
-}
+	var err error
+	switch cfg.Driver {
+	case "postgres":
+		port := cfg.Port
+		if port == "" {
+			port = "5432"
+		}
+		connStr := fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			cfg.Host,
+			port,
+			cfg.User,
+			cfg.Password,
+			cfg.Name,
+			cfg.SSLMode,
+		)
+		Dialect = postgresDialect{}
+		DB, err = openDB("postgres", connStr)
+	case "sqlite":
+		Dialect = sqliteDialect{}
+		DB, err = openDB("sqlite", "file:"+cfg.Path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	case "mysql":
+		Dialect = mysqlDialect{}
+		DB, err = openMySQL(cfg)
+	default:
+		return fmt.Errorf("unknown DB_DRIVER %q (available: postgres, sqlite, mysql)", cfg.Driver)
+	}
+	if err != nil {
+		return err
+	}
+	LoadPoolSettings().Apply(DB)
+	if Dialect.Name() == "sqlite" {
+		// SQLite allows one writer at a time; a single connection queues
+		// writes instead of failing them with "database is locked"
+		DB.SetMaxOpenConns(1)
+	}
 
-func createDefaultUser() error {
-    // Check if admin user already exists
-    var count int
-    err := DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = 'admin'").Scan(&count)
-    if err != nil {
-        return err
-    }
+	err = pingWithRetry(DB)
+	if err != nil {
+		return err
+	}
 
-    if count == 0 {
-        // Hash password: "password123" menggunakan bcrypt
-        hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
-        if err != nil {
-            return err
-        }
-        
-        _, err = DB.Exec(`
-            INSERT INTO users (username, password, created_by) 
-            VALUES ($1, $2, $3)
-        `, "admin", string(hashedPassword), "system")
-        
-        if err != nil {
-            return err
-        }
-        
-        log.Println("Default admin user created: admin/password123")
-    }
-    
-    return nil
-}
\ No newline at end of file
+	slog.Info("Connected to database", "driver", Dialect.Name())
+	return nil
+}
+
+// Close - Close the read replicas and the primary connection pool
+func Close() error {
+	if Replicas != nil {
+		Replicas.Close()
+	}
+	if DB == nil {
+		return nil
+	}
+	return DB.Close()
+}
@@ -0,0 +1,94 @@
+package database
+
+import "fmt"
+
+// SQLDialect - The bits of SQL that differ between the supported databases.
+// Queries are otherwise written in the common subset, with $n placeholders
+// and RETURNING (both emulated for MySQL, see mysql.go).
+type SQLDialect interface {
+	// Name - Driver name, also the migrations subdirectory
+	Name() string
+	// AddSeconds - Expression for timestamp ts shifted by seconds (both SQL expressions)
+	AddSeconds(ts, seconds string) string
+	// SecondsUntil - Expression for the seconds from now until ts
+	// (negative when ts is in the past, NULL when ts is NULL)
+	SecondsUntil(ts string) string
+	// Timestamp - Expression turning an RFC3339 UTC parameter into a value
+	// comparable with timestamp columns
+	Timestamp(param string) string
+	// ForUpdate - Row lock suffix for a SELECT inside a transaction
+	ForUpdate() string
+	// MigrationLock - Statements taking and releasing the lock that keeps
+	// instances from migrating concurrently (empty if not needed)
+	MigrationLock() (lock, unlock string)
+}
+
+// Dialect - Dialect of the open database (Postgres unless DB_DRIVER says otherwise)
+var Dialect SQLDialect = postgresDialect{}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) AddSeconds(ts, seconds string) string {
+	return "(" + ts + " + (" + seconds + ") * INTERVAL '1 second')"
+}
+
+func (postgresDialect) SecondsUntil(ts string) string {
+	return "EXTRACT(EPOCH FROM (" + ts + " - CURRENT_TIMESTAMP))"
+}
+
+func (postgresDialect) Timestamp(param string) string { return param + "::timestamptz" }
+
+func (postgresDialect) ForUpdate() string { return " FOR UPDATE" }
+
+func (postgresDialect) MigrationLock() (string, string) {
+	return fmt.Sprintf("SELECT pg_advisory_lock(%d)", migrationLockKey), fmt.Sprintf("SELECT pg_advisory_unlock(%d)", migrationLockKey)
+}
+
+// sqliteDialect - Timestamps are stored as UTC "YYYY-MM-DD HH:MM:SS" text
+// (the CURRENT_TIMESTAMP format), so they compare correctly as strings
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) AddSeconds(ts, seconds string) string {
+	return "datetime(julianday(" + ts + ") + (" + seconds + ") / 86400.0)"
+}
+
+func (sqliteDialect) SecondsUntil(ts string) string {
+	return "((julianday(" + ts + ") - julianday('now')) * 86400.0)"
+}
+
+func (sqliteDialect) Timestamp(param string) string { return "datetime(" + param + ")" }
+
+// SQLite locks the whole database for writing, there are no row locks
+func (sqliteDialect) ForUpdate() string { return "" }
+
+// Nor does it need a migration lock, it only lets one writer in at a time
+func (sqliteDialect) MigrationLock() (string, string) { return "", "" }
+
+// mysqlDialect - MySQL 8 / MariaDB 10.5+, sessions run in UTC (see openMySQL)
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) AddSeconds(ts, seconds string) string {
+	return "(" + ts + " + INTERVAL (" + seconds + ") SECOND)"
+}
+
+func (mysqlDialect) SecondsUntil(ts string) string {
+	return "TIMESTAMPDIFF(SECOND, CURRENT_TIMESTAMP, " + ts + ")"
+}
+
+// DATETIME literals accept the "T" separator but not the "Z" suffix;
+// callers pass UTC values
+func (mysqlDialect) Timestamp(param string) string {
+	return "CAST(REPLACE(" + param + ", 'Z', '') AS DATETIME)"
+}
+
+func (mysqlDialect) ForUpdate() string { return " FOR UPDATE" }
+
+func (mysqlDialect) MigrationLock() (string, string) {
+	return "SELECT GET_LOCK('schema_migrations', -1)", "SELECT RELEASE_LOCK('schema_migrations')"
+}
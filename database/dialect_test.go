@@ -0,0 +1,140 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+)
+
+func TestDialectTimeExpressions(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		d := database.Dialect
+
+		var seconds float64
+		query := "SELECT " + d.SecondsUntil(d.AddSeconds("CURRENT_TIMESTAMP", "$1"))
+		if err := database.DB.QueryRow(query, 90).Scan(&seconds); err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(seconds-90) > 2 {
+			t.Fatalf("seconds until now + 90s = %v, want about 90", seconds)
+		}
+
+		var null sql.NullFloat64
+		if err := database.DB.QueryRow("SELECT " + d.SecondsUntil("NULL")).Scan(&null); err != nil || null.Valid {
+			t.Fatalf("SecondsUntil(NULL) = %v, %v; want NULL", null, err)
+		}
+
+		// RFC3339 UTC parameters compare with timestamp columns
+		if _, err := database.DB.Exec("INSERT INTO categories (name) VALUES ('Fiksi')"); err != nil {
+			t.Fatal(err)
+		}
+		count := func(op string, at time.Time) int {
+			t.Helper()
+			var n int
+			err := database.DB.QueryRow("SELECT COUNT(*) FROM categories WHERE created_at "+op+" "+d.Timestamp("$1"), at.UTC().Format(time.RFC3339)).Scan(&n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+		if count(">", time.Now().Add(-time.Hour)) != 1 || count("<", time.Now().Add(time.Hour)) != 1 || count(">", time.Now().Add(time.Hour)) != 0 {
+			t.Fatal("created_at does not compare with Timestamp parameters")
+		}
+	})
+}
+
+func TestDialectForUpdate(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		if _, err := database.DB.Exec("INSERT INTO categories (name) VALUES ('Fiksi')"); err != nil {
+			t.Fatal(err)
+		}
+		err := database.WithTx(ctx, database.DB, nil, func(tx *sql.Tx) error {
+			var name string
+			return tx.QueryRowContext(ctx, "SELECT name FROM categories WHERE name = $1"+database.Dialect.ForUpdate(), "Fiksi").Scan(&name)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestOpenSQLite(t *testing.T) {
+	dbtest.Open(t, "sqlite")
+
+	if name := database.Dialect.Name(); name != "sqlite" {
+		t.Fatalf("Dialect = %s, want sqlite", name)
+	}
+	var foreignKeys int
+	var journalMode string
+	if err := database.DB.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+		t.Errorf("foreign_keys = %d, %v; want enabled", foreignKeys, err)
+	}
+	if err := database.DB.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Errorf("journal_mode = %q, %v; want wal", journalMode, err)
+	}
+	if lock, unlock := database.Dialect.MigrationLock(); lock != "" || unlock != "" {
+		t.Errorf("MigrationLock = %q, %q; want none", lock, unlock)
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	previous := config.Current.Database
+	t.Cleanup(func() { config.Current.Database = previous })
+	config.Current.Database.Driver = "oracle"
+
+	if err := database.Open(); err == nil {
+		t.Fatal("Open accepted an unknown driver")
+	}
+}
+
+func TestReturning(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+
+		var first, second int
+		insert := "INSERT INTO categories (name, created_by) VALUES ($1, $2) RETURNING id"
+		if err := database.DB.QueryRowContext(ctx, insert, "Fiksi", "test").Scan(&first); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.DB.QueryRowContext(ctx, insert, "Sejarah", "test").Scan(&second); err != nil {
+			t.Fatal(err)
+		}
+		if first == 0 || second <= first {
+			t.Fatalf("ids = %d, %d; want increasing ids", first, second)
+		}
+
+		// $2 before $1, and several rows updated
+		rows, err := database.DB.QueryContext(ctx, "UPDATE categories SET modified_by = $2 WHERE created_by = $1 RETURNING id, modified_by", "test", "editor")
+		if err != nil {
+			t.Fatal(err)
+		}
+		updated := map[int]string{}
+		for rows.Next() {
+			var id int
+			var by string
+			if err := rows.Scan(&id, &by); err != nil {
+				t.Fatal(err)
+			}
+			updated[id] = by
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(updated) != 2 || updated[first] != "editor" || updated[second] != "editor" {
+			t.Fatalf("updated = %v, want both categories modified by editor", updated)
+		}
+
+		var id int
+		err = database.DB.QueryRowContext(ctx, "UPDATE categories SET name = $1 WHERE id = $2 RETURNING id", "Puisi", second+100).Scan(&id)
+		if err != sql.ErrNoRows {
+			t.Fatalf("update of no rows: err = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
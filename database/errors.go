@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// SQLite extended result codes (sqlite3.h)
+const (
+	sqliteBusy            = 5
+	sqliteBusySnapshot    = 517
+	sqliteCheckViolation  = 275
+	sqliteForeignKey      = 787
+	sqlitePrimaryKey      = 1555
+	sqliteUniqueViolation = 2067
+)
+
+// MySQL / MariaDB server error numbers
+const (
+	mysqlDuplicateEntry     = 1062
+	mysqlRowIsReferenced    = 1451
+	mysqlNoReferencedRow    = 1452
+	mysqlLockDeadlock       = 1213
+	mysqlStatementTimeout   = 1969 // MariaDB max_statement_time
+	mysqlQueryTimeout       = 3024 // MySQL max_execution_time
+	mysqlCheckViolated      = 3819
+	mariadbConstraintFailed = 4025
+)
+
+// mysqlConstraint - The quoted name in "Check constraint 'x' is violated",
+// "CONSTRAINT `x` failed" or "Duplicate entry 'v' for key 'x'"
+var mysqlConstraint = regexp.MustCompile("(?i)(?:constraint|for key) [`']([^`']+)[`']")
+
+// sqliteCode - SQLite result code of err, 0 if it is not a SQLite error
+func sqliteCode(err error) int {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code()
+	}
+	return 0
+}
+
+// mysqlCode - MySQL error number of err, 0 if it is not a MySQL error
+func mysqlCode(err error) uint16 {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number
+	}
+	return 0
+}
+
+// IsUniqueViolation - Whether err is a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	if mysqlCode(err) == mysqlDuplicateEntry {
+		return true
+	}
+	code := sqliteCode(err)
+	return code == sqliteUniqueViolation || code == sqlitePrimaryKey
+}
+
+// IsForeignKeyViolation - Whether err is a foreign key violation
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23503"
+	}
+	if code := mysqlCode(err); code == mysqlRowIsReferenced || code == mysqlNoReferencedRow {
+		return true
+	}
+	return sqliteCode(err) == sqliteForeignKey
+}
+
+// IsCheckViolation - Whether err is a CHECK constraint violation
+func IsCheckViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23514"
+	}
+	if code := mysqlCode(err); code == mysqlCheckViolated || code == mariadbConstraintFailed {
+		return true
+	}
+	return sqliteCode(err) == sqliteCheckViolation
+}
+
+// ConstraintName - Name of the violated constraint, if err carries one.
+// SQLite and MySQL only report it in the message ("CHECK constraint failed:
+// chk_release_year", "Check constraint 'chk_release_year' is violated.").
+func ConstraintName(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		if m := mysqlConstraint.FindStringSubmatch(mysqlErr.Message); m != nil {
+			return m[1]
+		}
+		return ""
+	}
+	if sqliteCode(err) != 0 {
+		msg := err.Error()
+		if i := strings.LastIndex(msg, "constraint failed: "); i >= 0 {
+			name, _, _ := strings.Cut(msg[i+len("constraint failed: "):], " (")
+			return name
+		}
+	}
+	return ""
+}
+
+// IsRetryable - Whether the transaction was aborted because of a
+// serialization failure or deadlock (Postgres, MySQL) or a locked
+// database (SQLite), so running it again can succeed
+func IsRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	if mysqlCode(err) == mysqlLockDeadlock {
+		return true
+	}
+	code := sqliteCode(err)
+	return code == sqliteBusy || code == sqliteBusySnapshot
+}
+
+// IsTimeout - Whether err means a query ran past its context deadline
+// (or was cancelled by the server because of its statement time limit)
+func IsTimeout(err error) bool {
+	var pqErr *pq.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &pqErr) && pqErr.Code == "57014") {
+		return true
+	}
+	code := mysqlCode(err)
+	return code == mysqlQueryTimeout || code == mysqlStatementTimeout
+}
+
+// IsCanceled - Whether err means the client went away before the query finished
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
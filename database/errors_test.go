@@ -0,0 +1,98 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+)
+
+func TestErrorClassification(t *testing.T) {
+	type class struct{ unique, foreignKey, check, retryable, timeout bool }
+	for name, tc := range map[string]struct {
+		err  error
+		want class
+	}{
+		"postgres unique":        {&pq.Error{Code: "23505"}, class{unique: true}},
+		"postgres foreign key":   {&pq.Error{Code: "23503"}, class{foreignKey: true}},
+		"postgres check":         {&pq.Error{Code: "23514"}, class{check: true}},
+		"postgres serialization": {&pq.Error{Code: "40001"}, class{retryable: true}},
+		"postgres deadlock":      {&pq.Error{Code: "40P01"}, class{retryable: true}},
+		"postgres cancel":        {&pq.Error{Code: "57014"}, class{timeout: true}},
+		"mysql duplicate":        {&mysql.MySQLError{Number: 1062}, class{unique: true}},
+		"mysql referenced":       {&mysql.MySQLError{Number: 1451}, class{foreignKey: true}},
+		"mysql no referenced":    {&mysql.MySQLError{Number: 1452}, class{foreignKey: true}},
+		"mysql check":            {&mysql.MySQLError{Number: 3819}, class{check: true}},
+		"mariadb check":          {&mysql.MySQLError{Number: 4025}, class{check: true}},
+		"mysql deadlock":         {&mysql.MySQLError{Number: 1213}, class{retryable: true}},
+		"mysql execution time":   {&mysql.MySQLError{Number: 3024}, class{timeout: true}},
+		"mariadb statement time": {&mysql.MySQLError{Number: 1969}, class{timeout: true}},
+		"wrapped":                {fmt.Errorf("creating book: %w", &pq.Error{Code: "23505"}), class{unique: true}},
+		"deadline":               {context.DeadlineExceeded, class{timeout: true}},
+		"other":                  {errors.New("connection refused"), class{}},
+		"nil":                    {nil, class{}},
+	} {
+		got := class{
+			unique:     database.IsUniqueViolation(tc.err),
+			foreignKey: database.IsForeignKeyViolation(tc.err),
+			check:      database.IsCheckViolation(tc.err),
+			retryable:  database.IsRetryable(tc.err),
+			timeout:    database.IsTimeout(tc.err),
+		}
+		if got != tc.want {
+			t.Errorf("%s: classified as %+v, want %+v", name, got, tc.want)
+		}
+	}
+}
+
+func TestConstraintName(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{&pq.Error{Code: "23514", Constraint: "chk_release_year"}, "chk_release_year"},
+		{&mysql.MySQLError{Number: 3819, Message: "Check constraint 'chk_release_year' is violated."}, "chk_release_year"},
+		{&mysql.MySQLError{Number: 4025, Message: "CONSTRAINT `chk_release_year` failed for `books_db`.`books`"}, "chk_release_year"},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'budi' for key 'users.username'"}, "users.username"},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, ""},
+		{errors.New("CHECK constraint failed: chk_release_year"), ""},
+	} {
+		if got := database.ConstraintName(tc.err); got != tc.want {
+			t.Errorf("ConstraintName(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestConstraintErrorsFromDrivers(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		exec := func(query string, args ...interface{}) error {
+			_, err := database.DB.ExecContext(ctx, query, args...)
+			return err
+		}
+
+		if err := exec("INSERT INTO users (username, password) VALUES ($1, 'x')", "budi"); err != nil {
+			t.Fatal(err)
+		}
+		if err := exec("INSERT INTO users (username, password) VALUES ($1, 'x')", "budi"); !database.IsUniqueViolation(err) {
+			t.Errorf("duplicate username: err = %v, want a unique violation", err)
+		}
+
+		insertBook := "INSERT INTO books (title, release_year, price, total_page, category_id) VALUES ('Laskar Pelangi', $1, 85000, 529, $2)"
+		if err := exec(insertBook, 2005, 12345); !database.IsForeignKeyViolation(err) {
+			t.Errorf("unknown category: err = %v, want a foreign key violation", err)
+		}
+		err := exec(insertBook, 1900, nil)
+		if !database.IsCheckViolation(err) {
+			t.Errorf("release year 1900: err = %v, want a check violation", err)
+		}
+		if name := database.ConstraintName(err); name != "chk_release_year" {
+			t.Errorf("ConstraintName = %q, want chk_release_year", name)
+		}
+	})
+}
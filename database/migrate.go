@@ -0,0 +1,351 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// One directory per dialect (migrations/postgres, migrations/sqlite) with
+// the same versions and names
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// MigrationsDir - Source directory of the migrations, relative to the module root
+const MigrationsDir = "database/migrations"
+
+// Arbitrary key for pg_advisory_lock so only one instance migrates at a time
+const migrationLockKey = 7316400190
+
+var (
+	migrationName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	migrationSlug = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Migration - One versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus - Whether a migration has been applied
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrations - All embedded migrations for the current dialect ordered by version
+func Migrations() ([]Migration, error) {
+	dir := "migrations/" + Dialect.Name()
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+
+		data, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp - Apply all pending migrations
+func MigrateUp() error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			err := runMigration(conn, migration.Up, func(tx *sql.Tx) error {
+				_, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+		return nil
+	})
+}
+
+// MigrateDown - Revert the last steps applied migrations
+func MigrateDown(steps int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+			err := runMigration(conn, migration.Down, func(tx *sql.Tx) error {
+				_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			slog.Info("Reverted migration", "version", migration.Version, "name", migration.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// GetMigrationStatus - All migrations with the time they were applied
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = withMigrationLock(func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, migration := range migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// PendingMigrations - Versions of the embedded migrations the database has
+// not applied yet. Unlike GetMigrationStatus it does not wait for the
+// migration lock, so it is cheap enough for health checks.
+func PendingMigrations(ctx context.Context) ([]int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pending := []int64{}
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration.Version)
+		}
+	}
+	return pending, nil
+}
+
+// CreateMigration - Write empty up/down files for a new migration into
+// every dialect subdirectory of dir
+func CreateMigration(dir, name string) (string, error) {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+	if !migrationSlug.MatchString(name) {
+		return "", fmt.Errorf("invalid migration name %q", name)
+	}
+
+	dialects, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	// Number after the highest version on disk in any dialect (not the
+	// embedded set, which is only refreshed on rebuild)
+	next := int64(1)
+	var subdirs []string
+	for _, dialect := range dialects {
+		if !dialect.IsDir() {
+			continue
+		}
+		subdir := filepath.Join(dir, dialect.Name())
+		subdirs = append(subdirs, subdir)
+		entries, err := os.ReadDir(subdir)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			if m := migrationName.FindStringSubmatch(entry.Name()); m != nil {
+				if version, _ := strconv.ParseInt(m[1], 10, 64); version >= next {
+					next = version + 1
+				}
+			}
+		}
+	}
+	if len(subdirs) == 0 {
+		return "", fmt.Errorf("no dialect directories in %s", dir)
+	}
+
+	base := fmt.Sprintf("%04d_%s", next, name)
+	for _, subdir := range subdirs {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(subdir, base+"."+direction+".sql")
+			if err := os.WriteFile(path, []byte("-- "+base+" ("+direction+")\n"), 0644); err != nil {
+				return "", err
+			}
+		}
+	}
+	return base, nil
+}
+
+// withMigrationLock - Run fn on one connection holding the migration lock
+// (see SQLDialect.MigrationLock), with the set of applied versions
+func withMigrationLock(fn func(conn *sql.Conn, applied map[int64]time.Time) error) error {
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if lock, unlock := Dialect.MigrationLock(); lock != "" {
+		if _, err := conn.ExecContext(ctx, lock); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, unlock)
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+        version BIGINT PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    )`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = appliedAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+// runMigration - Execute a migration script and its bookkeeping in one
+// transaction. MySQL commits implicitly after DDL, so there a failing
+// script can leave part of its changes behind.
+func runMigration(conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitStatements - The MySQL driver runs one statement per call (unless
+// multiStatements is enabled for every query), so its scripts are split on
+// the ";" ending a line. Other drivers take the whole script.
+func splitStatements(script string) []string {
+	if Dialect.Name() != "mysql" {
+		return []string{script}
+	}
+	var statements []string
+	for _, statement := range strings.Split(script, ";\n") {
+		if statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";")); statement != "" && !onlyComments(statement) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+func onlyComments(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+)
+
+// latestVersion - The newest migration
+func latestVersion(t *testing.T) int64 {
+	t.Helper()
+	migrations, err := database.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	var reference []string
+	for _, dialect := range []string{"postgres", "sqlite", "mysql"} {
+		entries, err := os.ReadDir(filepath.Join("migrations", dialect))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		sort.Strings(names)
+
+		if reference == nil {
+			reference = names
+			continue
+		}
+		if strings.Join(names, "\n") != strings.Join(reference, "\n") {
+			t.Fatalf("%s migrations differ from postgres:\n%v\n%v", dialect, names, reference)
+		}
+	}
+	for _, name := range reference {
+		if strings.HasSuffix(name, ".up.sql") {
+			if _, err := os.Stat(filepath.Join("migrations", "postgres", strings.TrimSuffix(name, ".up.sql")+".down.sql")); err != nil {
+				t.Errorf("%s has no down migration", name)
+			}
+		}
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		latest := latestVersion(t)
+
+		statuses, err := database.GetMigrationStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				t.Fatalf("migration %d_%s not applied", status.Version, status.Name)
+			}
+		}
+		if pending, err := database.PendingMigrations(ctx); err != nil || len(pending) != 0 {
+			t.Fatalf("PendingMigrations = %v, %v; want none", pending, err)
+		}
+
+		// Applying again changes nothing
+		if err := database.MigrateUp(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := database.MigrateDown(2); err != nil {
+			t.Fatal(err)
+		}
+		pending, err := database.PendingMigrations(ctx)
+		if err != nil || len(pending) != 2 || pending[0] != latest-1 || pending[1] != latest {
+			t.Fatalf("PendingMigrations after two down steps = %v, %v", pending, err)
+		}
+
+		// Every down migration undoes its up migration completely
+		if err := database.MigrateDown(int(latest)); err != nil {
+			t.Fatal(err)
+		}
+		if pending, _ := database.PendingMigrations(ctx); int64(len(pending)) != latest {
+			t.Fatalf("PendingMigrations after reverting all = %v", pending)
+		}
+		if err := database.MigrateUp(); err != nil {
+			t.Fatalf("migrating up again: %v", err)
+		}
+	})
+}
+
+func TestMigrationPromotesLegacyAdmin(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+
+		// Back to the schema before roles (0003_login_lockout)
+		if err := database.MigrateDown(int(latestVersion(t)) - 2); err != nil {
+			t.Fatal(err)
+		}
+		for _, username := range []string{"admin", "budi"} {
+			if _, err := database.DB.ExecContext(ctx, "INSERT INTO users (username, password) VALUES ($1, 'x')", username); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := database.MigrateUp(); err != nil {
+			t.Fatal(err)
+		}
+
+		roles := map[string]string{}
+		rows, err := database.DB.QueryContext(ctx, "SELECT username, role FROM users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var username, role string
+			if err := rows.Scan(&username, &role); err != nil {
+				t.Fatal(err)
+			}
+			roles[username] = role
+		}
+		if roles["admin"] != "admin" || roles["budi"] != "user" {
+			t.Fatalf("roles = %v, want the legacy admin promoted", roles)
+		}
+	})
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		if err := os.MkdirAll(filepath.Join(dir, dialect), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The highest version in any dialect counts
+	os.WriteFile(filepath.Join(dir, "sqlite", "0004_books.up.sql"), nil, 0644)
+
+	base, err := database.CreateMigration(dir, " Add Book ISBN ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base != "0005_add_book_isbn" {
+		t.Fatalf("CreateMigration = %q, want 0005_add_book_isbn", base)
+	}
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		for _, direction := range []string{"up", "down"} {
+			if _, err := os.Stat(filepath.Join(dir, dialect, base+"."+direction+".sql")); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if _, err := database.CreateMigration(dir, "drop; table"); err == nil {
+		t.Error("invalid name accepted")
+	}
+	if _, err := database.CreateMigration(t.TempDir(), "empty"); err == nil {
+		t.Error("directory without dialects accepted")
+	}
+}
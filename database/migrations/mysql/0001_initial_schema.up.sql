@@ -0,0 +1,41 @@
+-- Binary collation so comparisons (e.g. usernames) are case-sensitive as in Postgres
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(100) UNIQUE NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(100),
+    modified_at DATETIME,
+    modified_by VARCHAR(100)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
+
+-- Categories table
+CREATE TABLE IF NOT EXISTS categories (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(100),
+    modified_at DATETIME,
+    modified_by VARCHAR(100)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
+
+-- Books table with check constraint (enforced from MySQL 8.0.16 / MariaDB 10.2)
+CREATE TABLE IF NOT EXISTS books (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    image_url VARCHAR(500),
+    release_year INT NOT NULL,
+    price INT NOT NULL,
+    total_page INT NOT NULL,
+    thickness VARCHAR(50),
+    category_id INT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(100),
+    modified_at DATETIME,
+    modified_by VARCHAR(100),
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL,
+    CONSTRAINT chk_release_year CHECK (release_year >= 1980 AND release_year <= 2024)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
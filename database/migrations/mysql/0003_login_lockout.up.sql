@@ -0,0 +1,9 @@
+-- Roles and login lockout tracking
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN failed_login_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until DATETIME;
+
+-- Databases created before roles existed: their 'admin' account was the
+-- administrator. This runs once, when the role column is added; an account
+-- named admin created later is an ordinary user.
+UPDATE users SET role = 'admin' WHERE username = 'admin';
@@ -0,0 +1,15 @@
+-- Security audit log
+CREATE TABLE IF NOT EXISTS security_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    user_id INT,
+    username VARCHAR(100),
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    details TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_security_events_created_at (created_at),
+    INDEX idx_security_events_username (username),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
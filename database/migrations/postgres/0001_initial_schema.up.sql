@@ -0,0 +1,41 @@
+-- Uses IF NOT EXISTS so databases created before migrations existed
+-- can be brought under version control without changes.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(100) UNIQUE NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(100),
+    modified_at TIMESTAMP,
+    modified_by VARCHAR(100)
+);
+
+-- Categories table
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(100),
+    modified_at TIMESTAMP,
+    modified_by VARCHAR(100)
+);
+
+-- Books table with check constraint
+CREATE TABLE IF NOT EXISTS books (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    image_url VARCHAR(500),
+    release_year INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    total_page INTEGER NOT NULL,
+    thickness VARCHAR(50),
+    category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(100),
+    modified_at TIMESTAMP,
+    modified_by VARCHAR(100),
+    CONSTRAINT chk_release_year CHECK (release_year >= 1980 AND release_year <= 2024)
+);
@@ -0,0 +1,9 @@
+-- Roles and login lockout tracking
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+-- Databases created before roles existed: their 'admin' account was the
+-- administrator. This runs once, when the role column is added; an account
+-- named admin created later is an ordinary user.
+UPDATE users SET role = 'admin' WHERE username = 'admin';
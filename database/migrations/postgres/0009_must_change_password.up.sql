@@ -0,0 +1,2 @@
+-- Accounts that must choose a new password before they can use the API
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
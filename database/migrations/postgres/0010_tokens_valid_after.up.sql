@@ -0,0 +1,3 @@
+-- Bearer tokens issued at or before this time are rejected (set when an
+-- account is recovered with create-admin, a JWT cannot be revoked otherwise)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP;
@@ -0,0 +1,397 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// The rest of the code writes Postgres-style SQL. MySQL needs two things
+// rewritten, which the connection wrapper below does for every query:
+//   - $n placeholders become ?, with the arguments repeated and reordered
+//     to match
+//   - INSERT/UPDATE ... RETURNING runs the statement and reads the rows
+//     back by id (every table has an id primary key)
+
+var (
+	returningInsert = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+(\w+)\b(.*)\bRETURNING\b(.*)$`)
+	returningUpdate = regexp.MustCompile(`(?is)^\s*UPDATE\s+(\w+)\b(.*)\bWHERE\b(.*)\bRETURNING\b(.*)$`)
+)
+
+// openMySQL - Connection pool for DB_HOST, DB_PORT (default 3306), DB_USER,
+// DB_PASSWORD and DB_NAME. Sessions use UTC so CURRENT_TIMESTAMP matches
+// the times the API reports.
+func openMySQL(settings config.Database) (*sql.DB, error) {
+	port := settings.Port
+	if port == "" {
+		port = "3306"
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(settings.Host, port)
+	cfg.User = settings.User
+	cfg.Passwd = settings.Password
+	cfg.DBName = settings.Name
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.InterpolateParams = true
+	cfg.Params = map[string]string{"time_zone": "'+00:00'"}
+	switch settings.SSLMode {
+	case "", "disable":
+	case "require":
+		cfg.TLSConfig = "skip-verify"
+	default:
+		cfg.TLSConfig = "true"
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(requestIDConnector{mysqlConnector{connector}}), nil
+}
+
+// rebind - Replace $n placeholders outside of quotes with ?, returning the
+// arguments in the order the ? appear (args the query does not use are dropped)
+func rebind(query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	if !strings.Contains(query, "$") {
+		return query, nil, nil
+	}
+
+	var b strings.Builder
+	var bound []driver.NamedValue
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			if n < 1 || n > len(args) {
+				return "", nil, fmt.Errorf("placeholder $%d has no argument (%d given)", n, len(args))
+			}
+			arg := args[n-1]
+			arg.Ordinal = len(bound) + 1
+			bound = append(bound, arg)
+			b.WriteByte('?')
+			i = j - 1
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String(), bound, nil
+}
+
+type mysqlConnector struct {
+	driver.Connector
+}
+
+func (c mysqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &mysqlConn{Conn: conn}, nil
+}
+
+// mysqlConn - Wraps a go-sql-driver connection, rewriting queries
+type mysqlConn struct {
+	driver.Conn
+	inTx bool
+}
+
+func (c *mysqlConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *mysqlConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return &mysqlStmt{conn: c, query: query}, nil
+}
+
+func (c *mysqlConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *mysqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &mysqlTx{Tx: tx, conn: c}, nil
+}
+
+func (c *mysqlConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *mysqlConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *mysqlConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
+
+func (c *mysqlConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.Conn.(driver.NamedValueChecker).CheckNamedValue(nv)
+}
+
+func (c *mysqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, args, err := rebind(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.exec(ctx, query, args)
+}
+
+func (c *mysqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if m := returningInsert.FindStringSubmatch(query); m != nil {
+		return c.insertReturning(ctx, m[1], "INSERT INTO "+m[1]+m[2], m[3], args)
+	}
+	if m := returningUpdate.FindStringSubmatch(query); m != nil {
+		return c.updateReturning(ctx, m[1], "UPDATE "+m[1]+m[2], m[3], m[4], args)
+	}
+
+	query, args, err := rebind(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(ctx, query, args)
+}
+
+// exec - Run an already rebound statement, preparing it when the driver
+// cannot interpolate the arguments itself
+func (c *mysqlConn) exec(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		return result, err
+	}
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+// query - Run an already rebound query, see exec
+func (c *mysqlConn) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		return rows, err
+	}
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	return &stmtRows{Rows: rows, stmt: stmt}, nil
+}
+
+// queryAll - Run query and read all rows, so the connection is free for
+// the next statement
+func (c *mysqlConn) queryAll(ctx context.Context, query string, args []driver.NamedValue) (*bufferedRows, error) {
+	rows, err := c.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buffered := &bufferedRows{columns: rows.Columns()}
+	for {
+		row := make([]driver.Value, len(buffered.columns))
+		if err := rows.Next(row); err == io.EOF {
+			return buffered, nil
+		} else if err != nil {
+			return nil, err
+		}
+		// The driver reuses its buffer for []byte values
+		for i, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[i] = append([]byte(nil), b...)
+			}
+		}
+		buffered.rows = append(buffered.rows, row)
+	}
+}
+
+// insertReturning - INSERT, then select the returning columns of the new row
+func (c *mysqlConn) insertReturning(ctx context.Context, table, insert, returning string, args []driver.NamedValue) (driver.Rows, error) {
+	query, bound, err := rebind(insert, args)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.exec(ctx, query, bound)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return c.queryAll(ctx, "SELECT "+returning+" FROM "+table+" WHERE id = ?", []driver.NamedValue{{Ordinal: 1, Value: id}})
+}
+
+// updateReturning - Lock the matching rows, update them by id and select
+// the returning columns, in a transaction of its own unless one is open
+func (c *mysqlConn) updateReturning(ctx context.Context, table, update, where, returning string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	if !c.inTx {
+		var tx driver.Tx
+		if tx, err = c.BeginTx(ctx, driver.TxOptions{}); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+			if err = tx.Commit(); err != nil {
+				rows = nil
+			}
+		}()
+	}
+
+	query, bound, err := rebind("SELECT id FROM "+table+" WHERE"+where+" FOR UPDATE", args)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := c.queryAll(ctx, query, bound)
+	if err != nil {
+		return nil, err
+	}
+	if len(matched.rows) == 0 {
+		return &bufferedRows{}, nil
+	}
+
+	var ids []driver.NamedValue
+	placeholders := make([]string, len(matched.rows))
+	for i, row := range matched.rows {
+		placeholders[i] = "?"
+		ids = append(ids, driver.NamedValue{Value: row[0]})
+	}
+	byID := " WHERE id IN (" + strings.Join(placeholders, ", ") + ")"
+
+	query, bound, err = rebind(update, args)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		id.Ordinal = len(bound) + 1
+		bound = append(bound, id)
+	}
+	if _, err = c.exec(ctx, query+byID, bound); err != nil {
+		return nil, err
+	}
+
+	for i := range ids {
+		ids[i].Ordinal = i + 1
+	}
+	return c.queryAll(ctx, "SELECT "+returning+" FROM "+table+byID, ids)
+}
+
+type mysqlTx struct {
+	driver.Tx
+	conn *mysqlConn
+}
+
+func (t *mysqlTx) Commit() error {
+	t.conn.inTx = false
+	return t.Tx.Commit()
+}
+
+func (t *mysqlTx) Rollback() error {
+	t.conn.inTx = false
+	return t.Tx.Rollback()
+}
+
+// mysqlStmt - Prepared statement; rebinding needs the arguments, so the
+// query is only sent to the server when it runs
+type mysqlStmt struct {
+	conn  *mysqlConn
+	query string
+}
+
+func (s *mysqlStmt) Close() error { return nil }
+
+// NumInput - Unknown, $n may repeat or skip numbers
+func (s *mysqlStmt) NumInput() int { return -1 }
+
+func (s *mysqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *mysqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *mysqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *mysqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// stmtRows - Rows that close their prepared statement with them
+type stmtRows struct {
+	driver.Rows
+	stmt driver.Stmt
+}
+
+func (r *stmtRows) Close() error {
+	err := r.Rows.Close()
+	r.stmt.Close()
+	return err
+}
+
+// bufferedRows - Rows read into memory
+type bufferedRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *bufferedRows) Columns() []string { return r.columns }
+
+func (r *bufferedRows) Close() error { return nil }
+
+func (r *bufferedRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
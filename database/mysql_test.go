@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	args := []driver.NamedValue{{Ordinal: 1, Value: "a"}, {Ordinal: 2, Value: "b"}, {Ordinal: 3, Value: "c"}}
+	for _, tc := range []struct {
+		query string
+		want  string
+		bound []interface{}
+	}{
+		{"SELECT 1", "SELECT 1", nil},
+		{"SELECT * FROM books WHERE id = $1", "SELECT * FROM books WHERE id = ?", []interface{}{"a"}},
+		{"UPDATE books SET title = $2 WHERE id = $1", "UPDATE books SET title = ? WHERE id = ?", []interface{}{"b", "a"}},
+		{"SELECT $1, $1, $3", "SELECT ?, ?, ?", []interface{}{"a", "a", "c"}},
+		{"SELECT '$1', \"$2\", `$3`, $2", "SELECT '$1', \"$2\", `$3`, ?", []interface{}{"b"}},
+		{"SELECT 'it''s $1', $1", "SELECT 'it''s $1', ?", []interface{}{"a"}},
+		{"SELECT price * 100 AS $cents, $1", "SELECT price * 100 AS $cents, ?", []interface{}{"a"}},
+	} {
+		query, bound, err := rebind(tc.query, args)
+		if err != nil {
+			t.Errorf("rebind(%q): %v", tc.query, err)
+			continue
+		}
+		var values []interface{}
+		for i, arg := range bound {
+			if arg.Ordinal != i+1 {
+				t.Errorf("rebind(%q): argument %d has ordinal %d", tc.query, i+1, arg.Ordinal)
+			}
+			values = append(values, arg.Value)
+		}
+		if query != tc.want || !reflect.DeepEqual(values, tc.bound) {
+			t.Errorf("rebind(%q) = %q %v, want %q %v", tc.query, query, values, tc.want, tc.bound)
+		}
+	}
+
+	for _, query := range []string{"SELECT $4", "SELECT $0"} {
+		if _, _, err := rebind(query, args); err == nil {
+			t.Errorf("rebind(%q) accepted a placeholder without argument", query)
+		}
+	}
+}
+
+func TestReturningPatterns(t *testing.T) {
+	insert := returningInsert.FindStringSubmatch("INSERT INTO books (title) VALUES ($1)\n RETURNING id, created_at")
+	if insert == nil || insert[1] != "books" || insert[3] != " id, created_at" {
+		t.Fatalf("INSERT match = %q", insert)
+	}
+
+	update := returningUpdate.FindStringSubmatch("UPDATE users SET role = $1 WHERE id = $2 RETURNING modified_at")
+	if update == nil || update[1] != "users" || update[2] != " SET role = $1 " || update[3] != " id = $2 " || update[4] != " modified_at" {
+		t.Fatalf("UPDATE match = %q", update)
+	}
+
+	for _, query := range []string{"SELECT id FROM books", "INSERT INTO books (title) VALUES ($1)", "UPDATE books SET title = $1 RETURNING id"} {
+		if returningInsert.MatchString(query) || returningUpdate.MatchString(query) {
+			t.Errorf("%q taken for a RETURNING statement", query)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	previous := Dialect
+	t.Cleanup(func() { Dialect = previous })
+	script := "-- Books\nCREATE TABLE books (id INT);\n\n-- Only a comment;\nALTER TABLE books ADD title TEXT;\n"
+
+	Dialect = sqliteDialect{}
+	if got := splitStatements(script); len(got) != 1 || got[0] != script {
+		t.Fatalf("SQLite statements = %q, want the whole script", got)
+	}
+
+	Dialect = mysqlDialect{}
+	want := []string{"-- Books\nCREATE TABLE books (id INT)", "ALTER TABLE books ADD title TEXT"}
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Fatalf("MySQL statements = %q, want %q", got, want)
+	}
+}
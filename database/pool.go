@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// PoolSettings - Connection pool limits
+type PoolSettings struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// LoadPoolSettings - DB_MAX_OPEN_CONNS (default 25), DB_MAX_IDLE_CONNS
+// (default 10), DB_CONN_MAX_LIFETIME (default 30m) and
+// DB_CONN_MAX_IDLE_TIME (default 5m). 0 means unlimited, as in database/sql.
+func LoadPoolSettings() PoolSettings {
+	cfg := config.Current.Database
+	return PoolSettings{
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+	}
+}
+
+// Apply - Configure the pool of db
+func (s PoolSettings) Apply(db *sql.DB) {
+	db.SetMaxOpenConns(s.MaxOpenConns)
+	db.SetMaxIdleConns(s.MaxIdleConns)
+	db.SetConnMaxLifetime(s.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(s.ConnMaxIdleTime)
+}
+
+// pingWithRetry - Wait for the database to accept connections, e.g. when
+// Postgres starts together with the API. Tries DB_CONNECT_ATTEMPTS times
+// (default 10), doubling the wait from DB_CONNECT_BACKOFF (default 500ms)
+// up to DB_CONNECT_MAX_BACKOFF (default 10s).
+func pingWithRetry(db *sql.DB) error {
+	cfg := config.Current.Database
+	attempts := cfg.ConnectAttempts
+	backoff := cfg.ConnectBackoff
+	maxBackoff := cfg.ConnectMaxBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = db.Ping(); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return err
+		}
+
+		slog.Warn("Database not ready, retrying", "attempt", attempt, "attempts", attempts, "error", err, "backoff", backoff.String())
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package database_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+)
+
+func TestPoolSettings(t *testing.T) {
+	previous := config.Current.Database
+	t.Cleanup(func() { config.Current.Database = previous })
+	config.Current.Database.MaxOpenConns = 7
+	config.Current.Database.MaxIdleConns = 3
+	config.Current.Database.ConnMaxLifetime = time.Minute
+	config.Current.Database.ConnMaxIdleTime = time.Second
+
+	settings := database.LoadPoolSettings()
+	want := database.PoolSettings{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute, ConnMaxIdleTime: time.Second}
+	if settings != want {
+		t.Fatalf("LoadPoolSettings = %+v, want %+v", settings, want)
+	}
+
+	db, err := sql.Open("sqlite", t.TempDir()+"/pool.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	settings.Apply(db)
+	if got := db.Stats().MaxOpenConnections; got != 7 {
+		t.Fatalf("MaxOpenConnections = %d, want 7", got)
+	}
+}
+
+func TestOpenAppliesPoolSettings(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		// SQLite keeps a single connection whatever the settings say
+		want := config.Current.Database.MaxOpenConns
+		if database.Dialect.Name() == "sqlite" {
+			want = 1
+		}
+		if got := database.DB.Stats().MaxOpenConnections; got != want {
+			t.Fatalf("MaxOpenConnections = %d, want %d", got, want)
+		}
+	})
+}
+
+func TestOpenRetries(t *testing.T) {
+	previous, previousDB, previousDialect := config.Current.Database, database.DB, database.Dialect
+	t.Cleanup(func() {
+		config.Current.Database = previous
+		database.DB, database.Dialect = previousDB, previousDialect
+	})
+	config.Current.Database = config.Default().Database
+	config.Current.Database.Driver = "sqlite"
+	config.Current.Database.Path = t.TempDir() + "/missing/books.db"
+	config.Current.Database.ConnectAttempts = 3
+	config.Current.Database.ConnectBackoff = 20 * time.Millisecond
+	config.Current.Database.ConnectMaxBackoff = 30 * time.Millisecond
+
+	// Waits 20ms and then 30ms (capped) between the three attempts
+	start := time.Now()
+	if err := database.Open(); err == nil {
+		t.Fatal("Open succeeded without a database directory")
+	}
+	database.DB.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Fatalf("Open gave up after %v, want about 50ms", elapsed)
+	}
+}
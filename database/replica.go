@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// Replicas - Read replicas configured with DB_REPLICA_DSNS (nil when there are none)
+var Replicas *ReplicaSet
+
+type primaryOnlyKey struct{}
+
+// ReplicaSet - Routes reads to healthy replicas and falls back to the primary
+type ReplicaSet struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64
+	maxLag   time.Duration
+	window   time.Duration
+	stop     chan struct{}
+	loop     sync.WaitGroup
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// ReplicaStatus - Health and pool usage of one replica
+type ReplicaStatus struct {
+	Name            string `json:"name"`
+	Healthy         bool   `json:"healthy"`
+	OpenConnections int    `json:"open_connections"`
+	InUse           int    `json:"in_use"`
+}
+
+// OpenReplicas - Connect the replicas listed in DB_REPLICA_DSNS (comma
+// separated postgres:// URLs) and start checking their health every
+// DB_REPLICA_CHECK_INTERVAL (default 5s). A replica is taken out of
+// rotation while it is unreachable or lags more than DB_REPLICA_MAX_LAG
+// (default 10s, 0 disables the lag check). After a user writes, their
+// reads stay on the primary for DB_READ_YOUR_WRITES_WINDOW (default 5s).
+func OpenReplicas(primary *sql.DB) (*ReplicaSet, error) {
+	cfg := config.Current.Database
+	dsns := cfg.ReplicaDSNs
+	if len(dsns) == 0 {
+		return nil, nil
+	}
+	if Dialect.Name() != "postgres" {
+		return nil, fmt.Errorf("DB_REPLICA_DSNS is only supported with DB_DRIVER=postgres")
+	}
+
+	set := &ReplicaSet{
+		primary: primary,
+		maxLag:  cfg.ReplicaMaxLag,
+		window:  cfg.ReadYourWritesWindow,
+		stop:    make(chan struct{}),
+		writes:  make(map[string]time.Time),
+	}
+	settings := LoadPoolSettings()
+	for i, dsn := range dsns {
+		db, err := openDB("postgres", dsn)
+		if err != nil {
+			set.Close()
+			return nil, err
+		}
+		settings.Apply(db)
+		set.replicas = append(set.replicas, &replica{name: "replica-" + strconv.Itoa(i+1), db: db})
+	}
+
+	set.checkAll()
+	set.loop.Add(1)
+	go set.healthLoop(cfg.ReplicaCheckInterval)
+
+	slog.Info("Routing reads to replicas", "replicas", len(set.replicas))
+	return set, nil
+}
+
+// Reader - Connection pool for a read-only query: a healthy replica (round
+// robin), or the primary when none is healthy or ctx asks for it
+func (s *ReplicaSet) Reader(ctx context.Context) *sql.DB {
+	if primaryOnly, _ := ctx.Value(primaryOnlyKey{}).(bool); primaryOnly {
+		return s.primary
+	}
+
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(int(start)+i)%len(s.replicas)]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return s.primary
+}
+
+// WithPrimary - Make reads that use ctx go to the primary
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryOnlyKey{}, true)
+}
+
+// MarkWrite - Remember that key (e.g. a user) just changed data, so its
+// reads avoid possibly stale replicas for the read-your-writes window.
+// Tracked per process: behind a load balancer use sticky sessions or a
+// longer window.
+func (s *ReplicaSet) MarkWrite(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.writes[key] = now
+	// Keep the map small
+	if len(s.writes) > 10000 {
+		for k, at := range s.writes {
+			if now.Sub(at) > s.window {
+				delete(s.writes, k)
+			}
+		}
+	}
+}
+
+// RecentWrite - Whether key wrote within the read-your-writes window
+func (s *ReplicaSet) RecentWrite(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at, ok := s.writes[key]
+	return ok && time.Since(at) <= s.window
+}
+
+// Status - Health and pool usage of every replica
+func (s *ReplicaSet) Status() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		stats := r.db.Stats()
+		statuses = append(statuses, ReplicaStatus{
+			Name:            r.name,
+			Healthy:         r.healthy.Load(),
+			OpenConnections: stats.OpenConnections,
+			InUse:           stats.InUse,
+		})
+	}
+	return statuses
+}
+
+// Close - Stop the health checks, wait for a running one to finish and
+// close the replica pools
+func (s *ReplicaSet) Close() {
+	select {
+	case <-s.stop:
+		return
+	default:
+		close(s.stop)
+	}
+	s.loop.Wait()
+	for _, r := range s.replicas {
+		r.db.Close()
+	}
+}
+
+func (s *ReplicaSet) healthLoop(interval time.Duration) {
+	defer s.loop.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkAll()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *ReplicaSet) checkAll() {
+	for _, r := range s.replicas {
+		err := s.check(r)
+		if healthy := err == nil; healthy != r.healthy.Swap(healthy) {
+			if healthy {
+				slog.Info("Replica is healthy, routing reads to it", "replica", r.name)
+			} else {
+				slog.Warn("Replica is unhealthy, reads fail over", "replica", r.name, "error", err)
+			}
+		}
+	}
+}
+
+func (s *ReplicaSet) check(r *replica) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if s.maxLag <= 0 {
+		return r.db.PingContext(ctx)
+	}
+
+	// Time since the last replayed transaction. Unlike comparing received
+	// and replayed WAL, this also grows while the standby receives nothing
+	// (a broken replication connection). An idle primary makes it grow
+	// as well, which only sends reads to the primary.
+	var inRecovery bool
+	var lagSeconds sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT pg_is_in_recovery(), EXTRACT(EPOCH FROM (now() - pg_last_xact_replay_timestamp()))
+    `).Scan(&inRecovery, &lagSeconds)
+	if err != nil {
+		return err
+	}
+	return lagError(inRecovery, lagSeconds, s.maxLag)
+}
+
+// lagError - Why a replica with the replay lag lagSeconds is unhealthy, or
+// nil. A server that is not a standby has no lag; a standby that has not
+// replayed any transaction yet cannot tell its lag and counts as behind.
+func lagError(inRecovery bool, lagSeconds sql.NullFloat64, maxLag time.Duration) error {
+	if !inRecovery {
+		return nil
+	}
+	if !lagSeconds.Valid {
+		return fmt.Errorf("replica has not replayed any transaction yet")
+	}
+	if lag := time.Duration(lagSeconds.Float64 * float64(time.Second)); lag > maxLag {
+		return fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), maxLag)
+	}
+	return nil
+}
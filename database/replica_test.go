@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// newTestReplicaSet - Set of SQLite pools standing in for the primary and
+// n replicas, all healthy, without the health check loop
+func newTestReplicaSet(t *testing.T, n int, window time.Duration) *ReplicaSet {
+	t.Helper()
+	open := func(name string) *sql.DB {
+		db, err := sql.Open("sqlite", t.TempDir()+"/"+name+".db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	set := &ReplicaSet{primary: open("primary"), window: window, stop: make(chan struct{}), writes: make(map[string]time.Time)}
+	for i := 0; i < n; i++ {
+		r := &replica{name: "replica-" + strconv.Itoa(i+1), db: open("replica")}
+		r.healthy.Store(true)
+		set.replicas = append(set.replicas, r)
+	}
+	return set
+}
+
+func TestReplicaReader(t *testing.T) {
+	set := newTestReplicaSet(t, 2, time.Second)
+	ctx := context.Background()
+	first, second := set.replicas[0].db, set.replicas[1].db
+
+	// Round robin over the healthy replicas
+	seen := map[*sql.DB]int{}
+	for i := 0; i < 4; i++ {
+		seen[set.Reader(ctx)]++
+	}
+	if seen[first] != 2 || seen[second] != 2 {
+		t.Fatalf("reads per replica = %d and %d, want 2 each", seen[first], seen[second])
+	}
+
+	if set.Reader(WithPrimary(ctx)) != set.primary {
+		t.Fatal("WithPrimary read went to a replica")
+	}
+
+	set.replicas[0].healthy.Store(false)
+	for i := 0; i < 3; i++ {
+		if set.Reader(ctx) != second {
+			t.Fatal("read went to the unhealthy replica")
+		}
+	}
+
+	set.replicas[1].healthy.Store(false)
+	if set.Reader(ctx) != set.primary {
+		t.Fatal("read without healthy replicas did not fall back to the primary")
+	}
+}
+
+func TestReplicaReadYourWrites(t *testing.T) {
+	set := newTestReplicaSet(t, 1, 50*time.Millisecond)
+
+	if set.RecentWrite("user:1") {
+		t.Fatal("recent write before any write")
+	}
+	set.MarkWrite("user:1")
+	if !set.RecentWrite("user:1") || set.RecentWrite("user:2") {
+		t.Fatal("want a recent write for user 1 only")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if set.RecentWrite("user:1") {
+		t.Fatal("write still recent after the window")
+	}
+}
+
+func TestReplicaHealthCheck(t *testing.T) {
+	set := newTestReplicaSet(t, 2, time.Second)
+	set.replicas[0].healthy.Store(false)
+	set.replicas[1].db.Close()
+
+	set.checkAll()
+	status := set.Status()
+	if len(status) != 2 || !status[0].Healthy || status[1].Healthy {
+		t.Fatalf("status = %+v, want replica-1 healthy and the closed replica-2 not", status)
+	}
+	if status[0].Name != "replica-1" || status[1].Name != "replica-2" {
+		t.Fatalf("status = %+v, want the replicas by name", status)
+	}
+
+	// Close stops the loop and may be called twice
+	set.loop.Add(1)
+	go set.healthLoop(time.Millisecond)
+	set.Close()
+	set.Close()
+}
+
+func TestReplicaLag(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		inRecovery bool
+		lagSeconds sql.NullFloat64
+		healthy    bool
+	}{
+		{"not a standby", false, sql.NullFloat64{}, true},
+		{"within the limit", true, sql.NullFloat64{Float64: 2.5, Valid: true}, true},
+		{"behind", true, sql.NullFloat64{Float64: 11, Valid: true}, false},
+		{"nothing replayed yet", true, sql.NullFloat64{}, false},
+	} {
+		if err := lagError(tt.inRecovery, tt.lagSeconds, 10*time.Second); (err == nil) != tt.healthy {
+			t.Errorf("%s: err = %v, want healthy %v", tt.name, err, tt.healthy)
+		}
+	}
+}
+
+func TestOpenReplicas(t *testing.T) {
+	previous, previousDialect := config.Current.Database, Dialect
+	t.Cleanup(func() { config.Current.Database, Dialect = previous, previousDialect })
+
+	config.Current.Database.ReplicaDSNs = nil
+	if set, err := OpenReplicas(nil); set != nil || err != nil {
+		t.Fatalf("OpenReplicas without DSNs = %v, %v; want nil, nil", set, err)
+	}
+
+	config.Current.Database.ReplicaDSNs = []string{"postgres://replica/books"}
+	Dialect = sqliteDialect{}
+	if _, err := OpenReplicas(nil); err == nil {
+		t.Fatal("OpenReplicas accepted replicas of a SQLite database")
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"mini-project-buku-sb-go-73-Agil/logging"
+)
+
+// Queries run with a request context end in a comment naming the request,
+//   SELECT ... WHERE id = $1
+//   /*request_id='4f0c...'*/
+// so a statement seen in pg_stat_activity, the slow query log or a
+// database error can be matched with the API's log lines. The comment goes
+// last, where the MySQL RETURNING emulation keeps it inside the SELECT.
+
+// openDB - Pool for a registered driver whose queries carry the request ID
+func openDB(driverName, dsn string) (*sql.DB, error) {
+	// sql.Open only looks up the driver, it does not connect
+	probe, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := probe.Driver()
+	probe.Close()
+
+	var connector driver.Connector = dsnConnector{dsn: dsn, driver: drv}
+	if opener, ok := drv.(driver.DriverContext); ok {
+		if connector, err = opener.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(requestIDConnector{connector}), nil
+}
+
+// tagQuery - query with the request ID of ctx appended as a comment
+func tagQuery(ctx context.Context, query string) string {
+	id := logging.RequestID(ctx)
+	if !logging.ValidRequestID(id) {
+		return query
+	}
+	return query + "\n/*request_id='" + id + "'*/"
+}
+
+// dsnConnector - Connector for drivers that do not provide one
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type requestIDConnector struct {
+	driver.Connector
+}
+
+func (c requestIDConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &requestIDConn{Conn: conn}, nil
+}
+
+// requestIDConn - Tags the queries of a driver connection and passes
+// everything else through. Interfaces the driver lacks report ErrSkip (or
+// their neutral answer), so database/sql falls back as it would without
+// the wrapper.
+type requestIDConn struct {
+	driver.Conn
+}
+
+func (c *requestIDConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query = tagQuery(ctx, query)
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *requestIDConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *requestIDConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return execer.ExecContext(ctx, tagQuery(ctx, query), args)
+}
+
+func (c *requestIDConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return queryer.QueryContext(ctx, tagQuery(ctx, query), args)
+}
+
+func (c *requestIDConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *requestIDConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *requestIDConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *requestIDConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/logging"
+)
+
+func TestTagQuery(t *testing.T) {
+	query := "SELECT id FROM books WHERE id = $1"
+	if got := tagQuery(context.Background(), query); got != query {
+		t.Fatalf("without request ID: %q", got)
+	}
+
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	if got, want := tagQuery(ctx, query), query+"\n/*request_id='req-1'*/"; got != want {
+		t.Fatalf("tagQuery = %q, want %q", got, want)
+	}
+
+	// An ID that could end the comment is left out
+	ctx = logging.WithRequestID(context.Background(), "x'*/; DROP TABLE books; --")
+	if got := tagQuery(ctx, query); got != query {
+		t.Fatalf("with an unsafe request ID: %q", got)
+	}
+}
+
+func TestTaggedQueriesRun(t *testing.T) {
+	db, err := openDB("sqlite", t.TempDir()+"/tagged.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+
+	if _, err := db.ExecContext(ctx, "CREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO books (title) VALUES ($1)", "Laskar Pelangi"); err != nil {
+		t.Fatal(err)
+	}
+	var title string
+	if err := db.QueryRowContext(ctx, "SELECT title FROM books WHERE id = $1", 1).Scan(&title); err != nil || title != "Laskar Pelangi" {
+		t.Fatalf("title = %q, %v", title, err)
+	}
+
+	// Prepared statements and transactions go through the wrapper as well
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := tx.PrepareContext(ctx, "UPDATE books SET title = $1 WHERE id = $2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.ExecContext(ctx, "Sang Pemimpi", 1); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT title FROM books WHERE id = 1").Scan(&title); err != nil || title != "Sang Pemimpi" {
+		t.Fatalf("title after update = %q, %v", title, err)
+	}
+}
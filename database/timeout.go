@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// QueryTimeout - How long queries of an endpoint group may run:
+// DB_QUERY_TIMEOUT_<NAME> (e.g. DB_QUERY_TIMEOUT_BOOKS=2s), falling back
+// to DB_QUERY_TIMEOUT (default 5s). Zero disables the timeout.
+func QueryTimeout(name string) time.Duration {
+	cfg := config.Current.Database
+	if d, ok := cfg.QueryTimeouts[strings.ToLower(name)]; ok {
+		return d
+	}
+	return cfg.QueryTimeout
+}
+
+// WithQueryTimeout - Derive a context bounded by the timeout of the group
+func WithQueryTimeout(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	if timeout := QueryTimeout(name); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,87 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+)
+
+// withQueryTimeouts - Use the default and per-group timeouts for the test
+func withQueryTimeouts(t *testing.T, fallback time.Duration, groups map[string]time.Duration) {
+	t.Helper()
+	previous := config.Current.Database
+	config.Current.Database.QueryTimeout = fallback
+	config.Current.Database.QueryTimeouts = groups
+	t.Cleanup(func() { config.Current.Database = previous })
+}
+
+func TestQueryTimeout(t *testing.T) {
+	withQueryTimeouts(t, 5*time.Second, map[string]time.Duration{"books": 2 * time.Second, "admin": 0})
+
+	for group, want := range map[string]time.Duration{"books": 2 * time.Second, "BOOKS": 2 * time.Second, "admin": 0, "auth": 5 * time.Second} {
+		if got := database.QueryTimeout(group); got != want {
+			t.Errorf("QueryTimeout(%q) = %v, want %v", group, got, want)
+		}
+	}
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	withQueryTimeouts(t, 5*time.Second, map[string]time.Duration{"admin": 0})
+
+	ctx, cancel := database.WithQueryTimeout(context.Background(), "books")
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > 5*time.Second || time.Until(deadline) < 4*time.Second {
+		t.Fatalf("deadline = %v, %v; want in 5s", deadline, ok)
+	}
+
+	// Zero disables the timeout, the context can still be cancelled
+	ctx, cancel = database.WithQueryTimeout(context.Background(), "admin")
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("deadline set for a group without timeout")
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Fatal("cancel did not cancel")
+	}
+}
+
+func TestIsTimeoutAndIsCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	timedOut := fmt.Errorf("query: %w", ctx.Err())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	canceled := fmt.Errorf("query: %w", ctx.Err())
+
+	if !database.IsTimeout(timedOut) || database.IsCanceled(timedOut) {
+		t.Error("deadline not classified as timeout")
+	}
+	if database.IsTimeout(canceled) || !database.IsCanceled(canceled) {
+		t.Error("cancellation not classified as canceled")
+	}
+	if other := errors.New("connection refused"); database.IsTimeout(other) || database.IsCanceled(other) {
+		t.Error("other error classified as timeout or cancellation")
+	}
+}
+
+func TestQueriesStopAtDeadline(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+
+		_, err := database.DB.QueryContext(ctx, "SELECT 1")
+		if !database.IsTimeout(err) {
+			t.Fatalf("query after the deadline: err = %v, want a timeout", err)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+)
+
+// countCategories - Number of categories named name
+func countCategories(t *testing.T, name string) int {
+	t.Helper()
+	var n int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM categories WHERE name = $1", name).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWithTxCommitsAndRollsBack(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		insert := func(name string, result error) error {
+			return database.WithTx(ctx, database.DB, nil, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO categories (name) VALUES ($1)", name); err != nil {
+					return err
+				}
+				return result
+			})
+		}
+
+		if err := insert("Fiksi", nil); err != nil {
+			t.Fatal(err)
+		}
+		failure := errors.New("validation failed")
+		if err := insert("Sejarah", failure); !errors.Is(err, failure) {
+			t.Fatalf("WithTx err = %v, want the error of fn", err)
+		}
+		if countCategories(t, "Fiksi") != 1 || countCategories(t, "Sejarah") != 0 {
+			t.Fatal("want the first transaction committed and the second rolled back")
+		}
+	})
+}
+
+func TestWithTxRetries(t *testing.T) {
+	dbtest.Open(t, "sqlite")
+	ctx := context.Background()
+
+	retryable := map[string]error{
+		"serialization failure": &pq.Error{Code: "40001"},
+		"postgres deadlock":     &pq.Error{Code: "40P01"},
+		"mysql deadlock":        &mysql.MySQLError{Number: 1213},
+	}
+	for name, abort := range retryable {
+		calls := 0
+		err := database.WithTx(ctx, database.DB, nil, func(tx *sql.Tx) error {
+			if calls++; calls < 3 {
+				return abort
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("%s: WithTx = %v after %d calls, want success on the third", name, err, calls)
+		}
+	}
+
+	// Gives up after four attempts
+	calls := 0
+	err := database.WithTx(ctx, database.DB, nil, func(tx *sql.Tx) error {
+		calls++
+		return &pq.Error{Code: "40001"}
+	})
+	if !database.IsRetryable(err) || calls != 4 {
+		t.Errorf("WithTx = %v after %d calls, want the serialization failure after 4", err, calls)
+	}
+
+	// Other errors are returned at once
+	calls = 0
+	err = database.WithTx(ctx, database.DB, nil, func(tx *sql.Tx) error {
+		calls++
+		return &pq.Error{Code: "23505"}
+	})
+	if !database.IsUniqueViolation(err) || calls != 1 {
+		t.Errorf("WithTx = %v after %d calls, want the unique violation after 1", err, calls)
+	}
+}
+
+func TestWithTxStopsRetryingWhenCanceled(t *testing.T) {
+	dbtest.Open(t, "sqlite")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := database.WithTx(ctx, database.DB, nil, func(tx *sql.Tx) error {
+		calls++
+		cancel()
+		return &pq.Error{Code: "40001"}
+	})
+	if !database.IsCanceled(err) || calls != 1 {
+		t.Fatalf("WithTx = %v after %d calls, want canceled after 1", err, calls)
+	}
+}
@@ -0,0 +1,37 @@
+package lifecycle
+
+import "sync/atomic"
+
+// State - Where the process is in its life, as reported by the health checks
+type State int32
+
+const (
+	// Starting - Listening, but migrations or setup are still running
+	Starting State = iota
+	// Ready - Serving the API
+	Ready
+	// Draining - Shutting down, in-flight requests are finishing
+	Draining
+)
+
+var current atomic.Int32
+
+// Set - Move the process to state
+func Set(state State) {
+	current.Store(int32(state))
+}
+
+// Current - The state the process is in
+func Current() State {
+	return State(current.Load())
+}
+
+func (s State) String() string {
+	switch s {
+	case Ready:
+		return "ready"
+	case Draining:
+		return "shutting_down"
+	}
+	return "starting"
+}
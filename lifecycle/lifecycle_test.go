@@ -0,0 +1,17 @@
+package lifecycle
+
+import "testing"
+
+func TestState(t *testing.T) {
+	t.Cleanup(func() { Set(Starting) })
+
+	if Current() != Starting {
+		t.Fatalf("initial state = %s, want starting", Current())
+	}
+	for state, name := range map[State]string{Starting: "starting", Ready: "ready", Draining: "shutting_down"} {
+		Set(state)
+		if Current() != state || Current().String() != name {
+			t.Errorf("after Set(%d): Current = %s, want %s", state, Current(), name)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// level - Minimum level of the default logger, changeable while running
+var level = new(slog.LevelVar)
+
+// Init - Make slog's default logger write JSON (LOG_FORMAT=text for
+// key=value lines) to stderr at LOG_LEVEL. Anything still using the log
+// package goes through it at info level. Invalid settings fall back to the
+// defaults; config.Validate reports them.
+func Init(cfg config.Log) {
+	SetLevel(cfg.Level)
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, cfg.Format)))
+}
+
+// NewHandler - JSON or text handler on w that adds the attributes carried
+// by the context (request ID, ...) to every record
+func NewHandler(w io.Writer, format string) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(format, "text") {
+		return contextHandler{slog.NewTextHandler(w, options)}
+	}
+	return contextHandler{slog.NewJSONHandler(w, options)}
+}
+
+// Level - Current minimum level
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel - Change the minimum level (debug, info, warn or error)
+func SetLevel(name string) error {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+	}
+	level.Set(parsed)
+	return nil
+}
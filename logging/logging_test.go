@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// withLevel - Restore the minimum level when the test ends
+func withLevel(t *testing.T) {
+	t.Helper()
+	previous := level.Level()
+	t.Cleanup(func() { level.Set(previous) })
+}
+
+func TestSetLevel(t *testing.T) {
+	withLevel(t)
+
+	for _, tc := range []struct {
+		name string
+		want slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"error", slog.LevelError},
+	} {
+		if err := SetLevel(tc.name); err != nil || Level() != tc.want {
+			t.Errorf("SetLevel(%q) = %v, level %s; want %s", tc.name, err, Level(), tc.want)
+		}
+	}
+
+	if err := SetLevel("verbose"); err == nil || Level() != slog.LevelError {
+		t.Fatalf("SetLevel(verbose) = %v, level %s; want an error and the level unchanged", err, Level())
+	}
+}
+
+func TestHandlerAddsContextAttributes(t *testing.T) {
+	withLevel(t)
+	SetLevel("info")
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, "json"))
+
+	ctx := With(WithRequestID(context.Background(), "req-1"), slog.String("job", "seed"))
+	logger.InfoContext(ctx, "Seeding", "books", 3)
+	logger.DebugContext(ctx, "Not logged at info")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("one JSON record expected, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "Seeding" || record["request_id"] != "req-1" || record["job"] != "seed" || record["books"] != float64(3) {
+		t.Fatalf("record = %v, want the context attributes added", record)
+	}
+	if RequestID(ctx) != "req-1" || RequestID(context.Background()) != "" {
+		t.Fatal("RequestID does not return the stored ID")
+	}
+
+	buf.Reset()
+	slog.New(NewHandler(&buf, "TEXT")).InfoContext(ctx, "Seeding")
+	if line := buf.String(); !strings.Contains(line, "msg=Seeding") || !strings.Contains(line, "request_id=req-1") {
+		t.Fatalf("text line = %q", line)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	first, second := NewRequestID(), NewRequestID()
+	if len(first) != 32 || first == second || !ValidRequestID(first) {
+		t.Fatalf("NewRequestID = %q, %q; want distinct valid 32 character IDs", first, second)
+	}
+
+	for id, valid := range map[string]bool{
+		"abc-123_x.y":            true,
+		strings.Repeat("a", 64):  true,
+		"":                       false,
+		strings.Repeat("a", 65):  false,
+		"id with spaces":         false,
+		"x'*/; DROP TABLE users": false,
+		"line\nbreak":            false,
+	} {
+		if ValidRequestID(id) != valid {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", id, !valid, valid)
+		}
+	}
+}
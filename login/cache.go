@@ -0,0 +1,99 @@
+package login
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+// CredentialCache - Recently verified Basic auth credentials so bcrypt is
+// not paid on every request. Passwords are kept only as an HMAC under a
+// per-process random key, together with the password hash they were
+// checked against: once the stored hash changes (password change or
+// reset, create-admin, also from another instance) the entry no longer
+// matches. Callers still load the account for each request, so locks and
+// role changes apply without waiting for the entry to expire.
+type CredentialCache struct {
+	mu      sync.Mutex
+	key     []byte
+	entries map[string]cachedCredential
+}
+
+type cachedCredential struct {
+	userID    int
+	digest    []byte
+	expiresAt time.Time
+}
+
+// Credentials - Basic auth credentials verified by this process
+var Credentials = NewCredentialCache()
+
+// NewCredentialCache - Empty cache with a fresh key
+func NewCredentialCache() *CredentialCache {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &CredentialCache{key: key, entries: make(map[string]cachedCredential)}
+}
+
+func (cc *CredentialCache) digest(username, password, passwordHash string) []byte {
+	mac := hmac.New(sha256.New, cc.key)
+	mac.Write([]byte(username + "\x00" + password + "\x00" + passwordHash))
+	return mac.Sum(nil)
+}
+
+// Contains - Whether username has an unexpired entry (worth loading the
+// account for Match)
+func (cc *CredentialCache) Contains(username string) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	entry, ok := cc.entries[username]
+	return ok && time.Now().Before(entry.expiresAt)
+}
+
+// Match - Whether password was verified for user (loaded with its password
+// hash) and the entry has not expired
+func (cc *CredentialCache) Match(user models.User, password string) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	entry, ok := cc.entries[user.Username]
+	return ok && entry.userID == user.ID && time.Now().Before(entry.expiresAt) &&
+		hmac.Equal(entry.digest, cc.digest(user.Username, password, user.Password))
+}
+
+// Remember - Keep password of user (loaded with its password hash) for ttl
+func (cc *CredentialCache) Remember(user models.User, password string, ttl time.Duration) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	now := time.Now()
+	if len(cc.entries) >= 1000 {
+		for name, entry := range cc.entries {
+			if now.After(entry.expiresAt) {
+				delete(cc.entries, name)
+			}
+		}
+	}
+	cc.entries[user.Username] = cachedCredential{
+		userID:    user.ID,
+		digest:    cc.digest(user.Username, password, user.Password),
+		expiresAt: now.Add(ttl),
+	}
+}
+
+// ForgetUser - Drop the entry of a user whose password, lock or role changed
+func (cc *CredentialCache) ForgetUser(userID int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for name, entry := range cc.entries {
+		if entry.userID == userID {
+			delete(cc.entries, name)
+		}
+	}
+}
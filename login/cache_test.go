@@ -0,0 +1,53 @@
+package login
+
+import (
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+func TestCredentialCache(t *testing.T) {
+	cc := NewCredentialCache()
+	user := models.User{ID: 1, Username: "budi", Password: "hash-1"}
+
+	if cc.Contains("budi") || cc.Match(user, "secret") {
+		t.Fatal("empty cache matched")
+	}
+	cc.Remember(user, "secret", time.Minute)
+	if !cc.Contains("budi") || !cc.Match(user, "secret") {
+		t.Fatal("remembered credentials did not match")
+	}
+	if cc.Match(user, "Secret") {
+		t.Fatal("other password matched")
+	}
+
+	// A new password hash (changed elsewhere) invalidates the entry
+	changed := user
+	changed.Password = "hash-2"
+	if cc.Match(changed, "secret") {
+		t.Fatal("entry matched after the password hash changed")
+	}
+
+	// So does a new account with the same name
+	recreated := user
+	recreated.ID = 2
+	if cc.Match(recreated, "secret") {
+		t.Fatal("entry matched another account with the same username")
+	}
+
+	cc.ForgetUser(1)
+	if cc.Contains("budi") || cc.Match(user, "secret") {
+		t.Fatal("forgotten user still cached")
+	}
+}
+
+func TestCredentialCacheExpiry(t *testing.T) {
+	cc := NewCredentialCache()
+	user := models.User{ID: 1, Username: "budi", Password: "hash"}
+
+	cc.Remember(user, "secret", -time.Second)
+	if cc.Contains("budi") || cc.Match(user, "secret") {
+		t.Fatal("expired entry matched")
+	}
+}
@@ -0,0 +1,126 @@
+// Package login - Password verification shared by everything that accepts
+// a username and password: backoff for failed attempts, the account
+// lockout counter, the audit trail and the Basic auth credential cache
+package login
+
+import (
+	"sync"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// Guard - In-memory failed login tracking with exponential backoff,
+// keyed per username and per client IP
+type Guard struct {
+	mu      sync.Mutex
+	records map[string]*attemptRecord
+}
+
+type attemptRecord struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// Settings - The brute-force protection settings in effect
+type Settings struct {
+	UserFreeAttempts int
+	IPFreeAttempts   int
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	Window           time.Duration
+	LockThreshold    int
+	LockDuration     time.Duration
+}
+
+// Attempts - Failed attempts of this process
+var Attempts = NewGuard()
+
+// NewGuard - Guard without recorded failures
+func NewGuard() *Guard {
+	return &Guard{records: make(map[string]*attemptRecord)}
+}
+
+// CurrentSettings - Settings from config.Current.Login
+func CurrentSettings() Settings {
+	cfg := config.Current.Login
+	return Settings{
+		UserFreeAttempts: cfg.BackoffFreeAttempts,
+		IPFreeAttempts:   cfg.IPFreeAttempts,
+		BackoffBase:      cfg.BackoffBase,
+		BackoffMax:       cfg.BackoffMax,
+		Window:           cfg.AttemptWindow,
+		LockThreshold:    cfg.LockThreshold,
+		LockDuration:     cfg.LockDuration,
+	}
+}
+
+// UserKey - Guard key of a username
+func UserKey(username string) string { return "user:" + username }
+
+// IPKey - Guard key of a client IP
+func IPKey(ip string) string { return "ip:" + ip }
+
+// RetryAfter - Remaining backoff for any of the keys (0 when allowed)
+func (g *Guard) RetryAfter(keys ...string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		if rec, ok := g.records[key]; ok {
+			if d := rec.blockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Fail - Record a failed attempt and compute the next backoff
+func (g *Guard) Fail(key string, freeAttempts int) {
+	cfg := CurrentSettings()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if len(g.records) > 10000 {
+		g.prune(now, cfg.Window)
+	}
+
+	rec, ok := g.records[key]
+	if !ok || now.Sub(rec.lastFailure) > cfg.Window {
+		rec = &attemptRecord{}
+		g.records[key] = rec
+	}
+	rec.failures++
+	rec.lastFailure = now
+
+	if over := rec.failures - freeAttempts; over > 0 {
+		delay := cfg.BackoffMax
+		if over < 31 {
+			if d := cfg.BackoffBase << (over - 1); d > 0 && d < cfg.BackoffMax {
+				delay = d
+			}
+		}
+		rec.blockedUntil = now.Add(delay)
+	}
+}
+
+// Reset - Forget the failures for a key (successful login or admin unlock)
+func (g *Guard) Reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.records, key)
+}
+
+func (g *Guard) prune(now time.Time, window time.Duration) {
+	for key, rec := range g.records {
+		if now.Sub(rec.lastFailure) > window && now.After(rec.blockedUntil) {
+			delete(g.records, key)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package login
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// withSettings - Use login for the test, with a clean guard, and restore
+// the previous state afterwards
+func withSettings(t *testing.T, login config.Login) {
+	t.Helper()
+	previousConfig, previousGuard := config.Current.Login, Attempts
+	config.Current.Login = login
+	Attempts = NewGuard()
+	t.Cleanup(func() { config.Current.Login, Attempts = previousConfig, previousGuard })
+}
+
+func TestGuardBackoff(t *testing.T) {
+	withSettings(t, config.Login{BackoffBase: time.Second, BackoffMax: 10 * time.Second, AttemptWindow: time.Hour})
+	g := NewGuard()
+
+	g.Fail("k", 2)
+	g.Fail("k", 2)
+	if wait := g.RetryAfter("k"); wait != 0 {
+		t.Fatalf("backoff within the free attempts: %v", wait)
+	}
+
+	// Doubling from the base, capped at the maximum
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		g.Fail("k", 2)
+		if wait := g.RetryAfter("other", "k"); wait <= want-time.Second/2 || wait > want {
+			t.Fatalf("failure %d: backoff %v, want about %v", i+3, wait, want)
+		}
+	}
+
+	g.Reset("k")
+	if wait := g.RetryAfter("k"); wait != 0 {
+		t.Fatalf("backoff after reset: %v", wait)
+	}
+}
+
+func TestGuardWindow(t *testing.T) {
+	withSettings(t, config.Login{BackoffBase: time.Minute, BackoffMax: time.Hour, AttemptWindow: time.Millisecond})
+	g := NewGuard()
+
+	g.Fail("k", 1)
+	time.Sleep(5 * time.Millisecond)
+	// The earlier failure fell out of the window, this is the first again
+	g.Fail("k", 1)
+	if wait := g.RetryAfter("k"); wait != 0 {
+		t.Fatalf("backoff %v, want none after the window passed", wait)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	if UserKey("10.0.0.1") == IPKey("10.0.0.1") {
+		t.Fatal("a username that looks like an IP shares the IP's key")
+	}
+}
+
+type verifyTest struct {
+	repos    *repository.Repositories
+	verifier *Verifier
+}
+
+func newVerifyTest(t *testing.T) *verifyTest {
+	t.Helper()
+	repos := repository.NewMemory()
+	previousEvents := audit.Events
+	audit.Events = repos.SecurityEvents
+	t.Cleanup(func() { audit.Events = previousEvents })
+	return &verifyTest{repos: repos, verifier: NewVerifier(repos.Users)}
+}
+
+func (v *verifyTest) createUser(t *testing.T, username, password string) models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: username, Password: string(hash), Role: "user", CreatedBy: "test"}
+	if err := v.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func (v *verifyTest) verify(username, password string) (models.User, error) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	return v.verifier.Verify(c, "test", username, password)
+}
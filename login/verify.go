@@ -0,0 +1,124 @@
+package login
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+// ErrInvalidCredentials - Unknown username or wrong password
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// RetryError - The username or client IP is in backoff, or the account is
+// locked; the attempt was not checked
+type RetryError struct {
+	Wait time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return "too many failed login attempts"
+}
+
+// Verifier - Checks a username and password the same way for every login
+// method
+type Verifier struct {
+	users repository.UserRepository
+}
+
+// NewVerifier - Verifier on the given user storage
+func NewVerifier(users repository.UserRepository) *Verifier {
+	return &Verifier{users: users}
+}
+
+// Verify - The user if password is theirs. Returns a *RetryError while the
+// username or client IP is in backoff or the account is locked,
+// ErrInvalidCredentials for an unknown username or a wrong password, or
+// the storage error. Failures and denials are recorded as login events
+// with method in the details; success is left to the caller, which may
+// still refuse the login or ask for a second factor.
+func (v *Verifier) Verify(c *gin.Context, method, username, password string) (models.User, error) {
+	cfg := CurrentSettings()
+	clientIP := c.ClientIP()
+	ctx := c.Request.Context()
+
+	// Reject early while the username or IP is in backoff
+	if wait := Attempts.RetryAfter(UserKey(username), IPKey(clientIP)); wait > 0 {
+		audit.Record(c, audit.EventLogin, audit.Denied, audit.Event{Username: username, Details: details("backoff active", method)})
+		return models.User{}, &RetryError{Wait: wait}
+	}
+
+	user, err := v.users.GetByUsername(ctx, username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return models.User{}, err
+	}
+	if err != nil {
+		// Spend the same bcrypt work as for a known user, so the response
+		// time does not tell which usernames exist
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		Attempts.Fail(UserKey(username), cfg.UserFreeAttempts)
+		Attempts.Fail(IPKey(clientIP), cfg.IPFreeAttempts)
+		audit.Record(c, audit.EventLogin, audit.Failure, audit.Event{Username: username, Details: details("unknown user", method)})
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	// Account is temporarily locked
+	if user.LockedFor > 0 {
+		audit.Record(c, audit.EventLogin, audit.Denied, audit.Event{UserID: user.ID, Username: user.Username, Details: details("account locked", method)})
+		return models.User{}, &RetryError{Wait: user.LockedFor}
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		Attempts.Fail(UserKey(username), cfg.UserFreeAttempts)
+		Attempts.Fail(IPKey(clientIP), cfg.IPFreeAttempts)
+
+		// Lock the account once consecutive failures reach the threshold.
+		// Without the counter there is no lockout, so a failed write fails
+		// the request instead of letting the guessing go on unnoticed.
+		if err := v.users.RecordFailedLogin(ctx, user.ID, cfg.LockThreshold, cfg.LockDuration); err != nil {
+			return models.User{}, err
+		}
+
+		audit.Record(c, audit.EventLogin, audit.Failure, audit.Event{UserID: user.ID, Username: user.Username, Details: details("invalid password", method)})
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	Attempts.Reset(UserKey(username))
+	if err := v.users.ResetFailedLogins(ctx, user.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to reset failed login counter", "user_id", user.ID, "error", err)
+	}
+	return user, nil
+}
+
+// TooManyAttempts - 429 response telling the client when to retry
+func TooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts, try again later",
+		"retry_after": seconds,
+	})
+}
+
+func details(reason, method string) string {
+	return reason + ", method=" + method
+}
+
+// dummyHash - bcrypt hash (at the cost real hashes use) compared against
+// when the username does not exist
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
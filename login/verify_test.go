@@ -0,0 +1,132 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestVerify(t *testing.T) {
+	withSettings(t, config.Default().Login)
+	v := newVerifyTest(t)
+	created := v.createUser(t, "budi", "correct horse")
+
+	user, err := v.verify("budi", "correct horse")
+	if err != nil || user.ID != created.ID {
+		t.Fatalf("Verify = %+v, %v; want budi", user, err)
+	}
+	if _, err := v.verify("budi", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: err = %v", err)
+	}
+	if _, err := v.verify("nobody", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user: err = %v", err)
+	}
+
+	events, err := v.repos.SecurityEvents.List(context.Background(), repository.SecurityEventFilter{EventType: audit.EventLogin, Outcome: audit.Failure, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Details == nil || *events[0].Details != "unknown user, method=test" {
+		t.Fatalf("failure events = %+v", events)
+	}
+}
+
+func TestVerifyLockout(t *testing.T) {
+	withSettings(t, config.Login{
+		BackoffFreeAttempts: 100,
+		IPFreeAttempts:      100,
+		BackoffBase:         time.Second,
+		BackoffMax:          time.Minute,
+		AttemptWindow:       time.Hour,
+		LockThreshold:       2,
+		LockDuration:        time.Hour,
+	})
+	v := newVerifyTest(t)
+	v.createUser(t, "budi", "correct horse")
+
+	for i := 0; i < 2; i++ {
+		if _, err := v.verify("budi", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v", i+1, err)
+		}
+	}
+	var retry *RetryError
+	if _, err := v.verify("budi", "correct horse"); !errors.As(err, &retry) || retry.Wait <= 59*time.Minute {
+		t.Fatalf("locked account: err = %v, want a RetryError of about an hour", err)
+	}
+}
+
+func TestVerifyBackoff(t *testing.T) {
+	withSettings(t, config.Login{
+		BackoffFreeAttempts: 1,
+		IPFreeAttempts:      100,
+		BackoffBase:         time.Minute,
+		BackoffMax:          time.Hour,
+		AttemptWindow:       time.Hour,
+		LockThreshold:       100,
+		LockDuration:        time.Hour,
+	})
+	v := newVerifyTest(t)
+	v.createUser(t, "budi", "correct horse")
+
+	v.verify("budi", "wrong")
+	v.verify("budi", "wrong")
+	var retry *RetryError
+	if _, err := v.verify("budi", "correct horse"); !errors.As(err, &retry) {
+		t.Fatalf("during backoff: err = %v, want a RetryError", err)
+	}
+
+	// Success clears the username's backoff
+	Attempts.Reset(UserKey("budi"))
+	if _, err := v.verify("budi", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if wait := Attempts.RetryAfter(UserKey("budi")); wait != 0 {
+		t.Fatalf("backoff %v after a successful login", wait)
+	}
+}
+
+// failingUsers - User storage whose failed login counter cannot be written
+type failingUsers struct {
+	repository.UserRepository
+}
+
+func (failingUsers) RecordFailedLogin(ctx context.Context, id, threshold int, lockFor time.Duration) error {
+	return errors.New("disk full")
+}
+
+func TestVerifyFailsClosed(t *testing.T) {
+	withSettings(t, config.Default().Login)
+	v := newVerifyTest(t)
+	v.createUser(t, "budi", "correct horse")
+	v.verifier = NewVerifier(failingUsers{v.repos.Users})
+
+	if _, err := v.verify("budi", "wrong"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want the storage error", err)
+	}
+}
+
+func TestTooManyAttempts(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	TooManyAttempts(c, 1500*time.Millisecond)
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" || !c.IsAborted() {
+		t.Fatalf("status %d, Retry-After %q, aborted %v", w.Code, w.Header().Get("Retry-After"), c.IsAborted())
+	}
+}
+
+func TestDummyHashCost(t *testing.T) {
+	// Unknown users cost as much bcrypt work as known ones
+	if cost, err := bcrypt.Cost(dummyHash()); err != nil || cost != bcrypt.DefaultCost {
+		t.Fatalf("dummy hash cost = %d, %v; want %d", cost, err, bcrypt.DefaultCost)
+	}
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+func TestNew(t *testing.T) {
+	if _, ok := New(config.Mail{Driver: "smtp"}).(*SMTPMailer); !ok {
+		t.Error("smtp driver is not an SMTPMailer")
+	}
+	if m, ok := New(config.Mail{Driver: "file", File: "mail.log"}).(*FileMailer); !ok || m.Path != "mail.log" {
+		t.Error("file driver is not a FileMailer on MAIL_FILE")
+	}
+	for _, driver := range []string{"log", ""} {
+		if _, ok := New(config.Mail{Driver: driver}).(*LogMailer); !ok {
+			t.Errorf("driver %q is not a LogMailer", driver)
+		}
+	}
+}
+
+func TestFileMailerAppends(t *testing.T) {
+	path := t.TempDir() + "/mail.log"
+	m := &FileMailer{Path: path}
+
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		if err := m.Send(Message{To: to, Subject: "Password reset", Body: "token"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.Contains(got, "To: a@example.com\nSubject: Password reset\n\ntoken") || !strings.Contains(got, "To: b@example.com") {
+		t.Fatalf("mail file = %q, want both messages", got)
+	}
+
+	// Reset tokens are in there: nobody else may read the file
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("mail file mode = %v, want 0600", perm)
+	}
+}
+
+func TestSMTPMailerRequiresServer(t *testing.T) {
+	m := &SMTPMailer{From: "books@example.com"}
+	if err := m.Send(Message{To: "a@example.com"}); err == nil {
+		t.Fatal("Send without SMTP_HOST succeeded")
+	}
+}
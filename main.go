@@ -1,71 +1,213 @@
 package main
 
 import (
-    "log"
-    "os"
-    "github.com/gin-gonic/gin"
-    "mini-project-buku-sb-go-73-Agil/controllers"
-    "mini-project-buku-sb-go-73-Agil/middleware"
-    "mini-project-buku-sb-go-73-Agil/database"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/controllers"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/lifecycle"
+	"mini-project-buku-sb-go-73-Agil/logging"
+	"mini-project-buku-sb-go-73-Agil/mailer"
+	"mini-project-buku-sb-go-73-Agil/middleware"
+	"mini-project-buku-sb-go-73-Agil/oidc"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 func main() {
-    // Initialize database (auto-creates tables)
-    if err := database.ConnectDB(); err != nil {
-        log.Fatal("Failed to connect to database:", err)
-    }
-
-    // Initialize router
-    r := gin.Default()
-
-    // Public routes
-    r.POST("/api/users/login", controllers.Login)
-    r.POST("/api/users/register", controllers.Register) // Optional
-
-    // Protected routes with JWT middleware
-    api := r.Group("/api")
-    api.Use(middleware.JWTAuthMiddleware())
-    {
-        // Categories routes
-        categories := api.Group("/categories")
-        {
-            categories.GET("", controllers.GetCategories)
-            categories.POST("", controllers.CreateCategory)
-            categories.GET("/:id", controllers.GetCategoryByID)
-            categories.DELETE("/:id", controllers.DeleteCategory)
-            categories.GET("/:id/books", controllers.GetBooksByCategory)
-        }
-
-        // Books routes
-        books := api.Group("/books")
-        {
-            books.GET("", controllers.GetBooks)
-            books.POST("", controllers.CreateBook)
-            books.GET("/:id", controllers.GetBookByID)
-            books.PUT("/:id", controllers.UpdateBook)
-            books.DELETE("/:id", controllers.DeleteBook)
-        }
-    }
-
-    // Health check endpoint
-    r.GET("/health", func(c *gin.Context) {
-        c.JSON(200, gin.H{
-            "status": "OK",
-            "database": "connected",
-        })
-    })
-
-    // Start server
-    port := os.Getenv("PORT")
-    if port == "" {
-        port = os.Getenv("SERVER_PORT")
-    }
-    if port == "" {
-        port = "8080"
-    }
-    
-    log.Printf("Server starting on port %s\n", port)
-    if err := r.Run(":" + port); err != nil {
-        log.Fatal("Failed to start server:", err)
-    }
-}
\ No newline at end of file
+	// Settings from config.yaml, .env and the environment
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+
+	// JSON log lines at LOG_LEVEL (LOG_FORMAT=text for development)
+	logging.Init(cfg.Log)
+
+	// CLI subcommands, e.g. "migrate up"
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fatal("Command failed", err)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	// Listen right away so health checks get an answer while migrations
+	// run; every request gets 503 until the API is ready
+	app := &appHandler{}
+	srv := newServer(cfg.Server, app)
+	slog.Info("Server starting", "port", cfg.Server.Port)
+	go listen(srv)
+
+	// SIGINT/SIGTERM start a graceful shutdown; a second one ends the
+	// process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Initialize database (applies pending migrations)
+	if err := database.ConnectDB(); err != nil {
+		fatal("Failed to connect to database", err)
+	}
+
+	// Token signing keys (JWT_ALGORITHM=HS256|RS256|EdDSA)
+	if err := auth.InitKeyring(cfg.JWT); err != nil {
+		fatal("Failed to initialize JWT keys", err)
+	}
+	auth.InitTokens(cfg.JWT)
+	stopRotation := make(chan struct{})
+	if cfg.JWT.RotationInterval > 0 {
+		auth.Keys.StartRotation(cfg.JWT.RotationInterval, stopRotation)
+	}
+
+	// Mail delivery for password reset (MAIL_DRIVER=log|file|smtp)
+	controllers.Mailer = mailer.New(cfg.Mail)
+
+	// Optional SSO login (OIDC_ISSUER_URL, OIDC_CLIENT_ID, ...)
+	controllers.OIDC = oidc.New(cfg.OIDC)
+
+	// Handlers get their data access through repositories; book and
+	// category reads use the replicas from DB_REPLICA_DSNS, if any
+	repos := repository.NewSQL(database.DB, database.Replicas)
+	audit.Events = repos.SecurityEvents
+	authn := middleware.NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions)
+	authHandler := controllers.NewAuthHandler(repos.Users, repos.TwoFactor, repos.PasswordResets, repos.Sessions)
+	apiKeyHandler := controllers.NewAPIKeyHandler(repos.APIKeys)
+	adminHandler := controllers.NewAdminHandler(repos.Users, repos.SecurityEvents)
+	bookHandler := controllers.NewBookHandler(repos.Books)
+	categoryHandler := controllers.NewCategoryHandler(repos.Categories, repos.Books)
+
+	// Initialize router. Every request gets an ID (X-Request-ID) and one
+	// log line; gin's own debug output goes to the log at debug level.
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)), "component", "gin")
+	}
+	r := gin.New()
+	// ClientIP (login throttling, audit log) believes X-Forwarded-For
+	// only from TRUSTED_PROXIES
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+	r.Use(middleware.RequestID(), middleware.RequestLogger(), middleware.Recovery())
+
+	// Every group's queries are bounded by DB_QUERY_TIMEOUT_<GROUP>
+	// (default DB_QUERY_TIMEOUT); timeouts answer 504
+	authTimeout := middleware.QueryTimeout("auth")
+
+	// Public routes
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+	r.POST("/api/users/login", authTimeout, authHandler.Login)
+	r.POST("/api/users/register", authTimeout, authHandler.Register) // Optional
+	r.POST("/api/users/password/forgot", authTimeout, authHandler.ForgotPassword)
+	r.POST("/api/users/password/reset", authTimeout, authHandler.ResetPassword)
+	r.POST("/api/users/login/2fa", authTimeout, authHandler.LoginTwoFactor)
+	r.GET("/api/users/oidc/login", authTimeout, authHandler.OIDCLogin)
+	r.GET("/api/users/oidc/callback", authTimeout, authHandler.OIDCCallback)
+
+	// Two-factor enrollment also accepts the token issued when 2FA is mandatory
+	twoFactor := r.Group("/api/users/me/2fa")
+	twoFactor.Use(authTimeout, authn.JWTAuthMiddleware(auth.PurposeEnroll))
+	{
+		twoFactor.POST("/enroll", authHandler.EnrollTwoFactor)
+		twoFactor.POST("/confirm", authHandler.ConfirmTwoFactor)
+	}
+
+	// Password change also accepts the token issued when a change is required
+	r.POST("/api/users/me/password", authTimeout, authn.JWTAuthMiddleware(auth.PurposePasswordChange), authHandler.ChangePassword)
+
+	// Protected routes. Groups listed in BASIC_AUTH_GROUPS also accept
+	// Basic auth against the users table for legacy tools.
+	basicAuthGroups := middleware.BasicAuthGroups()
+	groupAuth := func(name string) gin.HandlerFunc {
+		if basicAuthGroups[name] {
+			return authn.JWTOrBasicAuthMiddleware()
+		}
+		return authn.JWTAuthMiddleware()
+	}
+
+	api := r.Group("/api")
+	{
+		// Categories routes
+		categories := api.Group("/categories")
+		categories.Use(middleware.QueryTimeout("categories"), groupAuth("categories"), middleware.RequireScope("categories"), middleware.ReadYourWrites())
+		{
+			categories.GET("", categoryHandler.GetCategories)
+			categories.POST("", categoryHandler.CreateCategory)
+			categories.GET("/:id", categoryHandler.GetCategoryByID)
+			categories.DELETE("/:id", categoryHandler.DeleteCategory)
+			categories.GET("/:id/books", categoryHandler.GetBooksByCategory)
+		}
+
+		// Books routes
+		books := api.Group("/books")
+		books.Use(middleware.QueryTimeout("books"), groupAuth("books"), middleware.RequireScope("books"), middleware.ReadYourWrites())
+		{
+			books.GET("", bookHandler.GetBooks)
+			books.POST("", bookHandler.CreateBook)
+			books.GET("/:id", bookHandler.GetBookByID)
+			books.PUT("/:id", bookHandler.UpdateBook)
+			books.DELETE("/:id", bookHandler.DeleteBook)
+		}
+
+		// Current user account (API keys, 2FA, sessions)
+		account := api.Group("/users/me")
+		accountTimeout := middleware.QueryTimeout("account")
+		account.Use(accountTimeout, groupAuth("account"))
+		{
+			account.GET("/api-keys", apiKeyHandler.GetAPIKeys)
+			account.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+			account.DELETE("/api-keys/:id", apiKeyHandler.DeleteAPIKey)
+			account.POST("/2fa/disable", authHandler.DisableTwoFactor)
+			account.GET("/sessions", authHandler.GetSessions)
+			account.DELETE("/sessions/:id", authHandler.DeleteSession)
+		}
+		api.POST("/users/logout", accountTimeout, groupAuth("account"), authHandler.Logout)
+		api.POST("/users/token/refresh", accountTimeout, groupAuth("account"), authHandler.RefreshToken)
+
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(middleware.QueryTimeout("admin"), groupAuth("admin"), middleware.AdminOnly())
+		{
+			admin.POST("/users/:id/unlock", adminHandler.UnlockUser)
+			admin.GET("/security-events", adminHandler.GetSecurityEvents)
+			admin.GET("/db/stats", controllers.GetDBStats)
+			admin.GET("/log-level", controllers.GetLogLevel)
+			admin.PUT("/log-level", controllers.SetLogLevel)
+		}
+	}
+
+	// Probes: /livez (process up), /readyz (database reachable, schema
+	// migrated, not shutting down), /health (short readiness), /version
+	r.GET("/livez", controllers.Livez)
+	r.GET("/readyz", controllers.Readyz)
+	r.GET("/health", controllers.Health)
+	r.GET("/version", controllers.Version)
+
+	// Migrations are done and the routes are set up: start serving
+	app.Set(r)
+	lifecycle.Set(lifecycle.Ready)
+	slog.Info("Server ready")
+
+	<-ctx.Done()
+	stop()
+	shutdown(srv, cfg.Server.ShutdownTimeout, func() {
+		close(stopRotation)
+	})
+}
+
+// fatal - Log err and end the process
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
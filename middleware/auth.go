@@ -1,47 +1,230 @@
 package middleware
 
 import (
-    "net/http"
-    "os"
-    "strings"
-    "github.com/gin-gonic/gin"
-    "github.com/golang-jwt/jwt/v5"
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
 )
 
-func JWTAuthMiddleware() gin.HandlerFunc {
-    return func(c *gin.Context) {
-        authHeader := c.GetHeader("Authorization")
-        if authHeader == "" {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-            c.Abort()
-            return
-        }
-
-        tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-        token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-            return []byte(os.Getenv("JWT_SECRET")), nil
-        })
-
-        if err != nil || !token.Valid {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-            c.Abort()
-            return
-        }
-
-        claims, ok := token.Claims.(jwt.MapClaims)
-        if !ok {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-            c.Abort()
-            return
-        }
-
-        c.Set("username", claims["username"])
-        c.Next()
-    }
-}
-
-func BasicAuthMiddleware() gin.HandlerFunc {
-    return gin.BasicAuth(gin.Accounts{
-        "admin": "password123",
-    })
-}
\ No newline at end of file
+// Authenticator - Authentication middlewares, checking API keys, sessions
+// and Basic credentials against the repositories
+type Authenticator struct {
+	users    repository.UserRepository
+	apiKeys  repository.APIKeyRepository
+	sessions repository.SessionRepository
+	verifier *login.Verifier
+}
+
+// NewAuthenticator - Middlewares backed by the given repositories
+func NewAuthenticator(users repository.UserRepository, apiKeys repository.APIKeyRepository, sessions repository.SessionRepository) *Authenticator {
+	return &Authenticator{users: users, apiKeys: apiKeys, sessions: sessions, verifier: login.NewVerifier(users)}
+}
+
+// JWTAuthMiddleware - Authenticate with a Bearer JWT, an X-API-Key header
+// or a browser session cookie.
+// Restricted tokens (e.g. auth.PurposeEnroll) are only accepted when their
+// purpose is listed in allowedPurposes.
+func (a *Authenticator) JWTAuthMiddleware(allowedPurposes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			a.authenticateAPIKey(c, apiKey)
+			return
+		}
+		if c.GetHeader("Authorization") == "" {
+			if sessionToken, err := c.Cookie(auth.SessionCookie); err == nil && sessionToken != "" {
+				a.authenticateSession(c, sessionToken)
+				return
+			}
+		}
+
+		claims, err := auth.Tokens.ParseHeader(c.GetHeader("Authorization"))
+		if err == nil && claims.Purpose != "" && !containsString(allowedPurposes, claims.Purpose) {
+			err = auth.ErrTokenPurpose
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", auth.WWWAuthenticate(err))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		// A signed token stays valid until it expires unless the account
+		// was recovered since it was issued
+		revoked, err := a.users.TokenRevoked(c.Request.Context(), claims.UserID, claims.IssuedAt.Time)
+		if abortOnTimeout(c, err) {
+			return
+		}
+		if err != nil || revoked {
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				slog.ErrorContext(c.Request.Context(), "Token revocation lookup failed", "error", err)
+			}
+			c.Header("WWW-Authenticate", auth.WWWAuthenticate(auth.ErrTokenRevoked))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrTokenRevoked.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set("username", claims.Username)
+		c.Set("user_id", claims.UserID)
+		c.Set("role", claims.Role)
+		c.Set("auth_method", "jwt")
+		c.Set("token_purpose", claims.Purpose)
+		c.Next()
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Authenticator) authenticateAPIKey(c *gin.Context, apiKey string) {
+	key, user, err := a.apiKeys.Authenticate(c.Request.Context(), auth.HashAPIKey(apiKey))
+	if abortOnTimeout(c, err) {
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(c.Request.Context(), "API key lookup failed", "error", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+	if refuseAccount(c, user, "api_key") {
+		return
+	}
+
+	if err := a.apiKeys.Touch(c.Request.Context(), key.ID); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to record API key use", "api_key_id", key.ID, "error", err)
+	}
+
+	c.Set("username", user.Username)
+	c.Set("user_id", user.ID)
+	c.Set("role", user.Role)
+	c.Set("auth_method", "api_key")
+	c.Set("scopes", key.Scopes)
+	c.Next()
+}
+
+func (a *Authenticator) authenticateSession(c *gin.Context, sessionToken string) {
+	session, user, err := a.sessions.Authenticate(c.Request.Context(), auth.HashSessionToken(sessionToken))
+	if abortOnTimeout(c, err) {
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Session lookup failed", "error", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or invalid"})
+		c.Abort()
+		return
+	}
+	if refuseAccount(c, user, "session") {
+		return
+	}
+
+	// Double-submit CSRF check for state-changing requests: the header must
+	// match both the CSRF cookie and the token bound to the session
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		header := c.GetHeader(auth.CSRFHeader)
+		cookie, _ := c.Cookie(auth.CSRFCookie)
+		if header == "" ||
+			subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(header), []byte(session.CSRFToken)) != 1 {
+			c.Set("username", user.Username)
+			c.Set("user_id", user.ID)
+			audit.Record(c, audit.EventPermissionDenied, audit.Denied, audit.Event{Details: "csrf check failed: " + c.Request.Method + " " + c.FullPath()})
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+			c.Abort()
+			return
+		}
+	}
+
+	if err := a.sessions.Touch(c.Request.Context(), session.ID); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to record session use", "session_id", session.ID, "error", err)
+	}
+
+	c.Set("username", user.Username)
+	c.Set("user_id", user.ID)
+	c.Set("role", user.Role)
+	c.Set("auth_method", "session")
+	c.Set("session_id", session.ID)
+	c.Next()
+}
+
+// refuseAccount - Abort when the owner of an API key or session may not
+// use the API right now: the account is locked, or its password must be
+// changed first (which takes a password login, not the key or session)
+func refuseAccount(c *gin.Context, user models.User, method string) bool {
+	var reason, message string
+	switch {
+	case user.LockedFor > 0:
+		reason, message = "account locked", "Account is locked"
+	case user.MustChangePassword:
+		reason, message = "password change required", "Password must be changed before the API can be used"
+	default:
+		return false
+	}
+
+	c.Set("username", user.Username)
+	c.Set("user_id", user.ID)
+	audit.Record(c, audit.EventPermissionDenied, audit.Denied, audit.Event{Details: reason + " (" + method + "): " + c.Request.Method + " " + c.FullPath()})
+	c.JSON(http.StatusForbidden, gin.H{"error": message})
+	c.Abort()
+	return true
+}
+
+// RequireScope - Check the API key scope for a resource: GET/HEAD need
+// "<resource>:read", everything else "<resource>:write". JWT logins are
+// not scope-restricted.
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, restricted := c.Get("scopes")
+		if !restricted {
+			c.Next()
+			return
+		}
+
+		required := resource + ":write"
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			required = resource + ":read"
+		}
+
+		if !auth.ScopeAllows(granted.([]string), required) {
+			audit.Record(c, audit.EventPermissionDenied, audit.Denied, audit.Event{Details: "missing scope " + required + ": " + c.Request.Method + " " + c.FullPath()})
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing scope " + required})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminOnly - Allow only users with the admin role (use after JWTAuthMiddleware)
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		method, _ := c.Get("auth_method")
+		if role != "admin" || method == "api_key" {
+			audit.Record(c, audit.EventPermissionDenied, audit.Denied, audit.Event{Details: "admin required: " + c.Request.Method + " " + c.FullPath()})
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,273 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func bearerRequest(t *testing.T, userID int, username, purpose string) *http.Request {
+	t.Helper()
+	token, err := auth.Tokens.IssuePurpose(userID, username, "user", purpose, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTAuth(t *testing.T) {
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+
+	expectStatus(t, serve(router, bearerRequest(t, user.ID, user.Username, "")), http.StatusOK)
+	expectStatus(t, serve(router, httptest.NewRequest(http.MethodGet, "/protected", nil)), http.StatusUnauthorized)
+
+	// Restricted tokens need their purpose allowed
+	expectStatus(t, serve(router, bearerRequest(t, user.ID, user.Username, auth.PurposeMFA)), http.StatusUnauthorized)
+
+	// Tokens of deleted users are refused
+	expectStatus(t, serve(router, bearerRequest(t, user.ID+1, "ghost", "")), http.StatusUnauthorized)
+}
+
+func TestJWTAuthRevokedToken(t *testing.T) {
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	req := bearerRequest(t, user.ID, user.Username, "")
+
+	users := revokingUsers{UserRepository: repos.Users, validAfter: time.Now()}
+	router := protected(NewAuthenticator(users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+
+	w := serve(router, req)
+	expectStatus(t, w, http.StatusUnauthorized)
+	if got := w.Header().Get("WWW-Authenticate"); got == "" {
+		t.Fatal("revoked token without WWW-Authenticate")
+	}
+}
+
+func TestPasswordResetRevokesLogins(t *testing.T) {
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+
+	logins := map[string]*http.Request{
+		"Bearer token": bearerRequest(t, user.ID, user.Username, ""),
+		"session":      sessionRequest(t, repos, user.ID, http.MethodGet, false),
+		"API key":      apiKeyRequest(t, repos, user.ID),
+	}
+	for _, req := range logins {
+		expectStatus(t, serve(router, req), http.StatusOK)
+	}
+
+	// Whoever took over the account is signed out by the reset
+	ctx := context.Background()
+	if err := repos.PasswordResets.Create(ctx, user.ID, "reset-token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.PasswordResets.Reset(ctx, "reset-token", "new hash"); err != nil {
+		t.Fatal(err)
+	}
+	for name, req := range logins {
+		if w := serve(router, req); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s after the reset: status = %d, want 401", name, w.Code)
+		}
+	}
+}
+
+func apiKeyRequest(t *testing.T, repos *repository.Repositories, userID int) *http.Request {
+	t.Helper()
+	plain, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := models.APIKey{Name: "ci", Prefix: prefix, Scopes: []string{"books:read"}}
+	if err := repos.APIKeys.Create(context.Background(), userID, &key, hash, 0); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("X-API-Key", plain)
+	return req
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+	req := apiKeyRequest(t, repos, user.ID)
+
+	w := serve(router, req)
+	expectStatus(t, w, http.StatusOK)
+	if body := w.Body.String(); !strings.Contains(body, `"auth_method":"api_key"`) || !strings.Contains(body, `"username":"budi"`) {
+		t.Fatalf("body = %s, want budi by API key", body)
+	}
+	keys, err := repos.APIKeys.ListActive(ctx, user.ID)
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Fatalf("keys = %+v, %v; want the use recorded", keys, err)
+	}
+
+	unknown := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	unknown.Header.Set("X-API-Key", "bk_unknown")
+	expectStatus(t, serve(router, unknown), http.StatusUnauthorized)
+
+	if err := repos.APIKeys.Revoke(ctx, keys[0].ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, serve(router, req), http.StatusUnauthorized)
+}
+
+func TestRequireScope(t *testing.T) {
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware(), RequireScope("books"))
+
+	// The key only has books:read
+	read := apiKeyRequest(t, repos, user.ID)
+	expectStatus(t, serve(router, read), http.StatusOK)
+	write := httptest.NewRequest(http.MethodPost, "/protected", nil)
+	write.Header.Set("X-API-Key", read.Header.Get("X-API-Key"))
+	expectStatus(t, serve(router, write), http.StatusForbidden)
+
+	// Logins are not limited by scopes
+	expectStatus(t, serve(router, bearerRequest(t, user.ID, "budi", "")), http.StatusOK)
+	post := bearerRequest(t, user.ID, "budi", "")
+	post.Method = http.MethodPost
+	expectStatus(t, serve(router, post), http.StatusOK)
+}
+
+func TestAPIKeyAuthRefusesUnusableOwner(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+	req := apiKeyRequest(t, repos, user.ID)
+
+	expectStatus(t, serve(router, req), http.StatusOK)
+
+	// Locked owner
+	if err := repos.Users.RecordFailedLogin(ctx, user.ID, 1, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, serve(router, req), http.StatusForbidden)
+	if _, err := repos.Users.Unlock(ctx, user.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, serve(router, req), http.StatusOK)
+
+	// Owner who must change the password first
+	pending := storeUser(t, repos, models.User{Username: "sari", Role: "user", MustChangePassword: true}, "secret")
+	pendingReq := apiKeyRequest(t, repos, pending.ID)
+	expectStatus(t, serve(router, pendingReq), http.StatusForbidden)
+	if err := repos.Users.SetPassword(ctx, pending.ID, "y", "sari"); err != nil {
+		t.Fatal(err)
+	}
+	// The change revoked the old key; a new one works
+	expectStatus(t, serve(router, pendingReq), http.StatusUnauthorized)
+	expectStatus(t, serve(router, apiKeyRequest(t, repos, pending.ID)), http.StatusOK)
+
+	events, err := repos.SecurityEvents.List(ctx, repository.SecurityEventFilter{EventType: audit.EventPermissionDenied, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("recorded %d denials, want 2", len(events))
+	}
+}
+
+// sessionRequest - Start a session for userID and build a request of
+// method carrying its cookies (and the CSRF header when csrf is set)
+func sessionRequest(t *testing.T, repos *repository.Repositories, userID int, method string, csrf bool) *http.Request {
+	t.Helper()
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := models.Session{CSRFToken: "csrf-" + token}
+	if err := repos.Sessions.Create(context.Background(), userID, &session, auth.HashSessionToken(token), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: token})
+	req.AddCookie(&http.Cookie{Name: auth.CSRFCookie, Value: session.CSRFToken})
+	if csrf {
+		req.Header.Set(auth.CSRFHeader, session.CSRFToken)
+	}
+	return req
+}
+
+func TestSessionAuth(t *testing.T) {
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+
+	expectStatus(t, serve(router, sessionRequest(t, repos, user.ID, http.MethodGet, false)), http.StatusOK)
+	expectStatus(t, serve(router, sessionRequest(t, repos, user.ID, http.MethodPost, true)), http.StatusOK)
+
+	// State-changing requests need the CSRF header
+	expectStatus(t, serve(router, sessionRequest(t, repos, user.ID, http.MethodPost, false)), http.StatusForbidden)
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: "unknown"})
+	expectStatus(t, serve(router, req), http.StatusUnauthorized)
+}
+
+func TestSessionCSRF(t *testing.T) {
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+
+	// A cookie and header pair planted by another site does not help
+	// without the token bound to the session
+	req := sessionRequest(t, repos, user.ID, http.MethodPost, false)
+	session, _ := req.Cookie(auth.SessionCookie)
+	planted := httptest.NewRequest(http.MethodPost, "/protected", nil)
+	planted.AddCookie(session)
+	planted.AddCookie(&http.Cookie{Name: auth.CSRFCookie, Value: "planted"})
+	planted.Header.Set(auth.CSRFHeader, "planted")
+	expectStatus(t, serve(router, planted), http.StatusForbidden)
+
+	// The header alone, without the cookie, is not enough either
+	csrf, _ := req.Cookie(auth.CSRFCookie)
+	headerOnly := httptest.NewRequest(http.MethodPost, "/protected", nil)
+	headerOnly.AddCookie(session)
+	headerOnly.Header.Set(auth.CSRFHeader, csrf.Value)
+	expectStatus(t, serve(router, headerOnly), http.StatusForbidden)
+
+	events, err := repos.SecurityEvents.List(context.Background(), repository.SecurityEventFilter{EventType: audit.EventPermissionDenied, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].UserID == nil || *events[0].UserID != user.ID {
+		t.Fatalf("denials = %+v, want two for budi", events)
+	}
+}
+
+func TestSessionAuthRefusesUnusableOwner(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepos(t)
+	user := createUser(t, repos, "budi", "secret")
+	router := protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).JWTAuthMiddleware())
+	req := sessionRequest(t, repos, user.ID, http.MethodGet, false)
+
+	if err := repos.Users.RecordFailedLogin(ctx, user.ID, 1, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, serve(router, req), http.StatusForbidden)
+	if _, err := repos.Users.Unlock(ctx, user.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, serve(router, req), http.StatusOK)
+
+	pending := storeUser(t, repos, models.User{Username: "sari", Role: "user", MustChangePassword: true}, "secret")
+	expectStatus(t, serve(router, sessionRequest(t, repos, pending.ID, http.MethodGet, false)), http.StatusForbidden)
+}
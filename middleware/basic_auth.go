@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BasicAuthMiddleware - HTTP Basic auth verified against the users table,
+// for legacy tools that cannot use JWT
+func (a *Authenticator) BasicAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.authenticateBasic(c)
+	}
+}
+
+// JWTOrBasicAuthMiddleware - Accept Basic credentials in addition to
+// everything JWTAuthMiddleware accepts
+func (a *Authenticator) JWTOrBasicAuthMiddleware() gin.HandlerFunc {
+	jwtAuth := a.JWTAuthMiddleware()
+	return func(c *gin.Context) {
+		if scheme, _, _ := strings.Cut(c.GetHeader("Authorization"), " "); strings.EqualFold(scheme, "Basic") {
+			a.authenticateBasic(c)
+			return
+		}
+		jwtAuth(c)
+	}
+}
+
+// BasicAuthGroups - Route groups that also accept Basic auth, from
+// BASIC_AUTH_GROUPS (comma separated, e.g. "books,categories")
+func BasicAuthGroups() map[string]bool {
+	groups := make(map[string]bool)
+	for _, name := range config.Current.BasicAuth.Groups {
+		groups[name] = true
+	}
+	return groups
+}
+
+func (a *Authenticator) authenticateBasic(c *gin.Context) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		rejectBasic(c)
+		return
+	}
+
+	// The account is loaded for every request, the cache only saves the
+	// bcrypt comparison (see login.CredentialCache)
+	var user models.User
+	var err error
+	cached := false
+	if login.Credentials.Contains(username) {
+		user, err = a.users.GetByUsername(c.Request.Context(), username)
+		if abortOnTimeout(c, err) {
+			return
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Basic auth lookup failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		cached = err == nil && login.Credentials.Match(user, password)
+	}
+
+	if cached {
+		if user.LockedFor > 0 {
+			audit.Record(c, audit.EventLogin, audit.Denied, audit.Event{UserID: user.ID, Username: user.Username, Details: "account locked, method=basic"})
+			login.TooManyAttempts(c, user.LockedFor)
+			return
+		}
+	} else {
+		user, err = a.verifier.Verify(c, "basic", username, password)
+		var retry *login.RetryError
+		switch {
+		case errors.As(err, &retry):
+			login.TooManyAttempts(c, retry.Wait)
+			return
+		case errors.Is(err, login.ErrInvalidCredentials):
+			rejectBasic(c)
+			return
+		case abortOnTimeout(c, err):
+			return
+		case err != nil:
+			slog.ErrorContext(c.Request.Context(), "Basic auth check failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+	}
+
+	// Basic auth is a single step: accounts that need a second factor or a
+	// new password have to log in normally
+	if reason := basicRefusal(user); reason != "" {
+		audit.Record(c, audit.EventLogin, audit.Denied, audit.Event{UserID: user.ID, Username: user.Username, Details: reason + ", method=basic"})
+		c.Header("WWW-Authenticate", `Basic realm="api", charset="UTF-8"`)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Basic auth is not available for this account, log in with POST /api/users/login"})
+		c.Abort()
+		return
+	}
+
+	if !cached {
+		login.Credentials.Remember(user, password, basicCacheTTL())
+		audit.Record(c, audit.EventLogin, audit.Success, audit.Event{UserID: user.ID, Username: user.Username, Details: "method=basic"})
+	}
+
+	c.Set("username", user.Username)
+	c.Set("user_id", user.ID)
+	c.Set("role", user.Role)
+	c.Set("auth_method", "basic")
+	c.Next()
+}
+
+// basicRefusal - Why user may not use Basic auth ("" when allowed)
+func basicRefusal(user models.User) string {
+	switch {
+	case user.MustChangePassword:
+		return "password change required"
+	case user.TOTPEnabled:
+		return "two-factor authentication enabled"
+	case user.Role == "admin" && config.Current.Auth.RequireAdmin2FA:
+		return "two-factor authentication required"
+	}
+	return ""
+}
+
+func rejectBasic(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="api", charset="UTF-8"`)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	c.Abort()
+}
+
+func basicCacheTTL() time.Duration {
+	return config.Current.BasicAuth.CacheTTL
+}
@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+	"mini-project-buku-sb-go-73-Agil/login"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+// basicTest - Basic auth on in-memory repositories with a clean login
+// guard and credential cache
+func basicTest(t *testing.T, settings config.Login) (*repository.Repositories, http.Handler) {
+	t.Helper()
+	repos := newTestRepos(t)
+	return repos, basicRouter(t, settings, repos)
+}
+
+// basicRouter - Basic auth on repos with a clean login guard and
+// credential cache
+func basicRouter(t *testing.T, settings config.Login, repos *repository.Repositories) http.Handler {
+	t.Helper()
+	previousLogin, previousAuth := config.Current.Login, config.Current.Auth
+	previousAttempts, previousCredentials := login.Attempts, login.Credentials
+	config.Current.Login = settings
+	login.Attempts, login.Credentials = login.NewGuard(), login.NewCredentialCache()
+	t.Cleanup(func() {
+		config.Current.Login, config.Current.Auth = previousLogin, previousAuth
+		login.Attempts, login.Credentials = previousAttempts, previousCredentials
+	})
+
+	return protected(NewAuthenticator(repos.Users, repos.APIKeys, repos.Sessions).BasicAuthMiddleware())
+}
+
+func basicRequest(username, password string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.SetBasicAuth(username, password)
+	return req
+}
+
+func TestBasicAuth(t *testing.T) {
+	repos, router := basicTest(t, config.Default().Login)
+	createUser(t, repos, "budi", "secret")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "secret"))
+	expectStatus(t, w, http.StatusOK)
+	if !login.Credentials.Contains("budi") {
+		t.Fatal("verified credentials were not cached")
+	}
+
+	// Served from the cache
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "secret"))
+	expectStatus(t, w, http.StatusOK)
+
+	for _, req := range []*http.Request{basicRequest("budi", "wrong"), basicRequest("nobody", "secret"), httptest.NewRequest(http.MethodGet, "/protected", nil)} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		expectStatus(t, w, http.StatusUnauthorized)
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Fatal("401 without WWW-Authenticate")
+		}
+	}
+}
+
+func TestBasicAuthBackoffAndLockout(t *testing.T) {
+	repos, router := basicTest(t, config.Login{
+		BackoffFreeAttempts: 2,
+		IPFreeAttempts:      100,
+		BackoffBase:         time.Minute,
+		BackoffMax:          time.Hour,
+		AttemptWindow:       time.Hour,
+		LockThreshold:       3,
+		LockDuration:        time.Hour,
+	})
+	user := createUser(t, repos, "budi", "secret")
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, basicRequest("budi", "wrong"))
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "secret"))
+	expectStatus(t, w, http.StatusTooManyRequests)
+
+	// The failures also counted towards the account lock
+	locked, err := repos.Users.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked.LockedFor <= 0 {
+		t.Fatal("account not locked after failed Basic logins")
+	}
+}
+
+func TestBasicAuthCachedCredentialsFollowAccount(t *testing.T) {
+	ctx := context.Background()
+	repos, router := basicTest(t, config.Default().Login)
+	user := createUser(t, repos, "budi", "secret")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "secret"))
+	expectStatus(t, w, http.StatusOK)
+
+	// Locked while the credentials are cached
+	if err := repos.Users.RecordFailedLogin(ctx, user.ID, 1, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "secret"))
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if _, err := repos.Users.Unlock(ctx, user.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Password changed by something that does not know about this cache
+	hash, err := bcrypt.GenerateFromPassword([]byte("new secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Users.SetPassword(ctx, user.ID, string(hash), "budi"); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "secret"))
+	expectStatus(t, w, http.StatusUnauthorized)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "new secret"))
+	expectStatus(t, w, http.StatusOK)
+}
+
+// The SQL repositories load the current hash on every request too, so a
+// password set straight in the database (another instance, the CLI) ends
+// the cached credentials
+func TestBasicAuthCachedCredentialsFollowDatabase(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		repos := repository.NewSQL(database.DB, nil)
+		previousEvents := audit.Events
+		audit.Events = repos.SecurityEvents
+		t.Cleanup(func() { audit.Events = previousEvents })
+		router := basicRouter(t, config.Default().Login, repos)
+		user := createUser(t, repos, "budi", "secret")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, basicRequest("budi", "secret"))
+		expectStatus(t, w, http.StatusOK)
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("new secret"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.DB.Exec("UPDATE users SET password = $1 WHERE id = $2", string(hash), user.ID); err != nil {
+			t.Fatal(err)
+		}
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, basicRequest("budi", "secret"))
+		expectStatus(t, w, http.StatusUnauthorized)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, basicRequest("budi", "new secret"))
+		expectStatus(t, w, http.StatusOK)
+
+		// Locked while the new credentials are cached
+		if err := repos.Users.RecordFailedLogin(context.Background(), user.ID, 1, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, basicRequest("budi", "new secret"))
+		expectStatus(t, w, http.StatusTooManyRequests)
+	})
+}
+
+func TestBasicAuthRefusesSecondFactorAccounts(t *testing.T) {
+	ctx := context.Background()
+	repos, router := basicTest(t, config.Default().Login)
+
+	user := createUser(t, repos, "budi", "secret")
+	if err := repos.TwoFactor.SetPendingSecret(ctx, user.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.Enable(ctx, user.ID, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("budi", "secret"))
+	expectStatus(t, w, http.StatusForbidden)
+
+	storeUser(t, repos, models.User{Username: "root", Role: "admin"}, "secret")
+	config.Current.Auth.RequireAdmin2FA = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("root", "secret"))
+	expectStatus(t, w, http.StatusOK)
+
+	// Required 2FA also applies to credentials cached before it was switched on
+	config.Current.Auth.RequireAdmin2FA = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("root", "secret"))
+	expectStatus(t, w, http.StatusForbidden)
+
+	storeUser(t, repos, models.User{Username: "sari", Role: "user", MustChangePassword: true}, "secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, basicRequest("sari", "secret"))
+	expectStatus(t, w, http.StatusForbidden)
+}
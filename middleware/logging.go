@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/logging"
+)
+
+// RequestIDHeader - Header carrying the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// Probe endpoints are polled every few seconds; their requests are only
+// logged at debug level
+var probePaths = map[string]bool{"/livez": true, "/readyz": true, "/health": true}
+
+// RequestID - Use the client's X-Request-ID (a new one when it is missing
+// or not a plain token), send it back in the response and put it into the
+// request context, so log lines and queries of the request carry it. JSON
+// error bodies get it as request_id.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Writer = &requestIDWriter{ResponseWriter: c.Writer, id: id}
+		c.Next()
+	}
+}
+
+// requestIDWriter - Adds "request_id" to a JSON object written as an
+// error response. gin writes a rendered JSON body in one call, so only
+// the first write needs looking at.
+type requestIDWriter struct {
+	gin.ResponseWriter
+	id      string
+	written bool
+}
+
+func (w *requestIDWriter) Write(data []byte) (int, error) {
+	if w.written {
+		return w.ResponseWriter.Write(data)
+	}
+	w.written = true
+
+	if w.Status() < http.StatusBadRequest || len(data) < 2 || data[0] != '{' ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+
+	tagged := make([]byte, 0, len(data)+len(w.id)+16)
+	tagged = append(tagged, `{"request_id":"`...)
+	tagged = append(tagged, w.id...)
+	tagged = append(tagged, '"')
+	if rest := strings.TrimSpace(string(data[1:])); rest != "}" {
+		tagged = append(tagged, ',')
+	}
+	tagged = append(tagged, data[1:]...)
+	if _, err := w.ResponseWriter.Write(tagged); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *requestIDWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// RequestLogger - One log line per request with status, latency and the
+// authenticated user. The query string is left out, it can hold codes and
+// tokens (OIDC callback, password reset links).
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case probePaths[c.Request.URL.Path] && status < http.StatusBadRequest:
+			level = slog.LevelDebug
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if username := c.GetString("username"); username != "" {
+			attrs = append(attrs, slog.String("user", username))
+		}
+		if id, ok := c.Get("user_id"); ok {
+			attrs = append(attrs, slog.Any("user_id", id))
+		}
+		if method := c.GetString("auth_method"); method != "" {
+			attrs = append(attrs, slog.String("auth_method", method))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		// The handlers may have replaced the request context; the request
+		// ID was set before them and is still in it
+		slog.LogAttrs(context.WithoutCancel(c.Request.Context()), level, "Request", attrs...)
+	}
+}
+
+// Recovery - Turn a panicking handler into a 500 and log the panic with
+// its stack instead of printing it to stderr
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				slog.ErrorContext(c.Request.Context(), "Panic while handling request", "error", err, "stack", string(debug.Stack()))
+				if !c.Writer.Written() {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				}
+				c.Abort()
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/logging"
+)
+
+// captureLogs - Log records of the test as decoded JSON objects, at info
+// level and up
+func captureLogs(t *testing.T) func() []map[string]interface{} {
+	t.Helper()
+	previousLogger, previousLevel := slog.Default(), logging.Level()
+	var buf bytes.Buffer
+	logging.SetLevel("info")
+	slog.SetDefault(slog.New(logging.NewHandler(&buf, "json")))
+	t.Cleanup(func() {
+		slog.SetDefault(previousLogger)
+		logging.SetLevel(previousLevel.String())
+	})
+
+	return func() []map[string]interface{} {
+		var records []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("log line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+// loggedRouter - Router with the logging middleware in front of a few
+// handlers: /books answers 200, /missing a 404 error and /panic panics
+func loggedRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(RequestID(), RequestLogger(), Recovery())
+	router.GET("/books", func(c *gin.Context) {
+		c.Set("username", "budi")
+		c.JSON(http.StatusOK, gin.H{"books": []string{}})
+	})
+	router.GET("/missing", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	})
+	router.GET("/empty", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{})
+	})
+	router.GET("/livez", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	return router
+}
+
+func TestRequestID(t *testing.T) {
+	captureLogs(t)
+	router := loggedRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	w := serve(router, req)
+	if got := w.Header().Get(RequestIDHeader); got != "client-id-1" {
+		t.Fatalf("%s = %q, want the client's ID", RequestIDHeader, got)
+	}
+	if body := w.Body.String(); body != `{"request_id":"client-id-1","error":"Book not found"}` {
+		t.Fatalf("error body = %s, want the request ID added", body)
+	}
+
+	// A new ID replaces one that is not a plain token
+	req = httptest.NewRequest(http.MethodGet, "/books", nil)
+	req.Header.Set(RequestIDHeader, "x'*/ DROP")
+	w = serve(router, req)
+	if got := w.Header().Get(RequestIDHeader); !logging.ValidRequestID(got) || got == "x'*/ DROP" {
+		t.Fatalf("%s = %q, want a generated ID", RequestIDHeader, got)
+	}
+	if body := w.Body.String(); body != `{"books":[]}` {
+		t.Fatalf("success body = %s, want it unchanged", body)
+	}
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, "/empty", nil))
+	if body, id := w.Body.String(), w.Header().Get(RequestIDHeader); body != `{"request_id":"`+id+`"}` {
+		t.Fatalf("empty error body = %s", body)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	logs := captureLogs(t)
+	router := loggedRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/books?token=secret", nil)
+	req.Header.Set(RequestIDHeader, "req-books")
+	serve(router, req)
+	serve(router, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	records := logs()
+	if len(records) != 1 {
+		t.Fatalf("records = %v, want only the /books request (probes log at debug)", records)
+	}
+	record := records[0]
+	for key, want := range map[string]interface{}{
+		"msg":        "Request",
+		"level":      "INFO",
+		"method":     "GET",
+		"path":       "/books",
+		"route":      "/books",
+		"status":     float64(200),
+		"user":       "budi",
+		"request_id": "req-books",
+	} {
+		if record[key] != want {
+			t.Errorf("%s = %v, want %v", key, record[key], want)
+		}
+	}
+	line, _ := json.Marshal(record)
+	if strings.Contains(string(line), "secret") {
+		t.Errorf("query string logged: %s", line)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	logs := captureLogs(t)
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(RequestIDHeader, "req-panic")
+	w := serve(loggedRouter(), req)
+
+	expectStatus(t, w, http.StatusInternalServerError)
+	if body := w.Body.String(); body != `{"request_id":"req-panic","error":"Internal server error"}` {
+		t.Fatalf("body = %s", body)
+	}
+
+	records := logs()
+	if len(records) != 2 || records[0]["msg"] != "Panic while handling request" || records[0]["error"] != "boom" || records[0]["request_id"] != "req-panic" {
+		t.Fatalf("records = %v, want the panic logged with the request ID", records)
+	}
+	if stack, _ := records[0]["stack"].(string); !strings.Contains(stack, "logging_test.go") {
+		t.Fatalf("stack = %q, want the panicking handler", stack)
+	}
+	if records[1]["level"] != "ERROR" || records[1]["status"] != float64(500) {
+		t.Fatalf("request record = %v, want a 500 at error level", records[1])
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/audit"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	jwtConfig := config.Current.JWT
+	jwtConfig.Secret = "middleware-test-secret"
+	if err := auth.InitKeyring(jwtConfig); err != nil {
+		panic(err)
+	}
+	auth.InitTokens(jwtConfig)
+
+	os.Exit(m.Run())
+}
+
+// newTestRepos - In-memory repositories that also receive the audit events
+func newTestRepos(t *testing.T) *repository.Repositories {
+	t.Helper()
+	repos := repository.NewMemory()
+	previousEvents := audit.Events
+	audit.Events = repos.SecurityEvents
+	t.Cleanup(func() { audit.Events = previousEvents })
+	return repos
+}
+
+// createUser - Store a user with password (hashed at the minimum cost)
+func createUser(t *testing.T, repos *repository.Repositories, username, password string) models.User {
+	t.Helper()
+	return storeUser(t, repos, models.User{Username: username, Role: "user"}, password)
+}
+
+// storeUser - Store user with password (hashed at the minimum cost)
+func storeUser(t *testing.T, repos *repository.Repositories, user models.User, password string) models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Password, user.CreatedBy = string(hash), "test"
+	if err := repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// protected - Router with GET and POST /protected behind the middleware,
+// answering with the authenticated user
+func protected(middleware ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"username": c.GetString("username"), "auth_method": c.GetString("auth_method")})
+	}
+	router.GET("/protected", append(middleware, handler)...)
+	router.POST("/protected", append(middleware, handler)...)
+	return router
+}
+
+// serve - Send req to router and return the response
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d (body %s)", w.Code, status, w.Body.String())
+	}
+}
+
+// revokingUsers - Users whose tokens issued before validAfter are revoked
+type revokingUsers struct {
+	repository.UserRepository
+	validAfter time.Time
+}
+
+func (r revokingUsers) TokenRevoked(ctx context.Context, id int, issuedAt time.Time) (bool, error) {
+	if _, err := r.UserRepository.TokenRevoked(ctx, id, issuedAt); err != nil {
+		return false, err
+	}
+	return !issuedAt.After(r.validAfter), nil
+}
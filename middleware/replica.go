@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"net/http"
+)
+
+// ReadYourWrites - Send a client's reads to the primary for a short window
+// after it changed something, so it never reads its own write from a
+// replica that has not caught up yet (use after the auth middleware)
+func ReadYourWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		replicas := database.Replicas
+		if replicas == nil {
+			c.Next()
+			return
+		}
+
+		key := c.ClientIP()
+		if id, ok := c.Get("user_id"); ok {
+			key = fmt.Sprint("user:", id)
+		}
+
+		safe := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead
+		if safe && replicas.RecentWrite(key) {
+			c.Request = c.Request.WithContext(database.WithPrimary(c.Request.Context()))
+		}
+
+		c.Next()
+
+		if !safe && c.Writer.Status() < http.StatusBadRequest {
+			replicas.MarkWrite(key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/database"
+)
+
+// withReplicas - Replica set whose only replica is unreachable, so every
+// read goes to the primary; enough to see which writes are remembered.
+// No database is opened here, so database.Dialect is still Postgres.
+func withReplicas(t *testing.T) *database.ReplicaSet {
+	t.Helper()
+	previousConfig, previousReplicas := config.Current.Database, database.Replicas
+	t.Cleanup(func() { config.Current.Database, database.Replicas = previousConfig, previousReplicas })
+
+	config.Current.Database.ReplicaDSNs = []string{"postgres://replica@127.0.0.1:1/books?sslmode=disable&connect_timeout=1"}
+	replicas, err := database.OpenReplicas(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(replicas.Close)
+	database.Replicas = replicas
+	return replicas
+}
+
+func TestReadYourWrites(t *testing.T) {
+	replicas := withReplicas(t)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if id := c.GetHeader("X-User"); id != "" {
+			c.Set("user_id", id)
+		}
+	}, ReadYourWrites())
+	router.GET("/books", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/books", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	router.PUT("/books/:id", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+
+	send := func(method, path, user string) {
+		req := httptest.NewRequest(method, path, nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		serve(router, req)
+	}
+
+	send(http.MethodGet, "/books", "1")
+	send(http.MethodPut, "/books/1", "2")
+	if replicas.RecentWrite("user:1") || replicas.RecentWrite("user:2") {
+		t.Fatal("read or failed write remembered as a write")
+	}
+
+	send(http.MethodPost, "/books", "1")
+	if !replicas.RecentWrite("user:1") {
+		t.Fatal("write of user 1 not remembered")
+	}
+
+	// Without a user the client IP is the key
+	send(http.MethodPost, "/books", "")
+	if !replicas.RecentWrite("192.0.2.1") {
+		t.Fatal("anonymous write not remembered by client IP")
+	}
+}
+
+func TestReadYourWritesWithoutReplicas(t *testing.T) {
+	previous := database.Replicas
+	database.Replicas = nil
+	t.Cleanup(func() { database.Replicas = previous })
+
+	router := gin.New()
+	router.POST("/books", ReadYourWrites(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	expectStatus(t, serve(router, httptest.NewRequest(http.MethodPost, "/books", nil)), http.StatusCreated)
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"net/http"
+)
+
+// QueryTimeout - Bound the request context, and with it every query made
+// by the handlers, by the timeout configured for the endpoint group (see
+// database.QueryTimeout). A client that disconnects cancels the context
+// as well, which stops the running query.
+func QueryTimeout(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := database.WithQueryTimeout(c.Request.Context(), name)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// abortOnTimeout - Answer 504 instead of 401 when an authentication lookup
+// did not finish in time (nothing is sent to a client that went away)
+func abortOnTimeout(c *gin.Context, err error) bool {
+	switch {
+	case database.IsTimeout(err):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Database query timed out"})
+	case database.IsCanceled(err):
+		c.AbortWithStatus(499)
+	default:
+		return false
+	}
+	c.Abort()
+	return true
+}
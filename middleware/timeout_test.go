@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+// withQueryTimeout - Use timeout for every endpoint group during the test
+func withQueryTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	previous := config.Current.Database
+	config.Current.Database.QueryTimeout = timeout
+	config.Current.Database.QueryTimeouts = nil
+	t.Cleanup(func() { config.Current.Database = previous })
+}
+
+// slowAPIKeys - API key storage whose lookups only end with the context
+type slowAPIKeys struct {
+	repository.APIKeyRepository
+}
+
+func (slowAPIKeys) Authenticate(ctx context.Context, keyHash string) (models.APIKey, models.User, error) {
+	<-ctx.Done()
+	return models.APIKey{}, models.User{}, ctx.Err()
+}
+
+func TestQueryTimeoutSetsDeadline(t *testing.T) {
+	var deadline time.Time
+	var hasDeadline bool
+	router := gin.New()
+	router.GET("/deadline", QueryTimeout("books"), func(c *gin.Context) {
+		deadline, hasDeadline = c.Request.Context().Deadline()
+		c.Status(http.StatusOK)
+	})
+
+	withQueryTimeout(t, time.Minute)
+	expectStatus(t, serve(router, httptest.NewRequest(http.MethodGet, "/deadline", nil)), http.StatusOK)
+	if remaining := time.Until(deadline); !hasDeadline || remaining > time.Minute || remaining < 59*time.Second {
+		t.Fatalf("deadline = %v, %v; want in a minute", deadline, hasDeadline)
+	}
+
+	withQueryTimeout(t, 0)
+	expectStatus(t, serve(router, httptest.NewRequest(http.MethodGet, "/deadline", nil)), http.StatusOK)
+	if hasDeadline {
+		t.Fatal("deadline set while the timeout is disabled")
+	}
+}
+
+func TestAuthenticationTimeout(t *testing.T) {
+	withQueryTimeout(t, 20*time.Millisecond)
+	repos := newTestRepos(t)
+	authenticator := NewAuthenticator(repos.Users, slowAPIKeys{}, repos.Sessions)
+	router := protected(QueryTimeout("books"), authenticator.JWTAuthMiddleware())
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("X-API-Key", "bk_slow")
+	w := serve(router, req)
+	expectStatus(t, w, http.StatusGatewayTimeout)
+	if w.Header().Get("WWW-Authenticate") != "" {
+		t.Fatal("timeout answered as an authentication failure")
+	}
+
+	// A client that went away gets no body
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil).WithContext(ctx)
+	req.Header.Set("X-API-Key", "bk_slow")
+	w = serve(router, req)
+	expectStatus(t, w, 499)
+	if w.Body.Len() != 0 {
+		t.Fatalf("body = %s, want none for a canceled request", w.Body.String())
+	}
+}
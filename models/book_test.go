@@ -0,0 +1,11 @@
+package models
+
+import "testing"
+
+func TestThicknessFor(t *testing.T) {
+	for pages, want := range map[int]string{1: "tipis", 100: "tipis", 101: "tebal", 900: "tebal"} {
+		if got := ThicknessFor(pages); got != want {
+			t.Errorf("ThicknessFor(%d) = %q, want %q", pages, got, want)
+		}
+	}
+}
@@ -3,10 +3,10 @@ package models
 import "time"
 
 type Category struct {
-    ID        int       `json:"id"`
-    Name      string    `json:"name" binding:"required"`
-    CreatedAt time.Time `json:"created_at"`
-    CreatedBy string    `json:"created_by"`
-    ModifiedAt time.Time `json:"modified_at"`
-    ModifiedBy string    `json:"modified_by"`
-}
\ No newline at end of file
+	ID         int       `json:"id"`
+	Name       string    `json:"name" binding:"required"`
+	CreatedAt  time.Time `json:"created_at"`
+	CreatedBy  string    `json:"created_by"`
+	ModifiedAt time.Time `json:"modified_at"`
+	ModifiedBy string    `json:"modified_by"`
+}
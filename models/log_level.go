@@ -0,0 +1,5 @@
+package models
+
+type LogLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
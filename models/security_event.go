@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type SecurityEvent struct {
+	ID        int64     `json:"id"`
+	EventType string    `json:"event_type"`
+	Outcome   string    `json:"outcome"`
+	UserID    *int      `json:"user_id"`
+	Username  *string   `json:"username"`
+	IPAddress *string   `json:"ip_address"`
+	UserAgent *string   `json:"user_agent"`
+	Details   *string   `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         int       `json:"id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+	CSRFToken  string    `json:"-"`
+}
+
+type SessionResponse struct {
+	Message   string    `json:"message"`
+	CSRFToken string    `json:"csrf_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// RecoveryCodes - Set when the login ended a mandatory 2FA enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
@@ -3,20 +3,76 @@ package models
 import "time"
 
 type User struct {
-    ID        int       `json:"id"`
-    Username  string    `json:"username"`
-    Password  string    `json:"-"`
-    CreatedAt time.Time `json:"created_at"`
-    CreatedBy string    `json:"created_by"`
-    ModifiedAt time.Time `json:"modified_at"`
-    ModifiedBy string    `json:"modified_by"`
+	ID                 int           `json:"id"`
+	Username           string        `json:"username"`
+	Password           string        `json:"-"`
+	Email              string        `json:"email,omitempty"`
+	Role               string        `json:"role"`
+	TOTPEnabled        bool          `json:"totp_enabled"`
+	MustChangePassword bool          `json:"must_change_password"`
+	CreatedAt          time.Time     `json:"created_at"`
+	CreatedBy          string        `json:"created_by"`
+	ModifiedAt         time.Time     `json:"modified_at"`
+	ModifiedBy         string        `json:"modified_by"`
+	LockedFor          time.Duration `json:"-"` // Remaining account lock when loaded for login
 }
 
 type LoginRequest struct {
-    Username string `json:"username" binding:"required"`
-    Password string `json:"password" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
 type LoginResponse struct {
-    Token string `json:"token"`
-}
\ No newline at end of file
+	Token string `json:"token"`
+	// RecoveryCodes - Set when the login ended a mandatory 2FA enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type PasswordChangeResponse struct {
+	PasswordChangeRequired bool   `json:"password_change_required"`
+	PasswordChangeToken    string `json:"password_change_token"`
+	// RecoveryCodes - Set when the login ended a mandatory 2FA enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required,omitempty"`
+	MFAToken           string `json:"mfa_token,omitempty"`
+	EnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	EnrollmentToken    string `json:"enrollment_token,omitempty"`
+}
+
+type TwoFactorLoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"omitempty,email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,212 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"mini-project-buku-sb-go-73-Agil/config"
+)
+
+// testIdP - Identity provider answering every code with an ID token built
+// from claims (issuer, audience and expiry are filled in when empty)
+type testIdP struct {
+	server *httptest.Server
+	key    ed25519.PrivateKey
+	claims IDClaims
+	kid    string
+
+	// The last token request
+	form         url.Values
+	user, secret string
+}
+
+func newTestIdP(t *testing.T) (*testIdP, *Provider) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key, kid: "k1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize?prompt=login",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "OKP", "crv": "Ed25519", "kid": "k1", "x": base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey))},
+			{"kty": "oct", "kid": "ignored", "k": "c2VjcmV0"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.form = r.PostForm
+		idp.user, idp.secret, _ = r.BasicAuth()
+		if r.PostForm.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+			return
+		}
+
+		claims := idp.claims
+		if claims.Issuer == "" {
+			claims.Issuer = idp.server.URL
+		}
+		if claims.Audience == nil {
+			claims.Audience = jwt.ClaimStrings{"books-api"}
+		}
+		if claims.ExpiresAt == nil {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = idp.kid
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	p := New(config.OIDC{
+		IssuerURL:    idp.server.URL + "/",
+		ClientID:     "books-api",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost/callback",
+		Scopes:       []string{"openid", "email"},
+	})
+	return idp, p
+}
+
+func TestNewWithoutIssuer(t *testing.T) {
+	if p := New(config.OIDC{ClientID: "books-api"}); p != nil {
+		t.Fatalf("New without OIDC_ISSUER_URL = %+v, want nil", p)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp, p := newTestIdP(t)
+
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := p.AuthCodeURL(context.Background(), "the-state", "the-nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, idp.server.URL+"/authorize?") {
+		t.Fatalf("URL = %s, want the authorization endpoint", raw)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := u.Query()
+	for param, want := range map[string]string{
+		"prompt":                "login",
+		"response_type":         "code",
+		"client_id":             "books-api",
+		"redirect_uri":          "http://localhost/callback",
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp, p := newTestIdP(t)
+	idp.claims = IDClaims{Nonce: "n", Email: "alice@example.com", PreferredUsername: "alice", RegisteredClaims: jwt.RegisteredClaims{Subject: "alice-id"}}
+
+	claims, err := p.Exchange(context.Background(), "good-code", "the-verifier", "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice-id" || claims.Email != "alice@example.com" || claims.PreferredUsername != "alice" {
+		t.Fatalf("claims = %+v", claims)
+	}
+	if idp.form.Get("code_verifier") != "the-verifier" || idp.form.Get("grant_type") != "authorization_code" || idp.form.Get("redirect_uri") != "http://localhost/callback" {
+		t.Fatalf("token request = %v", idp.form)
+	}
+	if idp.user != "books-api" || idp.secret != "s3cret" {
+		t.Fatalf("client authentication = %q/%q", idp.user, idp.secret)
+	}
+
+	if _, err := p.Exchange(context.Background(), "bad-code", "the-verifier", "n"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("unknown code: err = %v, want the provider's error", err)
+	}
+}
+
+func TestExchangeRejectsIDTokens(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		claims IDClaims
+		nonce  string
+		kid    string
+	}{
+		{"nonce mismatch", IDClaims{Nonce: "other", RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"}}, "n", "k1"},
+		{"other audience", IDClaims{Nonce: "n", RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", Audience: jwt.ClaimStrings{"someone-else"}}}, "n", "k1"},
+		{"other issuer", IDClaims{Nonce: "n", RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", Issuer: "https://evil.example"}}, "n", "k1"},
+		{"expired", IDClaims{Nonce: "n", RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))}}, "n", "k1"},
+		{"no subject", IDClaims{Nonce: "n"}, "n", "k1"},
+		{"unknown key", IDClaims{Nonce: "n", RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"}}, "n", "k2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, p := newTestIdP(t)
+			idp.claims, idp.kid = tt.claims, tt.kid
+			if claims, err := p.Exchange(context.Background(), "good-code", "v", tt.nonce); err == nil {
+				t.Fatalf("accepted %+v", claims)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp, _ := newTestIdP(t)
+	p := New(config.OIDC{IssuerURL: strings.Replace(idp.server.URL, "127.0.0.1", "localhost", 1), ClientID: "books-api"})
+
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v, want an issuer mismatch", err)
+	}
+}
+
+func TestPublicKeyTypes(t *testing.T) {
+	for _, tt := range []struct {
+		jwk jsonWebKey
+		ok  bool
+	}{
+		{jsonWebKey{Kty: "RSA", N: "AQAB", E: "AQAB"}, true},
+		{jsonWebKey{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}, true},
+		{jsonWebKey{Kty: "EC", Crv: "P-521", X: "AQ", Y: "AQ"}, false},
+		{jsonWebKey{Kty: "OKP", Crv: "Ed25519", X: "AQ"}, true},
+		{jsonWebKey{Kty: "OKP", Crv: "X25519", X: "AQ"}, false},
+		{jsonWebKey{Kty: "RSA", N: "not base64!", E: "AQAB"}, false},
+		{jsonWebKey{Kty: "oct"}, false},
+	} {
+		if _, err := tt.jwk.publicKey(); (err == nil) != tt.ok {
+			t.Errorf("publicKey(%+v) err = %v, want ok %v", tt.jwk, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package repository
+
+import (
+	"context"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore - Shared state of the in-memory repositories, so books can
+// reference categories like they do in the database
+type memoryStore struct {
+	mu            sync.RWMutex
+	nextID        int
+	books         map[int]models.Book
+	categories    map[int]models.Category
+	users         map[int]memoryUser
+	identities    map[[2]string]int
+	recoveryCodes map[int][]memoryRecoveryCode
+	resetTokens   map[string]memoryResetToken
+	apiKeys       map[int]memoryAPIKey
+	sessions      map[int]memorySession
+	events        []models.SecurityEvent
+}
+
+type memoryUser struct {
+	models.User
+	failedAttempts int
+	lockedUntil    time.Time
+	totpSecret     string
+	totpLastStep   int64
+
+	// tokensValidAfter - Bearer tokens issued up to here are revoked
+	tokensValidAfter time.Time
+}
+
+// view - The user as the SQL repository loads it: with the remaining lock
+// time, without the password hash
+func (u memoryUser) view() models.User {
+	user := u.User
+	user.Password = ""
+	user.LockedFor = 0
+	if wait := time.Until(u.lockedUntil); wait > 0 {
+		user.LockedFor = wait
+	}
+	return user
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		books:         make(map[int]models.Book),
+		categories:    make(map[int]models.Category),
+		users:         make(map[int]memoryUser),
+		identities:    make(map[[2]string]int),
+		recoveryCodes: make(map[int][]memoryRecoveryCode),
+		resetTokens:   make(map[string]memoryResetToken),
+		apiKeys:       make(map[int]memoryAPIKey),
+		sessions:      make(map[int]memorySession),
+	}
+}
+
+func (s *memoryStore) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// withCategory - Attach the category like the LEFT JOIN does (caller holds the lock)
+func (s *memoryStore) withCategory(book models.Book) models.Book {
+	book.Category = nil
+	if category, ok := s.categories[book.CategoryID]; ok {
+		book.Category = &models.Category{ID: category.ID, Name: category.Name}
+	}
+	return book
+}
+
+// validCategory - Whether a book may reference categoryID (caller holds the lock)
+func (s *memoryStore) validCategory(categoryID int) bool {
+	_, ok := s.categories[categoryID]
+	return categoryID == 0 || ok
+}
+
+// MemoryBookRepository - BookRepository kept in memory
+type MemoryBookRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryBookRepository) List(ctx context.Context) ([]models.Book, error) {
+	return r.filter(func(models.Book) bool { return true }), nil
+}
+
+func (r *MemoryBookRepository) ListByCategory(ctx context.Context, categoryID int) ([]models.Book, error) {
+	return r.filter(func(book models.Book) bool { return book.CategoryID == categoryID }), nil
+}
+
+func (r *MemoryBookRepository) filter(keep func(models.Book) bool) []models.Book {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var books []models.Book
+	for _, book := range r.store.books {
+		if keep(book) {
+			books = append(books, r.store.withCategory(book))
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+	return books
+}
+
+func (r *MemoryBookRepository) GetByID(ctx context.Context, id int) (models.Book, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	book, ok := r.store.books[id]
+	if !ok {
+		return book, ErrNotFound
+	}
+	return r.store.withCategory(book), nil
+}
+
+func (r *MemoryBookRepository) Create(ctx context.Context, book *models.Book) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if !r.store.validCategory(book.CategoryID) {
+		return ErrInvalidReference
+	}
+	book.ID = r.store.newID()
+	book.CreatedAt = time.Now()
+	stored := *book
+	stored.Category = nil
+	r.store.books[book.ID] = stored
+	return nil
+}
+
+func (r *MemoryBookRepository) Update(ctx context.Context, book *models.Book) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.books[book.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !r.store.validCategory(book.CategoryID) {
+		return ErrInvalidReference
+	}
+	book.CreatedAt = existing.CreatedAt
+	book.CreatedBy = existing.CreatedBy
+	book.ModifiedAt = time.Now()
+	stored := *book
+	stored.Category = nil
+	r.store.books[book.ID] = stored
+	return nil
+}
+
+func (r *MemoryBookRepository) Delete(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.books[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.store.books, id)
+	return nil
+}
+
+// MemoryCategoryRepository - CategoryRepository kept in memory
+type MemoryCategoryRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var categories []models.Category
+	for _, category := range r.store.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+	return categories, nil
+}
+
+func (r *MemoryCategoryRepository) GetByID(ctx context.Context, id int) (models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	category, ok := r.store.categories[id]
+	if !ok {
+		return category, ErrNotFound
+	}
+	return category, nil
+}
+
+func (r *MemoryCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	category.ID = r.store.newID()
+	category.CreatedAt = time.Now()
+	r.store.categories[category.ID] = *category
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Delete(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.categories[id]; !ok {
+		return ErrNotFound
+	}
+	for _, book := range r.store.books {
+		if book.CategoryID == id {
+			return ErrInUse
+		}
+	}
+	delete(r.store.categories, id)
+	return nil
+}
+
+// MemoryUserRepository - UserRepository kept in memory
+type MemoryUserRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id int) (models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user.view(), nil
+}
+
+func (r *MemoryUserRepository) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if user.Username == username {
+			view := user.view()
+			view.Password = user.Password
+			return view, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *MemoryUserRepository) GetCredentials(ctx context.Context, id int) (models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	view := user.view()
+	view.Password = user.Password
+	return view, nil
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.create(user)
+}
+
+// create - Store a new user (caller holds the lock)
+func (r *MemoryUserRepository) create(user *models.User) error {
+	for _, existing := range r.store.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	user.ID = r.store.newID()
+	user.CreatedAt = time.Now()
+	r.store.users[user.ID] = memoryUser{User: *user}
+	return nil
+}
+
+func (r *MemoryUserRepository) SetPassword(ctx context.Context, id int, hashedPassword, modifiedBy string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hashedPassword
+	user.MustChangePassword = false
+	user.ModifiedAt = time.Now()
+	user.ModifiedBy = modifiedBy
+	r.store.users[id] = user
+	r.store.revokeLogins(id)
+	return nil
+}
+
+func (r *MemoryUserRepository) RecordFailedLogin(ctx context.Context, id, threshold int, lockFor time.Duration) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return nil
+	}
+	user.failedAttempts++
+	if user.failedAttempts >= threshold {
+		user.failedAttempts = 0
+		user.lockedUntil = time.Now().Add(lockFor)
+	}
+	r.store.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) ResetFailedLogins(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if user, ok := r.store.users[id]; ok {
+		user.failedAttempts = 0
+		user.lockedUntil = time.Time{}
+		r.store.users[id] = user
+	}
+	return nil
+}
+
+func (r *MemoryUserRepository) Unlock(ctx context.Context, id int, modifiedBy string) (string, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	user.failedAttempts = 0
+	user.lockedUntil = time.Time{}
+	user.ModifiedAt = time.Now()
+	user.ModifiedBy = modifiedBy
+	r.store.users[id] = user
+	return user.Username, nil
+}
+
+// TokenRevoked - JWTs carry whole seconds, so a token from the second of
+// the invalidation counts as revoked
+func (r *MemoryUserRepository) TokenRevoked(ctx context.Context, id int, issuedAt time.Time) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	return !user.tokensValidAfter.IsZero() && !user.tokensValidAfter.Before(issuedAt), nil
+}
+
+func (r *MemoryUserRepository) GetByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[r.store.identities[[2]string{issuer, subject}]]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user.view(), nil
+}
+
+func (r *MemoryUserRepository) CreateWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	identity := [2]string{issuer, subject}
+	if _, taken := r.store.identities[identity]; taken {
+		return ErrDuplicate
+	}
+	if err := r.create(user); err != nil {
+		return err
+	}
+	r.store.identities[identity] = user.ID
+	return nil
+}
@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"sort"
+	"time"
+)
+
+type memoryRecoveryCode struct {
+	hash string
+	used bool
+}
+
+type memoryResetToken struct {
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+type memoryAPIKey struct {
+	models.APIKey
+	userID  int
+	hash    string
+	revoked bool
+}
+
+// active - Not revoked and not expired
+func (k memoryAPIKey) active() bool {
+	return !k.revoked && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
+}
+
+type memorySession struct {
+	models.Session
+	userID  int
+	hash    string
+	revoked bool
+}
+
+func (s memorySession) active() bool {
+	return !s.revoked && s.ExpiresAt.After(time.Now())
+}
+
+// revokeLogins - Revoke the user's Bearer tokens, sessions and API keys
+// after a new password; the caller holds the lock
+func (s *memoryStore) revokeLogins(userID int) {
+	user := s.users[userID]
+	user.tokensValidAfter = time.Now()
+	s.users[userID] = user
+
+	for id, session := range s.sessions {
+		if session.userID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	for id, key := range s.apiKeys {
+		if key.userID == userID && !key.revoked {
+			key.revoked = true
+			s.apiKeys[id] = key
+		}
+	}
+}
+
+// MemoryTwoFactorRepository - TwoFactorRepository kept in memory
+type MemoryTwoFactorRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryTwoFactorRepository) GetSecret(ctx context.Context, userID int) (string, bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[userID]
+	if !ok {
+		return "", false, ErrNotFound
+	}
+	return user.totpSecret, user.TOTPEnabled, nil
+}
+
+func (r *MemoryTwoFactorRepository) SetPendingSecret(ctx context.Context, userID int, secret string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.TOTPEnabled {
+		return ErrConflict
+	}
+	user.totpSecret = secret
+	r.store.users[userID] = user
+	return nil
+}
+
+func (r *MemoryTwoFactorRepository) Enable(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok {
+		return nil
+	}
+	user.TOTPEnabled = true
+	user.totpLastStep = step
+	r.store.users[userID] = user
+
+	codes := make([]memoryRecoveryCode, 0, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes = append(codes, memoryRecoveryCode{hash: hash})
+	}
+	r.store.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *MemoryTwoFactorRepository) Disable(ctx context.Context, userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if user, ok := r.store.users[userID]; ok {
+		user.TOTPEnabled = false
+		user.totpSecret = ""
+		user.totpLastStep = 0
+		r.store.users[userID] = user
+	}
+	delete(r.store.recoveryCodes, userID)
+	return nil
+}
+
+func (r *MemoryTwoFactorRepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || !user.TOTPEnabled || user.totpLastStep >= step {
+		return false, nil
+	}
+	user.totpLastStep = step
+	r.store.users[userID] = user
+	return true, nil
+}
+
+func (r *MemoryTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	codes := r.store.recoveryCodes[userID]
+	for i := range codes {
+		if codes[i].hash == codeHash && !codes[i].used {
+			codes[i].used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MemoryPasswordResetRepository - PasswordResetRepository kept in memory
+type MemoryPasswordResetRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryPasswordResetRepository) Create(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[userID]; !ok {
+		return ErrInvalidReference
+	}
+	r.store.resetTokens[tokenHash] = memoryResetToken{userID: userID, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r *MemoryPasswordResetRepository) CountActive(ctx context.Context, userID int) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	for _, token := range r.store.resetTokens {
+		if token.userID == userID && !token.used && token.expiresAt.After(time.Now()) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *MemoryPasswordResetRepository) Lookup(ctx context.Context, tokenHash string) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	token, ok := r.store.resetTokens[tokenHash]
+	if !ok || token.used || !token.expiresAt.After(time.Now()) {
+		return 0, ErrNotFound
+	}
+	return token.userID, nil
+}
+
+func (r *MemoryPasswordResetRepository) Reset(ctx context.Context, tokenHash, hashedPassword string) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	token, ok := r.store.resetTokens[tokenHash]
+	if !ok || token.used || !token.expiresAt.After(time.Now()) {
+		return 0, ErrNotFound
+	}
+	user, ok := r.store.users[token.userID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	user.Password = hashedPassword
+	user.MustChangePassword = false
+	user.ModifiedAt = time.Now()
+	user.ModifiedBy = "password-reset"
+	r.store.users[user.ID] = user
+	r.store.revokeLogins(user.ID)
+
+	for hash, other := range r.store.resetTokens {
+		if other.userID == token.userID {
+			other.used = true
+			r.store.resetTokens[hash] = other
+		}
+	}
+	return token.userID, nil
+}
+
+// MemoryAPIKeyRepository - APIKeyRepository kept in memory
+type MemoryAPIKeyRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, userID int, key *models.APIKey, keyHash string, lifetime time.Duration) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[userID]; !ok {
+		return ErrInvalidReference
+	}
+	for _, existing := range r.store.apiKeys {
+		if existing.hash == keyHash {
+			return ErrDuplicate
+		}
+	}
+	key.ID = r.store.newID()
+	key.CreatedAt = time.Now()
+	key.ExpiresAt = nil
+	if lifetime > 0 {
+		expiresAt := key.CreatedAt.Add(lifetime)
+		key.ExpiresAt = &expiresAt
+	}
+	r.store.apiKeys[key.ID] = memoryAPIKey{APIKey: *key, userID: userID, hash: keyHash}
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) ListActive(ctx context.Context, userID int) ([]models.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range r.store.apiKeys {
+		if key.userID == userID && !key.revoked {
+			keys = append(keys, key.APIKey)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) Revoke(ctx context.Context, id, userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key, ok := r.store.apiKeys[id]
+	if !ok || key.userID != userID || key.revoked {
+		return ErrNotFound
+	}
+	key.revoked = true
+	r.store.apiKeys[id] = key
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) Authenticate(ctx context.Context, keyHash string) (models.APIKey, models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, key := range r.store.apiKeys {
+		if key.hash == keyHash && key.active() {
+			if user, ok := r.store.users[key.userID]; ok {
+				return key.APIKey, user.view(), nil
+			}
+		}
+	}
+	return models.APIKey{}, models.User{}, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) Touch(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if key, ok := r.store.apiKeys[id]; ok {
+		now := time.Now()
+		key.LastUsedAt = &now
+		r.store.apiKeys[id] = key
+	}
+	return nil
+}
+
+// MemorySessionRepository - SessionRepository kept in memory
+type MemorySessionRepository struct {
+	store *memoryStore
+}
+
+func (r *MemorySessionRepository) Create(ctx context.Context, userID int, session *models.Session, tokenHash string, ttl time.Duration) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[userID]; !ok {
+		return ErrInvalidReference
+	}
+	session.ID = r.store.newID()
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	session.ExpiresAt = session.CreatedAt.Add(ttl)
+	r.store.sessions[session.ID] = memorySession{Session: *session, userID: userID, hash: tokenHash}
+	return nil
+}
+
+func (r *MemorySessionRepository) ListActive(ctx context.Context, userID int) ([]models.Session, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range r.store.sessions {
+		if session.userID == userID && session.active() {
+			listed := session.Session
+			listed.CSRFToken = ""
+			sessions = append(sessions, listed)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) Revoke(ctx context.Context, id, userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	session, ok := r.store.sessions[id]
+	if !ok || session.userID != userID || session.revoked {
+		return ErrNotFound
+	}
+	session.revoked = true
+	r.store.sessions[id] = session
+	return nil
+}
+
+func (r *MemorySessionRepository) Authenticate(ctx context.Context, tokenHash string) (models.Session, models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, session := range r.store.sessions {
+		if session.hash == tokenHash && session.active() {
+			if user, ok := r.store.users[session.userID]; ok {
+				return session.Session, user.view(), nil
+			}
+		}
+	}
+	return models.Session{}, models.User{}, ErrNotFound
+}
+
+func (r *MemorySessionRepository) Touch(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if session, ok := r.store.sessions[id]; ok && time.Since(session.LastSeenAt) > time.Minute {
+		session.LastSeenAt = time.Now()
+		r.store.sessions[id] = session
+	}
+	return nil
+}
+
+// MemorySecurityEventRepository - SecurityEventRepository kept in memory
+type MemorySecurityEventRepository struct {
+	store *memoryStore
+}
+
+func (r *MemorySecurityEventRepository) Create(ctx context.Context, event models.SecurityEvent) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	event.ID = int64(r.store.newID())
+	event.CreatedAt = time.Now()
+	r.store.events = append(r.store.events, event)
+	return nil
+}
+
+func (r *MemorySecurityEventRepository) List(ctx context.Context, filter SecurityEventFilter) ([]models.SecurityEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	matches := func(value *string, want string) bool {
+		return want == "" || (value != nil && *value == want)
+	}
+
+	events := []models.SecurityEvent{}
+	for i := len(r.store.events) - 1; i >= 0; i-- {
+		event := r.store.events[i]
+		switch {
+		case filter.EventType != "" && event.EventType != filter.EventType,
+			filter.Outcome != "" && event.Outcome != filter.Outcome,
+			!matches(event.Username, filter.Username),
+			!matches(event.IPAddress, filter.IPAddress),
+			filter.UserID != 0 && (event.UserID == nil || *event.UserID != filter.UserID),
+			!filter.Since.IsZero() && event.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !event.CreatedAt.Before(filter.Until):
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if filter.Offset >= len(events) {
+		return []models.SecurityEvent{}, nil
+	}
+	events = events[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(events) {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
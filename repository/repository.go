@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"time"
+)
+
+var (
+	// ErrNotFound - The requested row does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate - A unique value (e.g. username) is already taken
+	ErrDuplicate = errors.New("duplicate")
+	// ErrInvalidReference - A referenced row (e.g. the book's category) does not exist
+	ErrInvalidReference = errors.New("invalid reference")
+	// ErrInUse - The row is still referenced and cannot be deleted
+	ErrInUse = errors.New("in use")
+	// ErrConflict - The row is not in a state that allows the change (e.g.
+	// 2FA enrollment while 2FA is already enabled)
+	ErrConflict = errors.New("conflict")
+)
+
+// All methods take the request context so a cancelled or timed out
+// request also stops its query.
+
+// BookRepository - Storage for books
+type BookRepository interface {
+	List(ctx context.Context) ([]models.Book, error)
+	ListByCategory(ctx context.Context, categoryID int) ([]models.Book, error)
+	GetByID(ctx context.Context, id int) (models.Book, error)
+	// Create sets ID and CreatedAt on the book. CategoryID 0 means no
+	// category; an unknown category is ErrInvalidReference.
+	Create(ctx context.Context, book *models.Book) error
+	// Update sets CreatedAt, CreatedBy and ModifiedAt on the book
+	Update(ctx context.Context, book *models.Book) error
+	Delete(ctx context.Context, id int) error
+}
+
+// CategoryRepository - Storage for categories
+type CategoryRepository interface {
+	List(ctx context.Context) ([]models.Category, error)
+	GetByID(ctx context.Context, id int) (models.Category, error)
+	// Create sets ID and CreatedAt on the category
+	Create(ctx context.Context, category *models.Category) error
+	// Delete returns ErrInUse while books still belong to the category
+	Delete(ctx context.Context, id int) error
+}
+
+// UserRepository - Storage for user accounts. Users are loaded with the
+// remaining lock time (LockedFor), never with the TOTP secret.
+type UserRepository interface {
+	GetByID(ctx context.Context, id int) (models.User, error)
+	// GetByUsername also loads the password hash
+	GetByUsername(ctx context.Context, username string) (models.User, error)
+	// GetCredentials - GetByID with the password hash
+	GetCredentials(ctx context.Context, id int) (models.User, error)
+	// Create stores a user with an already hashed password and sets ID
+	// and CreatedAt. Returns ErrDuplicate when the username is taken.
+	Create(ctx context.Context, user *models.User) error
+	// SetPassword stores a new password hash and clears must_change_password
+	SetPassword(ctx context.Context, id int, hashedPassword, modifiedBy string) error
+	// RecordFailedLogin counts a failed password and locks the account for
+	// lockFor once threshold consecutive failures are reached
+	RecordFailedLogin(ctx context.Context, id, threshold int, lockFor time.Duration) error
+	ResetFailedLogins(ctx context.Context, id int) error
+	// Unlock clears the lockout and returns the username
+	Unlock(ctx context.Context, id int, modifiedBy string) (username string, err error)
+	// TokenRevoked reports whether a Bearer token issued at issuedAt was
+	// invalidated later (account recovery). ErrNotFound when the user is gone.
+	TokenRevoked(ctx context.Context, id int, issuedAt time.Time) (bool, error)
+	// GetByIdentity finds the user linked to an external (OIDC) identity
+	GetByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	// CreateWithIdentity creates the user and links the identity to it.
+	// Returns ErrDuplicate when the username or the identity is taken.
+	CreateWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error
+}
+
+// TwoFactorRepository - TOTP secrets and recovery codes
+type TwoFactorRepository interface {
+	// GetSecret returns the user's TOTP secret ("" when enrollment was not
+	// started) and whether 2FA is enabled
+	GetSecret(ctx context.Context, userID int) (secret string, enabled bool, err error)
+	// SetPendingSecret stores the secret of an enrollment that still has to
+	// be confirmed. Returns ErrConflict when 2FA is already enabled.
+	SetPendingSecret(ctx context.Context, userID int, secret string) error
+	// Enable turns 2FA on with step as the last used time step and replaces
+	// the recovery codes
+	Enable(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error
+	// Disable turns 2FA off and removes the secret and the recovery codes
+	Disable(ctx context.Context, userID int) error
+	// UseStep records step as used; false when it (or a later one) already
+	// was, so a code cannot be replayed
+	UseStep(ctx context.Context, userID int, step int64) (bool, error)
+	// UseRecoveryCode marks an unused recovery code as used; false when the
+	// user has no such unused code
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+}
+
+// PasswordResetRepository - Password reset tokens (stored as hashes)
+type PasswordResetRepository interface {
+	Create(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error
+	// CountActive counts the user's unused, unexpired tokens
+	CountActive(ctx context.Context, userID int) (int, error)
+	// Lookup returns the user of an unused, unexpired token, or ErrNotFound
+	Lookup(ctx context.Context, tokenHash string) (userID int, err error)
+	// Reset consumes the token, sets the password and invalidates the
+	// user's other tokens. Returns ErrNotFound for an unknown, used or
+	// expired token.
+	Reset(ctx context.Context, tokenHash, hashedPassword string) (userID int, err error)
+}
+
+// APIKeyRepository - API keys (stored as hashes)
+type APIKeyRepository interface {
+	// Create sets ID, ExpiresAt and CreatedAt on the key. A zero lifetime
+	// never expires.
+	Create(ctx context.Context, userID int, key *models.APIKey, keyHash string, lifetime time.Duration) error
+	// ListActive returns the user's keys that are not revoked
+	ListActive(ctx context.Context, userID int) ([]models.APIKey, error)
+	// Revoke returns ErrNotFound unless the user has such an active key
+	Revoke(ctx context.Context, id, userID int) error
+	// Authenticate finds the active, unexpired key and its owner
+	Authenticate(ctx context.Context, keyHash string) (models.APIKey, models.User, error)
+	// Touch records that the key was used
+	Touch(ctx context.Context, id int) error
+}
+
+// SessionRepository - Browser sessions (tokens stored as hashes)
+type SessionRepository interface {
+	// Create sets ID, CreatedAt, LastSeenAt and ExpiresAt on the session
+	Create(ctx context.Context, userID int, session *models.Session, tokenHash string, ttl time.Duration) error
+	// ListActive returns the user's unrevoked, unexpired sessions, most
+	// recently used first
+	ListActive(ctx context.Context, userID int) ([]models.Session, error)
+	// Revoke returns ErrNotFound unless the user has such an active session
+	Revoke(ctx context.Context, id, userID int) error
+	// Authenticate finds the active, unexpired session and its owner
+	Authenticate(ctx context.Context, tokenHash string) (models.Session, models.User, error)
+	// Touch updates last_seen_at, at most once a minute
+	Touch(ctx context.Context, id int) error
+}
+
+// SecurityEventFilter - Conditions for listing security events; zero
+// values do not filter
+type SecurityEventFilter struct {
+	EventType string
+	Outcome   string
+	Username  string
+	UserID    int
+	IPAddress string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	Offset    int
+}
+
+// SecurityEventRepository - Audit log of security events
+type SecurityEventRepository interface {
+	// Create stores the event (ID and CreatedAt are assigned by the store)
+	Create(ctx context.Context, event models.SecurityEvent) error
+	// List returns matching events, newest first
+	List(ctx context.Context, filter SecurityEventFilter) ([]models.SecurityEvent, error)
+}
+
+// Repositories - One implementation of every repository
+type Repositories struct {
+	Books          BookRepository
+	Categories     CategoryRepository
+	Users          UserRepository
+	TwoFactor      TwoFactorRepository
+	PasswordResets PasswordResetRepository
+	APIKeys        APIKeyRepository
+	Sessions       SessionRepository
+	SecurityEvents SecurityEventRepository
+}
+
+// NewSQL - Repositories backed by the SQL database (any database.Dialect). Book
+// and category reads go to replicas when there are any (replicas may be
+// nil); everything else always uses the primary.
+func NewSQL(db *sql.DB, replicas *database.ReplicaSet) *Repositories {
+	return &Repositories{
+		Books:          &SQLBookRepository{DB: db, Replicas: replicas},
+		Categories:     &SQLCategoryRepository{DB: db, Replicas: replicas},
+		Users:          &SQLUserRepository{DB: db},
+		TwoFactor:      &SQLTwoFactorRepository{DB: db},
+		PasswordResets: &SQLPasswordResetRepository{DB: db},
+		APIKeys:        &SQLAPIKeyRepository{DB: db},
+		Sessions:       &SQLSessionRepository{DB: db},
+		SecurityEvents: &SQLSecurityEventRepository{DB: db},
+	}
+}
+
+// NewMemory - Repositories kept in memory (tests and tooling)
+func NewMemory() *Repositories {
+	store := newMemoryStore()
+	return &Repositories{
+		Books:          &MemoryBookRepository{store: store},
+		Categories:     &MemoryCategoryRepository{store: store},
+		Users:          &MemoryUserRepository{store: store},
+		TwoFactor:      &MemoryTwoFactorRepository{store: store},
+		PasswordResets: &MemoryPasswordResetRepository{store: store},
+		APIKeys:        &MemoryAPIKeyRepository{store: store},
+		Sessions:       &MemorySessionRepository{store: store},
+		SecurityEvents: &MemorySecurityEventRepository{store: store},
+	}
+}
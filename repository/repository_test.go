@@ -0,0 +1,272 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+// The same tests run against the in-memory store and every SQL driver
+// available (see dbtest), so the implementations cannot drift apart.
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// forEachStore - Run fn in a subtest per implementation, each on an empty store
+func forEachStore(t *testing.T, fn func(t *testing.T, repos *repository.Repositories)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, repository.NewMemory())
+	})
+	dbtest.Run(t, func(t *testing.T) {
+		fn(t, repository.NewSQL(database.DB, nil))
+	})
+}
+
+func createUser(t *testing.T, repos *repository.Repositories, username string) models.User {
+	t.Helper()
+	user := models.User{Username: username, Password: "hash-" + username, Role: "user", CreatedBy: "test"}
+	if err := repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func expectErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("%s: err = %v, want %v", what, err, want)
+	}
+}
+
+func TestCategories(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+
+		category := models.Category{Name: "Fiksi", CreatedBy: "test"}
+		if err := repos.Categories.Create(ctx, &category); err != nil {
+			t.Fatal(err)
+		}
+		if category.ID == 0 || category.CreatedAt.IsZero() {
+			t.Fatalf("created = %+v, want ID and CreatedAt set", category)
+		}
+
+		got, err := repos.Categories.GetByID(ctx, category.ID)
+		if err != nil || got.Name != "Fiksi" || got.CreatedBy != "test" {
+			t.Fatalf("GetByID = %+v, %v", got, err)
+		}
+		list, err := repos.Categories.List(ctx)
+		if err != nil || len(list) != 1 {
+			t.Fatalf("List = %+v, %v", list, err)
+		}
+
+		book := models.Book{Title: "Kosmos", ReleaseYear: 2001, Price: 1, TotalPage: 300, Thickness: "tebal", CategoryID: category.ID, CreatedBy: "test"}
+		if err := repos.Books.Create(ctx, &book); err != nil {
+			t.Fatal(err)
+		}
+		expectErr(t, "Delete with books", repos.Categories.Delete(ctx, category.ID), repository.ErrInUse)
+
+		if err := repos.Books.Delete(ctx, book.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Categories.Delete(ctx, category.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err = repos.Categories.GetByID(ctx, category.ID)
+		expectErr(t, "GetByID after Delete", err, repository.ErrNotFound)
+		expectErr(t, "Delete twice", repos.Categories.Delete(ctx, category.ID), repository.ErrNotFound)
+	})
+}
+
+func TestBooks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+
+		category := models.Category{Name: "Sains", CreatedBy: "test"}
+		if err := repos.Categories.Create(ctx, &category); err != nil {
+			t.Fatal(err)
+		}
+
+		invalid := models.Book{Title: "x", ReleaseYear: 2000, Price: 1, TotalPage: 1, Thickness: "tipis", CategoryID: category.ID + 100, CreatedBy: "test"}
+		expectErr(t, "Create with unknown category", repos.Books.Create(ctx, &invalid), repository.ErrInvalidReference)
+
+		book := models.Book{Title: "Kosmos", ReleaseYear: 2001, Price: 1, TotalPage: 300, Thickness: "tebal", CategoryID: category.ID, CreatedBy: "alice"}
+		if err := repos.Books.Create(ctx, &book); err != nil {
+			t.Fatal(err)
+		}
+		uncategorized := models.Book{Title: "Catatan", ReleaseYear: 1999, Price: 1, TotalPage: 10, Thickness: "tipis", CreatedBy: "alice"}
+		if err := repos.Books.Create(ctx, &uncategorized); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repos.Books.GetByID(ctx, book.ID)
+		if err != nil || got.Title != "Kosmos" || got.CategoryID != category.ID {
+			t.Fatalf("GetByID = %+v, %v", got, err)
+		}
+		if got.Category == nil || got.Category.Name != "Sains" {
+			t.Fatalf("GetByID category = %+v, want Sains", got.Category)
+		}
+		if got, err := repos.Books.GetByID(ctx, uncategorized.ID); err != nil || got.CategoryID != 0 || got.Category != nil {
+			t.Fatalf("uncategorized = %+v, %v", got, err)
+		}
+
+		inCategory, err := repos.Books.ListByCategory(ctx, category.ID)
+		if err != nil || len(inCategory) != 1 || inCategory[0].ID != book.ID {
+			t.Fatalf("ListByCategory = %+v, %v", inCategory, err)
+		}
+		all, err := repos.Books.List(ctx)
+		if err != nil || len(all) != 2 {
+			t.Fatalf("List = %+v, %v", all, err)
+		}
+
+		update := models.Book{ID: book.ID, Title: "Kosmos 2", ReleaseYear: 2002, Price: 2, TotalPage: 50, Thickness: "tipis", ModifiedBy: "bob"}
+		if err := repos.Books.Update(ctx, &update); err != nil {
+			t.Fatal(err)
+		}
+		if update.CreatedBy != "alice" || update.CreatedAt.IsZero() || update.ModifiedAt.IsZero() {
+			t.Fatalf("updated = %+v, want creation fields kept", update)
+		}
+		missing := models.Book{ID: book.ID + 100, Title: "x", ReleaseYear: 2000, Price: 1, TotalPage: 1, Thickness: "tipis", ModifiedBy: "bob"}
+		expectErr(t, "Update unknown book", repos.Books.Update(ctx, &missing), repository.ErrNotFound)
+
+		if err := repos.Books.Delete(ctx, book.ID); err != nil {
+			t.Fatal(err)
+		}
+		expectErr(t, "Delete twice", repos.Books.Delete(ctx, book.ID), repository.ErrNotFound)
+	})
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+
+		user := createUser(t, repos, "budi")
+		if user.ID == 0 || user.CreatedAt.IsZero() {
+			t.Fatalf("created = %+v", user)
+		}
+		duplicate := models.User{Username: "budi", Password: "x", Role: "user", CreatedBy: "test"}
+		expectErr(t, "Create duplicate", repos.Users.Create(ctx, &duplicate), repository.ErrDuplicate)
+
+		byName, err := repos.Users.GetByUsername(ctx, "budi")
+		if err != nil || byName.ID != user.ID || byName.Password != "hash-budi" {
+			t.Fatalf("GetByUsername = %+v, %v", byName, err)
+		}
+		byID, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil || byID.Username != "budi" || byID.Password != "" {
+			t.Fatalf("GetByID = %+v, %v; want no password hash", byID, err)
+		}
+		if withPassword, err := repos.Users.GetCredentials(ctx, user.ID); err != nil || withPassword.Password != "hash-budi" {
+			t.Fatalf("GetCredentials = %+v, %v", withPassword, err)
+		}
+		_, err = repos.Users.GetByUsername(ctx, "nobody")
+		expectErr(t, "GetByUsername unknown", err, repository.ErrNotFound)
+		_, err = repos.Users.GetByID(ctx, user.ID+100)
+		expectErr(t, "GetByID unknown", err, repository.ErrNotFound)
+	})
+}
+
+func TestUserLockout(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "budi")
+
+		lockedFor := func() time.Duration {
+			t.Helper()
+			got, err := repos.Users.GetByID(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return got.LockedFor
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := repos.Users.RecordFailedLogin(ctx, user.ID, 3, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if lockedFor() != 0 {
+			t.Fatal("locked below the threshold")
+		}
+
+		// A success in between starts the count again
+		if err := repos.Users.ResetFailedLogins(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			repos.Users.RecordFailedLogin(ctx, user.ID, 3, time.Hour)
+		}
+		if lockedFor() != 0 {
+			t.Fatal("failures before a success counted")
+		}
+
+		repos.Users.RecordFailedLogin(ctx, user.ID, 3, time.Hour)
+		if d := lockedFor(); d < 59*time.Minute || d > time.Hour+time.Second {
+			t.Fatalf("LockedFor = %v, want about an hour", d)
+		}
+
+		username, err := repos.Users.Unlock(ctx, user.ID, "admin")
+		if err != nil || username != "budi" {
+			t.Fatalf("Unlock = %q, %v", username, err)
+		}
+		if lockedFor() != 0 {
+			t.Fatal("still locked after Unlock")
+		}
+		_, err = repos.Users.Unlock(ctx, user.ID+100, "admin")
+		expectErr(t, "Unlock unknown", err, repository.ErrNotFound)
+	})
+}
+
+func TestUserPassword(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := models.User{Username: "budi", Password: "old", Role: "user", MustChangePassword: true, CreatedBy: "test"}
+		if err := repos.Users.Create(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := repos.Users.SetPassword(ctx, user.ID, "new", "budi"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := repos.Users.GetByUsername(ctx, "budi")
+		if err != nil || got.Password != "new" || got.MustChangePassword {
+			t.Fatalf("after SetPassword = %+v, %v", got, err)
+		}
+	})
+}
+
+func TestUserIdentities(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+
+		_, err := repos.Users.GetByIdentity(ctx, "https://idp", "alice")
+		expectErr(t, "GetByIdentity unlinked", err, repository.ErrNotFound)
+
+		user := models.User{Username: "alice", Password: "x", Email: "alice@example.com", CreatedBy: "oidc"}
+		if err := repos.Users.CreateWithIdentity(ctx, &user, "https://idp", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := repos.Users.GetByIdentity(ctx, "https://idp", "alice")
+		if err != nil || got.ID != user.ID || got.Email != "alice@example.com" || got.Role != "user" {
+			t.Fatalf("GetByIdentity = %+v, %v", got, err)
+		}
+
+		// Neither the username nor the identity can be taken twice, and a
+		// failed link leaves no user behind
+		again := models.User{Username: "alice2", Password: "x", CreatedBy: "oidc"}
+		expectErr(t, "link identity twice", repos.Users.CreateWithIdentity(ctx, &again, "https://idp", "alice"), repository.ErrDuplicate)
+		_, err = repos.Users.GetByUsername(ctx, "alice2")
+		expectErr(t, "user of the failed link", err, repository.ErrNotFound)
+		taken := models.User{Username: "alice", Password: "x", CreatedBy: "oidc"}
+		expectErr(t, "username taken", repos.Users.CreateWithIdentity(ctx, &taken, "https://idp", "other"), repository.ErrDuplicate)
+	})
+}
@@ -0,0 +1,384 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"time"
+)
+
+const bookColumns = `
+    SELECT b.id, b.title, b.description, b.image_url, b.release_year,
+           b.price, b.total_page, b.thickness, b.category_id,
+           b.created_at, b.created_by,
+           c.id as category_id, c.name as category_name
+    FROM books b
+    LEFT JOIN categories c ON b.category_id = c.id
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// rowQueryer - A pool or a transaction
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scanBook - Scan a row selected with bookColumns
+func scanBook(row rowScanner) (models.Book, error) {
+	var book models.Book
+	var bookCategoryID sql.NullInt64
+	var categoryID *int
+	var categoryName *string
+
+	err := row.Scan(
+		&book.ID, &book.Title, &book.Description, &book.ImageURL,
+		&book.ReleaseYear, &book.Price, &book.TotalPage, &book.Thickness,
+		&bookCategoryID, &book.CreatedAt, &book.CreatedBy,
+		&categoryID, &categoryName,
+	)
+	if err != nil {
+		return book, err
+	}
+	// Books without a category (or whose category was deleted) report 0
+	book.CategoryID = int(bookCategoryID.Int64)
+
+	if categoryID != nil && categoryName != nil {
+		book.Category = &models.Category{
+			ID:   *categoryID,
+			Name: *categoryName,
+		}
+	}
+	return book, nil
+}
+
+// notFound - Translate sql.ErrNoRows into ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// invalidReference - Translate a foreign key violation into ErrInvalidReference
+func invalidReference(err error) error {
+	if database.IsForeignKeyViolation(err) {
+		return ErrInvalidReference
+	}
+	return err
+}
+
+// requireAffected - ErrNotFound when an UPDATE/DELETE matched no rows
+func requireAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// reader - Pool for a read-only query: a replica when configured
+func reader(ctx context.Context, db *sql.DB, replicas *database.ReplicaSet) *sql.DB {
+	if replicas == nil {
+		return db
+	}
+	return replicas.Reader(ctx)
+}
+
+// SQLBookRepository - BookRepository on database/sql
+type SQLBookRepository struct {
+	DB       *sql.DB
+	Replicas *database.ReplicaSet
+}
+
+func (r *SQLBookRepository) List(ctx context.Context) ([]models.Book, error) {
+	return r.query(ctx, bookColumns+" ORDER BY b.id")
+}
+
+func (r *SQLBookRepository) ListByCategory(ctx context.Context, categoryID int) ([]models.Book, error) {
+	return r.query(ctx, bookColumns+" WHERE b.category_id = $1 ORDER BY b.id", categoryID)
+}
+
+func (r *SQLBookRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.Book, error) {
+	rows, err := reader(ctx, r.DB, r.Replicas).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+func (r *SQLBookRepository) GetByID(ctx context.Context, id int) (models.Book, error) {
+	book, err := scanBook(reader(ctx, r.DB, r.Replicas).QueryRowContext(ctx, bookColumns+" WHERE b.id = $1", id))
+	return book, notFound(err)
+}
+
+func (r *SQLBookRepository) Create(ctx context.Context, book *models.Book) error {
+	query := `
+        INSERT INTO books (title, description, image_url, release_year,
+                          price, total_page, thickness, category_id, created_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9)
+        RETURNING id, created_at
+    `
+	err := r.DB.QueryRowContext(ctx, query,
+		book.Title, book.Description, book.ImageURL, book.ReleaseYear,
+		book.Price, book.TotalPage, book.Thickness, book.CategoryID, book.CreatedBy,
+	).Scan(&book.ID, &book.CreatedAt)
+	return invalidReference(err)
+}
+
+func (r *SQLBookRepository) Update(ctx context.Context, book *models.Book) error {
+	query := `
+        UPDATE books
+        SET title = $1, description = $2, image_url = $3, release_year = $4,
+            price = $5, total_page = $6, thickness = $7, category_id = NULLIF($8, 0),
+            modified_at = CURRENT_TIMESTAMP, modified_by = $9
+        WHERE id = $10
+        RETURNING created_at, COALESCE(created_by, ''), modified_at
+    `
+	err := r.DB.QueryRowContext(ctx, query,
+		book.Title, book.Description, book.ImageURL, book.ReleaseYear,
+		book.Price, book.TotalPage, book.Thickness, book.CategoryID,
+		book.ModifiedBy, book.ID,
+	).Scan(&book.CreatedAt, &book.CreatedBy, &book.ModifiedAt)
+	return invalidReference(notFound(err))
+}
+
+func (r *SQLBookRepository) Delete(ctx context.Context, id int) error {
+	return requireAffected(r.DB.ExecContext(ctx, "DELETE FROM books WHERE id = $1", id))
+}
+
+// SQLCategoryRepository - CategoryRepository on database/sql
+type SQLCategoryRepository struct {
+	DB       *sql.DB
+	Replicas *database.ReplicaSet
+}
+
+func (r *SQLCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	rows, err := reader(ctx, r.DB, r.Replicas).QueryContext(ctx, "SELECT id, name, created_at, created_by FROM categories ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var cat models.Category
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.CreatedAt, &cat.CreatedBy); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+func (r *SQLCategoryRepository) GetByID(ctx context.Context, id int) (models.Category, error) {
+	var category models.Category
+	query := "SELECT id, name, created_at, created_by FROM categories WHERE id = $1"
+	err := reader(ctx, r.DB, r.Replicas).QueryRowContext(ctx, query, id).Scan(&category.ID, &category.Name, &category.CreatedAt, &category.CreatedBy)
+	return category, notFound(err)
+}
+
+func (r *SQLCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	query := `INSERT INTO categories (name, created_by) VALUES ($1, $2) RETURNING id, created_at`
+	return r.DB.QueryRowContext(ctx, query, category.Name, category.CreatedBy).Scan(&category.ID, &category.CreatedAt)
+}
+
+func (r *SQLCategoryRepository) Delete(ctx context.Context, id int) error {
+	return database.WithTx(ctx, r.DB, nil, func(tx *sql.Tx) error {
+		// Locking the row blocks books being inserted into the category
+		// (their foreign key check needs a share lock) until we are done.
+		// SQLite has no row locks, its writers are serialized anyway.
+		var locked int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM categories WHERE id = $1"+database.Dialect.ForUpdate(), id).Scan(&locked)
+		if err != nil {
+			return notFound(err)
+		}
+
+		var hasBooks bool
+		err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM books WHERE category_id = $1)", id).Scan(&hasBooks)
+		if err != nil {
+			return err
+		}
+		if hasBooks {
+			return ErrInUse
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", id)
+		return err
+	})
+}
+
+// SQLUserRepository - UserRepository on database/sql
+type SQLUserRepository struct {
+	DB *sql.DB
+}
+
+// userColumns - Columns read by scanUser. The remaining lock time is
+// computed by the database so app and DB clocks do not have to agree.
+func userColumns() string {
+	return `u.id, u.username, COALESCE(u.email, ''), u.role, u.totp_enabled, u.must_change_password,
+            u.created_at, COALESCE(u.created_by, ''), COALESCE(` + database.Dialect.SecondsUntil("u.locked_until") + `, 0)`
+}
+
+// scanUser - Scan a row selected with userColumns (and the password hash
+// after them when password is not nil)
+func scanUser(row rowScanner, password *string) (models.User, error) {
+	var user models.User
+	var lockSeconds float64
+	dest := []interface{}{&user.ID, &user.Username, &user.Email, &user.Role, &user.TOTPEnabled, &user.MustChangePassword,
+		&user.CreatedAt, &user.CreatedBy, &lockSeconds}
+	if password != nil {
+		dest = append(dest, password)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return user, notFound(err)
+	}
+	if lockSeconds > 0 {
+		user.LockedFor = time.Duration(lockSeconds * float64(time.Second))
+	}
+	return user, nil
+}
+
+func (r *SQLUserRepository) GetByID(ctx context.Context, id int) (models.User, error) {
+	return scanUser(r.DB.QueryRowContext(ctx, "SELECT "+userColumns()+" FROM users u WHERE u.id = $1", id), nil)
+}
+
+func (r *SQLUserRepository) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	var password string
+	user, err := scanUser(r.DB.QueryRowContext(ctx, "SELECT "+userColumns()+", u.password FROM users u WHERE u.username = $1", username), &password)
+	user.Password = password
+	return user, err
+}
+
+func (r *SQLUserRepository) GetCredentials(ctx context.Context, id int) (models.User, error) {
+	var password string
+	user, err := scanUser(r.DB.QueryRowContext(ctx, "SELECT "+userColumns()+", u.password FROM users u WHERE u.id = $1", id), &password)
+	user.Password = password
+	return user, err
+}
+
+func (r *SQLUserRepository) Create(ctx context.Context, user *models.User) error {
+	return createUser(ctx, r.DB, user)
+}
+
+// createUser - Insert a user on db (a pool or a transaction)
+func createUser(ctx context.Context, db rowQueryer, user *models.User) error {
+	query := `
+        INSERT INTO users (username, password, email, role, created_by)
+        VALUES ($1, $2, NULLIF($3, ''), COALESCE(NULLIF($4, ''), 'user'), $5)
+        RETURNING id, role, created_at
+    `
+	err := db.QueryRowContext(ctx, query, user.Username, user.Password, user.Email, user.Role, user.CreatedBy).Scan(&user.ID, &user.Role, &user.CreatedAt)
+	if database.IsUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *SQLUserRepository) SetPassword(ctx context.Context, id int, hashedPassword, modifiedBy string) error {
+	return database.WithTx(ctx, r.DB, nil, func(tx *sql.Tx) error {
+		err := requireAffected(tx.ExecContext(ctx, `
+            UPDATE users
+            SET password = $1, must_change_password = FALSE, tokens_valid_after = CURRENT_TIMESTAMP,
+                modified_at = CURRENT_TIMESTAMP, modified_by = $2
+            WHERE id = $3
+        `, hashedPassword, modifiedBy, id))
+		if err != nil {
+			return err
+		}
+		return revokeLogins(ctx, tx, id)
+	})
+}
+
+// revokeLogins - Delete the user's sessions and revoke the API keys, as
+// create-admin does; Bearer tokens go with tokens_valid_after, which the
+// caller sets together with the new password
+func revokeLogins(ctx context.Context, tx *sql.Tx, userID int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return err
+}
+
+func (r *SQLUserRepository) RecordFailedLogin(ctx context.Context, id, threshold int, lockFor time.Duration) error {
+	// locked_until comes first: MySQL evaluates SET assignments in order and
+	// would see the counter already reset
+	_, err := r.DB.ExecContext(ctx, `
+        UPDATE users
+        SET locked_until = CASE WHEN failed_login_attempts + 1 >= $2
+                                THEN `+database.Dialect.AddSeconds("CURRENT_TIMESTAMP", "$3")+`
+                                ELSE locked_until END,
+            failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $2 THEN 0 ELSE failed_login_attempts + 1 END
+        WHERE id = $1
+    `, id, threshold, int(lockFor.Seconds()))
+	return err
+}
+
+func (r *SQLUserRepository) ResetFailedLogins(ctx context.Context, id int) error {
+	_, err := r.DB.ExecContext(ctx, "UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1", id)
+	return err
+}
+
+func (r *SQLUserRepository) Unlock(ctx context.Context, id int, modifiedBy string) (string, error) {
+	var username string
+	query := `
+        UPDATE users
+        SET failed_login_attempts = 0, locked_until = NULL,
+            modified_at = CURRENT_TIMESTAMP, modified_by = $1
+        WHERE id = $2
+        RETURNING username
+    `
+	err := r.DB.QueryRowContext(ctx, query, modifiedBy, id).Scan(&username)
+	return username, notFound(err)
+}
+
+// TokenRevoked - JWTs carry whole seconds, so a token from the second of
+// the invalidation counts as revoked
+func (r *SQLUserRepository) TokenRevoked(ctx context.Context, id int, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	query := `
+        SELECT CASE WHEN tokens_valid_after >= ` + database.Dialect.Timestamp("$2") + ` THEN TRUE ELSE FALSE END
+        FROM users
+        WHERE id = $1
+    `
+	err := r.DB.QueryRowContext(ctx, query, id, issuedAt.UTC().Format(time.RFC3339)).Scan(&revoked)
+	return revoked, notFound(err)
+}
+
+func (r *SQLUserRepository) GetByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	query := `
+        SELECT ` + userColumns() + `
+        FROM user_identities i
+        JOIN users u ON u.id = i.user_id
+        WHERE i.issuer = $1 AND i.subject = $2
+    `
+	return scanUser(r.DB.QueryRowContext(ctx, query, issuer, subject), nil)
+}
+
+func (r *SQLUserRepository) CreateWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error {
+	return database.WithTx(ctx, r.DB, nil, func(tx *sql.Tx) error {
+		if err := createUser(ctx, tx, user); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)", user.ID, issuer, subject)
+		if database.IsUniqueViolation(err) {
+			return ErrDuplicate
+		}
+		return err
+	})
+}
@@ -0,0 +1,381 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/models"
+	"strings"
+	"time"
+)
+
+// affected - Whether an UPDATE/DELETE matched a row
+func affected(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// SQLTwoFactorRepository - TwoFactorRepository on database/sql
+type SQLTwoFactorRepository struct {
+	DB *sql.DB
+}
+
+func (r *SQLTwoFactorRepository) GetSecret(ctx context.Context, userID int) (string, bool, error) {
+	var secret sql.NullString
+	var enabled bool
+	err := r.DB.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id = $1", userID).Scan(&secret, &enabled)
+	return secret.String, enabled, notFound(err)
+}
+
+func (r *SQLTwoFactorRepository) SetPendingSecret(ctx context.Context, userID int, secret string) error {
+	ok, err := affected(r.DB.ExecContext(ctx, "UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_enabled = FALSE", secret, userID))
+	if err == nil && !ok {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *SQLTwoFactorRepository) Enable(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	return database.WithTx(ctx, r.DB, nil, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2", step, userID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+			return err
+		}
+		for _, hash := range recoveryCodeHashes {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *SQLTwoFactorRepository) Disable(ctx context.Context, userID int) error {
+	return database.WithTx(ctx, r.DB, nil, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = 0 WHERE id = $1", userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+		return err
+	})
+}
+
+func (r *SQLTwoFactorRepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	return affected(r.DB.ExecContext(ctx, "UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_enabled = TRUE AND totp_last_step < $1", step, userID))
+}
+
+// UseRecoveryCode - The code row is locked and then marked in a second
+// statement: MySQL rejects an UPDATE that selects from its own table in a
+// subquery (error 1093)
+func (r *SQLTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	var used bool
+	err := database.WithTx(ctx, r.DB, nil, func(tx *sql.Tx) error {
+		used = false
+		var id int
+		err := tx.QueryRowContext(ctx, `
+            SELECT id FROM user_recovery_codes
+            WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+            LIMIT 1`+database.Dialect.ForUpdate(), userID, codeHash).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		used, err = affected(tx.ExecContext(ctx, "UPDATE user_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL", id))
+		return err
+	})
+	return used, err
+}
+
+// SQLPasswordResetRepository - PasswordResetRepository on database/sql
+type SQLPasswordResetRepository struct {
+	DB *sql.DB
+}
+
+func (r *SQLPasswordResetRepository) Create(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error {
+	_, err := r.DB.ExecContext(ctx, `
+        INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+        VALUES ($1, $2, `+database.Dialect.AddSeconds("CURRENT_TIMESTAMP", "$3")+`)
+    `, userID, tokenHash, int(ttl.Seconds()))
+	return err
+}
+
+func (r *SQLPasswordResetRepository) CountActive(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM password_reset_tokens
+        WHERE user_id = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+    `, userID).Scan(&count)
+	return count, err
+}
+
+func (r *SQLPasswordResetRepository) Lookup(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := r.DB.QueryRowContext(ctx, `
+        SELECT user_id FROM password_reset_tokens
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+    `, tokenHash).Scan(&userID)
+	return userID, notFound(err)
+}
+
+func (r *SQLPasswordResetRepository) Reset(ctx context.Context, tokenHash, hashedPassword string) (int, error) {
+	// Consume the token, set the password and invalidate the user's other
+	// tokens together, so a token can only be used once. Whoever knew the
+	// old password loses every login with it.
+	var userID int
+	err := database.WithTx(ctx, r.DB, nil, func(tx *sql.Tx) error {
+		query := `
+            UPDATE password_reset_tokens
+            SET used_at = CURRENT_TIMESTAMP
+            WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+            RETURNING user_id
+        `
+		if err := tx.QueryRowContext(ctx, query, tokenHash).Scan(&userID); err != nil {
+			return notFound(err)
+		}
+
+		_, err := tx.ExecContext(ctx, `
+            UPDATE users
+            SET password = $1, must_change_password = FALSE, tokens_valid_after = CURRENT_TIMESTAMP,
+                modified_at = CURRENT_TIMESTAMP, modified_by = $2
+            WHERE id = $3
+        `, hashedPassword, "password-reset", userID)
+		if err != nil {
+			return err
+		}
+		if err := revokeLogins(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL", userID)
+		return err
+	})
+	return userID, err
+}
+
+// SQLAPIKeyRepository - APIKeyRepository on database/sql
+type SQLAPIKeyRepository struct {
+	DB *sql.DB
+}
+
+func (r *SQLAPIKeyRepository) Create(ctx context.Context, userID int, key *models.APIKey, keyHash string, lifetime time.Duration) error {
+	// Keys without a lifetime never expire (NULL + interval is NULL)
+	var seconds interface{}
+	if lifetime > 0 {
+		seconds = int(lifetime.Seconds())
+	}
+	query := `
+        INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+        VALUES ($1, $2, $3, $4, $5, ` + database.Dialect.AddSeconds("CURRENT_TIMESTAMP", "$6") + `)
+        RETURNING id, expires_at, created_at
+    `
+	return r.DB.QueryRowContext(ctx, query,
+		userID, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, ","), seconds,
+	).Scan(&key.ID, &key.ExpiresAt, &key.CreatedAt)
+}
+
+func (r *SQLAPIKeyRepository) ListActive(ctx context.Context, userID int) ([]models.APIKey, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+        SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+        FROM api_keys
+        WHERE user_id = $1 AND revoked_at IS NULL
+        ORDER BY id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var scopes string
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *SQLAPIKeyRepository) Revoke(ctx context.Context, id, userID int) error {
+	return requireAffected(r.DB.ExecContext(ctx, `
+        UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+    `, id, userID))
+}
+
+func (r *SQLAPIKeyRepository) Authenticate(ctx context.Context, keyHash string) (models.APIKey, models.User, error) {
+	var key models.APIKey
+	var scopes string
+	query := `
+        SELECT k.id, k.name, k.prefix, k.scopes, ` + userColumns() + `
+        FROM api_keys k
+        JOIN users u ON u.id = k.user_id
+        WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+          AND (k.expires_at IS NULL OR k.expires_at > CURRENT_TIMESTAMP)
+    `
+	user, err := scanUser(prefixedRow{r.DB.QueryRowContext(ctx, query, keyHash), []interface{}{&key.ID, &key.Name, &key.Prefix, &scopes}}, nil)
+	key.Scopes = strings.Split(scopes, ",")
+	return key, user, err
+}
+
+func (r *SQLAPIKeyRepository) Touch(ctx context.Context, id int) error {
+	_, err := r.DB.ExecContext(ctx, "UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+	return err
+}
+
+// prefixedRow - A row whose first columns go to dest and the rest to
+// whoever scans it (scanUser after the key or session columns)
+type prefixedRow struct {
+	row  rowScanner
+	dest []interface{}
+}
+
+func (p prefixedRow) Scan(dest ...interface{}) error {
+	return p.row.Scan(append(p.dest, dest...)...)
+}
+
+// SQLSessionRepository - SessionRepository on database/sql
+type SQLSessionRepository struct {
+	DB *sql.DB
+}
+
+func (r *SQLSessionRepository) Create(ctx context.Context, userID int, session *models.Session, tokenHash string, ttl time.Duration) error {
+	query := `
+        INSERT INTO sessions (user_id, token_hash, csrf_token, ip_address, user_agent, expires_at)
+        VALUES ($1, $2, $3, $4, $5, ` + database.Dialect.AddSeconds("CURRENT_TIMESTAMP", "$6") + `)
+        RETURNING id, created_at, last_seen_at, expires_at
+    `
+	return r.DB.QueryRowContext(ctx, query,
+		userID, tokenHash, session.CSRFToken, session.IPAddress, session.UserAgent, int(ttl.Seconds()),
+	).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+}
+
+func (r *SQLSessionRepository) ListActive(ctx context.Context, userID int) ([]models.Session, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+        SELECT id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at, last_seen_at, expires_at
+        FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+        ORDER BY last_seen_at DESC, id DESC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.IPAddress, &session.UserAgent, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SQLSessionRepository) Revoke(ctx context.Context, id, userID int) error {
+	return requireAffected(r.DB.ExecContext(ctx, `
+        UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+    `, id, userID))
+}
+
+func (r *SQLSessionRepository) Authenticate(ctx context.Context, tokenHash string) (models.Session, models.User, error) {
+	var session models.Session
+	query := `
+        SELECT s.id, s.csrf_token, s.expires_at, ` + userColumns() + `
+        FROM sessions s
+        JOIN users u ON u.id = s.user_id
+        WHERE s.token_hash = $1 AND s.revoked_at IS NULL AND s.expires_at > CURRENT_TIMESTAMP
+    `
+	user, err := scanUser(prefixedRow{r.DB.QueryRowContext(ctx, query, tokenHash), []interface{}{&session.ID, &session.CSRFToken, &session.ExpiresAt}}, nil)
+	return session, user, err
+}
+
+func (r *SQLSessionRepository) Touch(ctx context.Context, id int) error {
+	_, err := r.DB.ExecContext(ctx, `
+        UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND last_seen_at < `+database.Dialect.AddSeconds("CURRENT_TIMESTAMP", "-60")+`
+    `, id)
+	return err
+}
+
+// SQLSecurityEventRepository - SecurityEventRepository on database/sql
+type SQLSecurityEventRepository struct {
+	DB *sql.DB
+}
+
+func (r *SQLSecurityEventRepository) Create(ctx context.Context, event models.SecurityEvent) error {
+	_, err := r.DB.ExecContext(ctx, `
+        INSERT INTO security_events (event_type, outcome, user_id, username, ip_address, user_agent, details)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, event.EventType, event.Outcome, event.UserID, event.Username, event.IPAddress, event.UserAgent, event.Details)
+	return err
+}
+
+func (r *SQLSecurityEventRepository) List(ctx context.Context, filter SecurityEventFilter) ([]models.SecurityEvent, error) {
+	var conditions []string
+	var args []interface{}
+	addFilter := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	for condition, value := range map[string]string{
+		"event_type = $%d": filter.EventType,
+		"outcome = $%d":    filter.Outcome,
+		"username = $%d":   filter.Username,
+		"ip_address = $%d": filter.IPAddress,
+	} {
+		if value != "" {
+			addFilter(condition, value)
+		}
+	}
+	if filter.UserID != 0 {
+		addFilter("user_id = $%d", filter.UserID)
+	}
+	if !filter.Since.IsZero() {
+		addFilter("created_at >= "+database.Dialect.Timestamp("$%d"), filter.Since.UTC().Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		addFilter("created_at < "+database.Dialect.Timestamp("$%d"), filter.Until.UTC().Format(time.RFC3339))
+	}
+
+	query := `
+        SELECT id, event_type, outcome, user_id, username, ip_address, user_agent, details, created_at
+        FROM security_events
+    `
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.SecurityEvent{}
+	for rows.Next() {
+		var event models.SecurityEvent
+		err := rows.Scan(&event.ID, &event.EventType, &event.Outcome, &event.UserID, &event.Username,
+			&event.IPAddress, &event.UserAgent, &event.Details, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,324 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/models"
+	"mini-project-buku-sb-go-73-Agil/repository"
+)
+
+func TestTwoFactor(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "budi")
+
+		if secret, enabled, err := repos.TwoFactor.GetSecret(ctx, user.ID); err != nil || secret != "" || enabled {
+			t.Fatalf("GetSecret before enrollment = %q, %v, %v", secret, enabled, err)
+		}
+		if err := repos.TwoFactor.SetPendingSecret(ctx, user.ID, "SECRET"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.TwoFactor.Enable(ctx, user.ID, 100, []string{"code-1", "code-2"}); err != nil {
+			t.Fatal(err)
+		}
+		if secret, enabled, err := repos.TwoFactor.GetSecret(ctx, user.ID); err != nil || secret != "SECRET" || !enabled {
+			t.Fatalf("GetSecret after Enable = %q, %v, %v", secret, enabled, err)
+		}
+		if got, _ := repos.Users.GetByID(ctx, user.ID); !got.TOTPEnabled {
+			t.Fatal("user not marked TOTPEnabled")
+		}
+		expectErr(t, "re-enrollment while enabled", repos.TwoFactor.SetPendingSecret(ctx, user.ID, "OTHER"), repository.ErrConflict)
+
+		// Steps only move forward
+		for _, tt := range []struct {
+			step int64
+			want bool
+		}{{100, false}, {99, false}, {101, true}, {101, false}} {
+			if ok, err := repos.TwoFactor.UseStep(ctx, user.ID, tt.step); err != nil || ok != tt.want {
+				t.Fatalf("UseStep(%d) = %v, %v; want %v", tt.step, ok, err, tt.want)
+			}
+		}
+
+		if err := repos.TwoFactor.Disable(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if secret, enabled, err := repos.TwoFactor.GetSecret(ctx, user.ID); err != nil || secret != "" || enabled {
+			t.Fatalf("GetSecret after Disable = %q, %v, %v", secret, enabled, err)
+		}
+		if ok, err := repos.TwoFactor.UseStep(ctx, user.ID, 200); err != nil || ok {
+			t.Fatalf("UseStep with 2FA off = %v, %v", ok, err)
+		}
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "budi")
+		other := createUser(t, repos, "sari")
+
+		repos.TwoFactor.SetPendingSecret(ctx, user.ID, "SECRET")
+		if err := repos.TwoFactor.Enable(ctx, user.ID, 1, []string{"code-1", "code-2"}); err != nil {
+			t.Fatal(err)
+		}
+
+		use := func(userID int, code string, want bool) {
+			t.Helper()
+			if ok, err := repos.TwoFactor.UseRecoveryCode(ctx, userID, code); err != nil || ok != want {
+				t.Fatalf("UseRecoveryCode(%d, %q) = %v, %v; want %v", userID, code, ok, err, want)
+			}
+		}
+		use(other.ID, "code-1", false)
+		use(user.ID, "unknown", false)
+		use(user.ID, "code-1", true)
+		use(user.ID, "code-1", false)
+		use(user.ID, "code-2", true)
+
+		// Enabling again replaces the codes
+		repos.TwoFactor.Disable(ctx, user.ID)
+		repos.TwoFactor.SetPendingSecret(ctx, user.ID, "SECRET")
+		if err := repos.TwoFactor.Enable(ctx, user.ID, 1, []string{"code-3"}); err != nil {
+			t.Fatal(err)
+		}
+		use(user.ID, "code-2", false)
+		use(user.ID, "code-3", true)
+	})
+}
+
+func TestPasswordResets(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := models.User{Username: "budi", Password: "old", Role: "user", MustChangePassword: true, CreatedBy: "test"}
+		if err := repos.Users.Create(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := repos.PasswordResets.Create(ctx, user.ID, "token-1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.PasswordResets.Create(ctx, user.ID, "token-2", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.PasswordResets.Create(ctx, user.ID, "expired", -time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		if active, err := repos.PasswordResets.CountActive(ctx, user.ID); err != nil || active != 2 {
+			t.Fatalf("CountActive = %d, %v; want the two unexpired tokens", active, err)
+		}
+
+		if userID, err := repos.PasswordResets.Lookup(ctx, "token-1"); err != nil || userID != user.ID {
+			t.Fatalf("Lookup = %d, %v", userID, err)
+		}
+		_, err := repos.PasswordResets.Lookup(ctx, "expired")
+		expectErr(t, "Lookup expired token", err, repository.ErrNotFound)
+
+		_, err = repos.PasswordResets.Reset(ctx, "expired", "new")
+		expectErr(t, "expired token", err, repository.ErrNotFound)
+		_, err = repos.PasswordResets.Reset(ctx, "unknown", "new")
+		expectErr(t, "unknown token", err, repository.ErrNotFound)
+
+		userID, err := repos.PasswordResets.Reset(ctx, "token-1", "new")
+		if err != nil || userID != user.ID {
+			t.Fatalf("Reset = %d, %v", userID, err)
+		}
+		got, _ := repos.Users.GetByUsername(ctx, "budi")
+		if got.Password != "new" || got.MustChangePassword {
+			t.Fatalf("after Reset = %+v", got)
+		}
+
+		// Used, and the user's other tokens are gone with it
+		_, err = repos.PasswordResets.Reset(ctx, "token-1", "again")
+		expectErr(t, "used token", err, repository.ErrNotFound)
+		_, err = repos.PasswordResets.Reset(ctx, "token-2", "again")
+		expectErr(t, "other token", err, repository.ErrNotFound)
+		_, err = repos.PasswordResets.Lookup(ctx, "token-1")
+		expectErr(t, "Lookup used token", err, repository.ErrNotFound)
+		if active, err := repos.PasswordResets.CountActive(ctx, user.ID); err != nil || active != 0 {
+			t.Fatalf("CountActive after Reset = %d, %v", active, err)
+		}
+	})
+}
+
+func TestNewPasswordRevokesLogins(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		other := createUser(t, repos, "sari")
+		if err := repos.Sessions.Create(ctx, other.ID, &models.Session{CSRFToken: "csrf"}, "other-session", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			name   string
+			change func(user models.User) error
+		}{
+			{"SetPassword", func(user models.User) error {
+				return repos.Users.SetPassword(ctx, user.ID, "new", user.Username)
+			}},
+			{"Reset", func(user models.User) error {
+				if err := repos.PasswordResets.Create(ctx, user.ID, "token-"+user.Username, time.Hour); err != nil {
+					return err
+				}
+				_, err := repos.PasswordResets.Reset(ctx, "token-"+user.Username, "new")
+				return err
+			}},
+		} {
+			user := createUser(t, repos, "budi-"+tt.name)
+			issuedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+			if err := repos.Sessions.Create(ctx, user.ID, &models.Session{CSRFToken: "csrf"}, "session-"+tt.name, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if err := repos.APIKeys.Create(ctx, user.ID, &models.APIKey{Name: "ci", Prefix: "bk_" + tt.name}, "key-"+tt.name, 0); err != nil {
+				t.Fatal(err)
+			}
+			if revoked, err := repos.Users.TokenRevoked(ctx, user.ID, issuedAt); err != nil || revoked {
+				t.Fatalf("%s: TokenRevoked before = %v, %v", tt.name, revoked, err)
+			}
+
+			if err := tt.change(user); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if revoked, err := repos.Users.TokenRevoked(ctx, user.ID, issuedAt); err != nil || !revoked {
+				t.Fatalf("%s: TokenRevoked after = %v, %v; want earlier tokens revoked", tt.name, revoked, err)
+			}
+			_, _, err := repos.Sessions.Authenticate(ctx, "session-"+tt.name)
+			expectErr(t, tt.name+": session", err, repository.ErrNotFound)
+			_, _, err = repos.APIKeys.Authenticate(ctx, "key-"+tt.name)
+			expectErr(t, tt.name+": API key", err, repository.ErrNotFound)
+		}
+
+		// Other accounts keep their logins
+		if _, _, err := repos.Sessions.Authenticate(ctx, "other-session"); err != nil {
+			t.Fatalf("other user's session: %v", err)
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "budi")
+		other := createUser(t, repos, "sari")
+
+		key := models.APIKey{Name: "ci", Prefix: "bk_1", Scopes: []string{"books:read", "categories:write"}}
+		if err := repos.APIKeys.Create(ctx, user.ID, &key, "hash-1", 24*time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if key.ID == 0 || key.CreatedAt.IsZero() || key.ExpiresAt == nil {
+			t.Fatalf("created = %+v", key)
+		}
+
+		found, owner, err := repos.APIKeys.Authenticate(ctx, "hash-1")
+		if err != nil || found.ID != key.ID || owner.ID != user.ID || len(found.Scopes) != 2 {
+			t.Fatalf("Authenticate = %+v, %+v, %v", found, owner, err)
+		}
+		_, _, err = repos.APIKeys.Authenticate(ctx, "hash-2")
+		expectErr(t, "unknown key", err, repository.ErrNotFound)
+
+		if err := repos.APIKeys.Touch(ctx, key.ID); err != nil {
+			t.Fatal(err)
+		}
+		active, err := repos.APIKeys.ListActive(ctx, user.ID)
+		if err != nil || len(active) != 1 || active[0].LastUsedAt == nil {
+			t.Fatalf("ListActive = %+v, %v", active, err)
+		}
+
+		expectErr(t, "revoke someone else's key", repos.APIKeys.Revoke(ctx, key.ID, other.ID), repository.ErrNotFound)
+		if err := repos.APIKeys.Revoke(ctx, key.ID, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		expectErr(t, "revoke twice", repos.APIKeys.Revoke(ctx, key.ID, user.ID), repository.ErrNotFound)
+		_, _, err = repos.APIKeys.Authenticate(ctx, "hash-1")
+		expectErr(t, "revoked key", err, repository.ErrNotFound)
+	})
+}
+
+func TestSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "budi")
+		other := createUser(t, repos, "sari")
+
+		session := models.Session{CSRFToken: "csrf", IPAddress: "10.0.0.1", UserAgent: "test"}
+		if err := repos.Sessions.Create(ctx, user.ID, &session, "hash-1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if session.ID == 0 || session.CreatedAt.IsZero() || session.LastSeenAt.IsZero() || !session.ExpiresAt.After(time.Now()) {
+			t.Fatalf("created = %+v", session)
+		}
+		expired := models.Session{CSRFToken: "csrf"}
+		if err := repos.Sessions.Create(ctx, user.ID, &expired, "hash-2", -time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		found, owner, err := repos.Sessions.Authenticate(ctx, "hash-1")
+		if err != nil || found.ID != session.ID || found.CSRFToken != "csrf" || owner.ID != user.ID {
+			t.Fatalf("Authenticate = %+v, %+v, %v", found, owner, err)
+		}
+		_, _, err = repos.Sessions.Authenticate(ctx, "hash-2")
+		expectErr(t, "expired session", err, repository.ErrNotFound)
+
+		if err := repos.Sessions.Touch(ctx, session.ID); err != nil {
+			t.Fatal(err)
+		}
+		active, err := repos.Sessions.ListActive(ctx, user.ID)
+		if err != nil || len(active) != 1 || active[0].IPAddress != "10.0.0.1" {
+			t.Fatalf("ListActive = %+v, %v", active, err)
+		}
+
+		expectErr(t, "revoke someone else's session", repos.Sessions.Revoke(ctx, session.ID, other.ID), repository.ErrNotFound)
+		if err := repos.Sessions.Revoke(ctx, session.ID, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = repos.Sessions.Authenticate(ctx, "hash-1")
+		expectErr(t, "revoked session", err, repository.ErrNotFound)
+	})
+}
+
+func TestSecurityEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "budi")
+
+		text := func(s string) *string { return &s }
+		events := []models.SecurityEvent{
+			{EventType: "login", Outcome: "failure", Username: text("budi"), UserID: &user.ID, IPAddress: text("10.0.0.1")},
+			{EventType: "login", Outcome: "success", Username: text("budi"), UserID: &user.ID, IPAddress: text("10.0.0.2")},
+			{EventType: "register", Outcome: "success", Username: text("sari"), Details: text("self-service")},
+		}
+		for _, event := range events {
+			if err := repos.SecurityEvents.Create(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tt := range []struct {
+			name   string
+			filter repository.SecurityEventFilter
+			want   int
+		}{
+			{"all", repository.SecurityEventFilter{Limit: 10}, 3},
+			{"event type", repository.SecurityEventFilter{EventType: "login", Limit: 10}, 2},
+			{"outcome", repository.SecurityEventFilter{EventType: "login", Outcome: "failure", Limit: 10}, 1},
+			{"username", repository.SecurityEventFilter{Username: "sari", Limit: 10}, 1},
+			{"user id", repository.SecurityEventFilter{UserID: user.ID, Limit: 10}, 2},
+			{"ip", repository.SecurityEventFilter{IPAddress: "10.0.0.2", Limit: 10}, 1},
+			{"since", repository.SecurityEventFilter{Since: time.Now().Add(time.Hour), Limit: 10}, 0},
+			{"until", repository.SecurityEventFilter{Until: time.Now().Add(-time.Hour), Limit: 10}, 0},
+			{"limit", repository.SecurityEventFilter{Limit: 2}, 2},
+			{"offset", repository.SecurityEventFilter{Limit: 10, Offset: 2}, 1},
+		} {
+			got, err := repos.SecurityEvents.List(ctx, tt.filter)
+			if err != nil || len(got) != tt.want {
+				t.Fatalf("%s: List = %d events, %v; want %d", tt.name, len(got), err, tt.want)
+			}
+		}
+
+		newest, err := repos.SecurityEvents.List(ctx, repository.SecurityEventFilter{Limit: 1})
+		if err != nil || len(newest) != 1 || newest[0].EventType != "register" || newest[0].Details == nil || *newest[0].Details != "self-service" {
+			t.Fatalf("newest event = %+v, %v", newest, err)
+		}
+	})
+}
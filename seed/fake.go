@@ -0,0 +1,76 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+var (
+	fakeCategories = []string{"Fiksi", "Sains", "Sejarah", "Teknologi", "Bisnis", "Biografi", "Anak-anak", "Filsafat"}
+
+	fakeSubjects = []string{
+		"Senja", "Hujan", "Laut", "Bumi", "Pelangi", "Angin", "Cahaya", "Bintang",
+		"Rembulan", "Kota", "Negeri", "Sungai", "Gunung", "Jalan", "Rumah", "Mimpi",
+		"Waktu", "Ingatan", "Api", "Kabut", "Pulau", "Hutan", "Langit", "Kopi",
+	}
+	fakeOpenings = []string{
+		"Rahasia", "Jejak", "Kisah", "Suara", "Sejarah", "Di Balik", "Menuju",
+		"Catatan", "Seni", "Dasar-Dasar", "Panduan", "Perjalanan",
+	}
+	fakeQualifiers = []string{
+		"yang Hilang", "Terakhir", "Pertama", "di Ujung Timur", "Tanpa Nama",
+		"untuk Pemula", "dan Kita", "Nusantara", "Abadi", "di Tengah Kota",
+	}
+)
+
+// Fake - n generated books spread over a fixed set of categories. The same
+// randSeed always gives the same books, so running it again upserts the
+// existing rows instead of adding n more.
+func Fake(n int, randSeed uint64) *Fixtures {
+	rng := rand.New(rand.NewPCG(randSeed, randSeed))
+	fixtures := &Fixtures{}
+	for _, name := range fakeCategories {
+		fixtures.Categories = append(fixtures.Categories, Category{Name: name})
+	}
+
+	seen := make(map[string]int)
+	for len(fixtures.Books) < n {
+		title := fakeTitle(rng)
+		seen[title]++
+		if seen[title] > 1 {
+			title = fmt.Sprintf("%s Jilid %d", title, seen[title])
+		}
+		category := fakeCategories[rng.IntN(len(fakeCategories))]
+		subject := strings.ToLower(fakeSubjects[rng.IntN(len(fakeSubjects))])
+
+		fixtures.Books = append(fixtures.Books, Book{
+			Title:       title,
+			Description: fmt.Sprintf("Buku %s tentang %s, %s dan orang-orang di sekitarnya.", strings.ToLower(category), subject, strings.ToLower(fakeSubjects[rng.IntN(len(fakeSubjects))])),
+			ImageURL:    "https://images.example.com/books/" + slug(title) + ".jpg",
+			ReleaseYear: 1980 + rng.IntN(2024-1980+1),
+			// Rp 25.000 - Rp 250.000 in steps of Rp 500
+			Price: 25000 + rng.IntN(451)*500,
+			// Mostly 60-400 pages, some up to 900
+			TotalPage: 60 + rng.IntN(340) + rng.IntN(2)*rng.IntN(500),
+			Category:  category,
+		})
+	}
+	return fixtures
+}
+
+func fakeTitle(rng *rand.Rand) string {
+	subject := fakeSubjects[rng.IntN(len(fakeSubjects))]
+	switch rng.IntN(3) {
+	case 0:
+		return fakeOpenings[rng.IntN(len(fakeOpenings))] + " " + subject
+	case 1:
+		return subject + " " + fakeQualifiers[rng.IntN(len(fakeQualifiers))]
+	default:
+		return fakeOpenings[rng.IntN(len(fakeOpenings))] + " " + subject + " " + fakeQualifiers[rng.IntN(len(fakeQualifiers))]
+	}
+}
+
+func slug(title string) string {
+	return strings.Join(strings.Fields(strings.ToLower(title)), "-")
+}
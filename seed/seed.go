@@ -0,0 +1,334 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/goccy/go-yaml"
+	"golang.org/x/crypto/bcrypt"
+	"mini-project-buku-sb-go-73-Agil/auth"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/models"
+)
+
+// CreatedBy - created_by / modified_by of seeded rows
+const CreatedBy = "seed"
+
+// Fixtures - Data to load. Categories are matched by name, books by title
+// and users by username, so loading the same fixtures again changes nothing.
+type Fixtures struct {
+	Categories []Category `json:"categories"`
+	Books      []Book     `json:"books"`
+	Users      []User     `json:"users"`
+}
+
+// Category - Category fixture
+type Category struct {
+	Name string `json:"name"`
+}
+
+// Book - Book fixture; Category is the category name (empty for none)
+type Book struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	ReleaseYear int    `json:"release_year"`
+	Price       int    `json:"price"`
+	TotalPage   int    `json:"total_page"`
+	Category    string `json:"category"`
+}
+
+// User - User fixture; the password is hashed on load
+type User struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+// Counts - What happened to the rows of one table
+type Counts struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+func (c Counts) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d unchanged", c.Created, c.Updated, c.Unchanged)
+}
+
+// Result - Counts per table
+type Result struct {
+	Categories Counts
+	Books      Counts
+	Users      Counts
+}
+
+// LoadFile - Read fixtures from a .yaml/.yml or .json file. Unknown fields
+// are rejected so typos do not go unnoticed.
+func LoadFile(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures Fixtures
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalWithOptions(data, &fixtures, yaml.DisallowUnknownField())
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&fixtures)
+	default:
+		return nil, fmt.Errorf("%s: unsupported fixture format (use .yaml, .yml or .json)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &fixtures, nil
+}
+
+// Append - Add the fixtures of other. Categories are only names, so one
+// listed in both is kept once; duplicate books and users fail Validate.
+func (f *Fixtures) Append(other *Fixtures) {
+	for _, category := range other.Categories {
+		if !f.hasCategory(category.Name) {
+			f.Categories = append(f.Categories, category)
+		}
+	}
+	f.Books = append(f.Books, other.Books...)
+	f.Users = append(f.Users, other.Users...)
+}
+
+func (f *Fixtures) hasCategory(name string) bool {
+	for _, category := range f.Categories {
+		if category.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate - Apply the API's rules (release year 1980-2024, at least one
+// page, ...) and reject duplicate natural keys
+func (f *Fixtures) Validate() error {
+	categories := make(map[string]bool)
+	for i, category := range f.Categories {
+		if strings.TrimSpace(category.Name) == "" {
+			return fmt.Errorf("category %d: name is required", i+1)
+		}
+		if categories[category.Name] {
+			return fmt.Errorf("category %q is listed twice", category.Name)
+		}
+		categories[category.Name] = true
+	}
+
+	titles := make(map[string]bool)
+	for i, book := range f.Books {
+		if err := binding.Validator.ValidateStruct(book.request()); err != nil {
+			return fmt.Errorf("book %d (%q): %v", i+1, book.Title, err)
+		}
+		if titles[book.Title] {
+			return fmt.Errorf("book %q is listed twice", book.Title)
+		}
+		titles[book.Title] = true
+	}
+
+	usernames := make(map[string]bool)
+	for i, user := range f.Users {
+		if err := auth.ValidateUsername(user.Username); err != nil {
+			return fmt.Errorf("user %d (%q): %v", i+1, user.Username, err)
+		}
+		if err := auth.ValidatePassword(user.Password, user.Username); err != nil {
+			return fmt.Errorf("user %q: %v", user.Username, err)
+		}
+		if user.Role != "" && user.Role != "user" && user.Role != "admin" {
+			return fmt.Errorf("user %q: role must be user or admin", user.Username)
+		}
+		if usernames[user.Username] {
+			return fmt.Errorf("user %q is listed twice", user.Username)
+		}
+		usernames[user.Username] = true
+	}
+	return nil
+}
+
+func (b Book) request() models.BookRequest {
+	return models.BookRequest{
+		Title:       b.Title,
+		Description: b.Description,
+		ImageURL:    b.ImageURL,
+		ReleaseYear: b.ReleaseYear,
+		Price:       b.Price,
+		TotalPage:   b.TotalPage,
+	}
+}
+
+// Apply - Upsert validated fixtures in one transaction
+func Apply(ctx context.Context, db *sql.DB, fixtures *Fixtures) (Result, error) {
+	var result Result
+	err := database.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		// WithTx may run this more than once
+		result = Result{}
+		categoryIDs := make(map[string]int)
+
+		for _, category := range fixtures.Categories {
+			id, err := upsertCategory(ctx, tx, category, &result.Categories)
+			if err != nil {
+				return fmt.Errorf("category %q: %v", category.Name, err)
+			}
+			categoryIDs[category.Name] = id
+		}
+
+		for _, book := range fixtures.Books {
+			categoryID := 0
+			if book.Category != "" {
+				id, ok := categoryIDs[book.Category]
+				if !ok {
+					// Categories created earlier, e.g. through the API
+					err := tx.QueryRowContext(ctx, "SELECT id FROM categories WHERE name = $1 ORDER BY id LIMIT 1", book.Category).Scan(&id)
+					if err == sql.ErrNoRows {
+						return fmt.Errorf("book %q: category %q not found", book.Title, book.Category)
+					}
+					if err != nil {
+						return err
+					}
+					categoryIDs[book.Category] = id
+				}
+				categoryID = id
+			}
+			if err := upsertBook(ctx, tx, book, categoryID, &result.Books); err != nil {
+				return fmt.Errorf("book %q: %v", book.Title, err)
+			}
+		}
+
+		for _, user := range fixtures.Users {
+			if err := upsertUser(ctx, tx, user, &result.Users); err != nil {
+				return fmt.Errorf("user %q: %v", user.Username, err)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func upsertCategory(ctx context.Context, tx *sql.Tx, category Category, counts *Counts) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx, "SELECT id FROM categories WHERE name = $1 ORDER BY id LIMIT 1", category.Name).Scan(&id)
+	if err == nil {
+		counts.Unchanged++
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO categories (name, created_by) VALUES ($1, $2) RETURNING id", category.Name, CreatedBy).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	counts.Created++
+	return id, nil
+}
+
+func upsertBook(ctx context.Context, tx *sql.Tx, book Book, categoryID int, counts *Counts) error {
+	var id, releaseYear, price, totalPage, currentCategory int
+	var description, imageURL string
+	err := tx.QueryRowContext(ctx, `
+        SELECT id, COALESCE(description, ''), COALESCE(image_url, ''), release_year, price, total_page, COALESCE(category_id, 0)
+        FROM books WHERE title = $1 ORDER BY id LIMIT 1
+    `, book.Title).Scan(&id, &description, &imageURL, &releaseYear, &price, &totalPage, &currentCategory)
+	if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO books (title, description, image_url, release_year,
+                               price, total_page, thickness, category_id, created_by)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9)
+        `, book.Title, book.Description, book.ImageURL, book.ReleaseYear,
+			book.Price, book.TotalPage, models.ThicknessFor(book.TotalPage), categoryID, CreatedBy)
+		if err == nil {
+			counts.Created++
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if description == book.Description && imageURL == book.ImageURL && releaseYear == book.ReleaseYear &&
+		price == book.Price && totalPage == book.TotalPage && currentCategory == categoryID {
+		counts.Unchanged++
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `
+        UPDATE books
+        SET description = $1, image_url = $2, release_year = $3, price = $4,
+            total_page = $5, thickness = $6, category_id = NULLIF($7, 0),
+            modified_at = CURRENT_TIMESTAMP, modified_by = $8
+        WHERE id = $9
+    `, book.Description, book.ImageURL, book.ReleaseYear, book.Price,
+		book.TotalPage, models.ThicknessFor(book.TotalPage), categoryID, CreatedBy, id)
+	if err == nil {
+		counts.Updated++
+	}
+	return err
+}
+
+func upsertUser(ctx context.Context, tx *sql.Tx, user User, counts *Counts) error {
+	role := user.Role
+	if role == "" {
+		role = "user"
+	}
+
+	var id int
+	var hash, email, currentRole string
+	err := tx.QueryRowContext(ctx, "SELECT id, password, COALESCE(email, ''), role FROM users WHERE username = $1", user.Username).Scan(&id, &hash, &email, &currentRole)
+	if err == sql.ErrNoRows {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO users (username, password, email, role, created_by)
+            VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+        `, user.Username, string(hashed), user.Email, role, CreatedBy)
+		if err == nil {
+			counts.Created++
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep the stored hash when the password still matches
+	passwordMatches := bcrypt.CompareHashAndPassword([]byte(hash), []byte(user.Password)) == nil
+	if passwordMatches && email == user.Email && currentRole == role {
+		counts.Unchanged++
+		return nil
+	}
+	if !passwordMatches {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		hash = string(hashed)
+	}
+	_, err = tx.ExecContext(ctx, `
+        UPDATE users
+        SET password = $1, email = NULLIF($2, ''), role = $3,
+            modified_at = CURRENT_TIMESTAMP, modified_by = $4
+        WHERE id = $5
+    `, hash, user.Email, role, CreatedBy, id)
+	if err == nil {
+		counts.Updated++
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package seed_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/database/dbtest"
+	"mini-project-buku-sb-go-73-Agil/seed"
+)
+
+func TestMain(m *testing.M) {
+	// Migrations log every step
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// writeFile - File name in a temp dir holding content
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	fixtures, err := seed.LoadFile("../fixtures/dev.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures.Categories) != 3 || len(fixtures.Books) != 6 || len(fixtures.Users) != 2 {
+		t.Fatalf("dev fixtures = %d categories, %d books, %d users", len(fixtures.Categories), len(fixtures.Books), len(fixtures.Users))
+	}
+	if err := fixtures.Validate(); err != nil {
+		t.Fatalf("dev fixtures do not validate: %v", err)
+	}
+
+	fixtures, err = seed.LoadFile(writeFile(t, "books.json", `{"books": [{"title": "Laskar Pelangi", "release_year": 2005, "price": 89000, "total_page": 529}]}`))
+	if err != nil || len(fixtures.Books) != 1 || fixtures.Books[0].TotalPage != 529 {
+		t.Fatalf("JSON fixtures = %+v, %v", fixtures, err)
+	}
+
+	for name, content := range map[string]string{
+		"typo.yaml":  "books:\n  - title: Laskar Pelangi\n    relase_year: 2005\n",
+		"typo.json":  `{"book": []}`,
+		"books.toml": "",
+	} {
+		if _, err := seed.LoadFile(writeFile(t, name, content)); err == nil {
+			t.Errorf("%s: loaded without error", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	book := seed.Book{Title: "Laskar Pelangi", ReleaseYear: 2005, Price: 89000, TotalPage: 529}
+	user := seed.User{Username: "pembaca", Password: "pembaca-dev-2024"}
+	oldBook, noPages := book, book
+	oldBook.ReleaseYear = 1979
+	noPages.TotalPage = 0
+	admin, superuser := user, user
+	admin.Role = "admin"
+	superuser.Role = "root"
+
+	valid := seed.Fixtures{Categories: []seed.Category{{Name: "Fiksi"}}, Books: []seed.Book{book}, Users: []seed.User{admin}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid fixtures: %v", err)
+	}
+
+	for name, fixtures := range map[string]seed.Fixtures{
+		"empty category":     {Categories: []seed.Category{{Name: " "}}},
+		"duplicate category": {Categories: []seed.Category{{Name: "Fiksi"}, {Name: "Fiksi"}}},
+		"release year":       {Books: []seed.Book{oldBook}},
+		"no pages":           {Books: []seed.Book{noPages}},
+		"duplicate book":     {Books: []seed.Book{book, book}},
+		"weak password":      {Users: []seed.User{{Username: "pembaca", Password: "pembaca"}}},
+		"unknown role":       {Users: []seed.User{superuser}},
+		"duplicate user":     {Users: []seed.User{user, user}},
+	} {
+		if err := fixtures.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	fixtures := &seed.Fixtures{Categories: []seed.Category{{Name: "Fiksi"}}, Books: []seed.Book{{Title: "Laskar Pelangi"}}}
+	fixtures.Append(&seed.Fixtures{Categories: []seed.Category{{Name: "Fiksi"}, {Name: "Sejarah"}}, Books: []seed.Book{{Title: "Api Sejarah"}}})
+
+	if len(fixtures.Categories) != 2 || len(fixtures.Books) != 2 {
+		t.Fatalf("fixtures = %+v, want Fiksi once and both books", fixtures)
+	}
+}
+
+func TestFake(t *testing.T) {
+	fixtures := seed.Fake(200, 42)
+	if len(fixtures.Books) != 200 {
+		t.Fatalf("%d books, want 200", len(fixtures.Books))
+	}
+	if err := fixtures.Validate(); err != nil {
+		t.Fatalf("fake fixtures do not validate: %v", err)
+	}
+
+	again := seed.Fake(200, 42)
+	other := seed.Fake(200, 43)
+	sameAsOther := true
+	for i, book := range fixtures.Books {
+		if again.Books[i] != book {
+			t.Fatalf("book %d differs for the same seed: %+v and %+v", i, book, again.Books[i])
+		}
+		sameAsOther = sameAsOther && other.Books[i] == book
+	}
+	if sameAsOther {
+		t.Fatal("another seed gave the same books")
+	}
+}
+
+func TestApply(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) {
+		ctx := context.Background()
+		fixtures, err := seed.LoadFile("../fixtures/dev.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := seed.Apply(ctx, database.DB, fixtures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Categories.Created != 3 || result.Books.Created != 6 || result.Users.Created != 2 {
+			t.Fatalf("first load: %+v, want everything created", result)
+		}
+
+		// Loading again changes nothing
+		result, err = seed.Apply(ctx, database.DB, fixtures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Categories.Unchanged != 3 || result.Books.Unchanged != 6 || result.Users.Unchanged != 2 {
+			t.Fatalf("second load: %+v, want everything unchanged", result)
+		}
+
+		fixtures.Books[0].Price++
+		fixtures.Users[1].Role = "admin"
+		result, err = seed.Apply(ctx, database.DB, fixtures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Books.Updated != 1 || result.Users.Updated != 1 {
+			t.Fatalf("edited load: %+v, want one book and one user updated", result)
+		}
+		var role string
+		if err := database.DB.QueryRow("SELECT role FROM users WHERE username = $1", "pembaca").Scan(&role); err != nil || role != "admin" {
+			t.Fatalf("role = %q, %v; want admin", role, err)
+		}
+
+		// A book in an unknown category rolls back the whole load
+		broken := &seed.Fixtures{
+			Categories: []seed.Category{{Name: "Puisi"}},
+			Books:      []seed.Book{{Title: "Aku", ReleaseYear: 1986, Price: 50000, TotalPage: 120, Category: "Drama"}},
+		}
+		if _, err := seed.Apply(ctx, database.DB, broken); err == nil || !strings.Contains(err.Error(), "Drama") {
+			t.Fatalf("unknown category: err = %v", err)
+		}
+		var n int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM categories WHERE name = $1", "Puisi").Scan(&n); err != nil || n != 0 {
+			t.Fatalf("categories named Puisi = %d, %v; want the load rolled back", n, err)
+		}
+	})
+}
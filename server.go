@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/controllers"
+	"mini-project-buku-sb-go-73-Agil/database"
+	"mini-project-buku-sb-go-73-Agil/lifecycle"
+)
+
+// appHandler - Serves the API once it is set; until then (migrations are
+// running) /livez answers 200 and every other request 503, so load
+// balancers keep traffic away without the instance being restarted
+type appHandler struct {
+	api atomic.Pointer[http.Handler]
+}
+
+// Set - Start serving the API with handler
+func (h *appHandler) Set(handler http.Handler) {
+	h.api.Store(&handler)
+}
+
+func (h *appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if api := h.api.Load(); api != nil {
+		(*api).ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	switch r.URL.Path {
+	case "/livez":
+		w.Write([]byte(`{"status":"ok"}`))
+		return
+	case "/readyz", "/health":
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"` + lifecycle.Current().String() + `"}`))
+		return
+	}
+	w.Header().Set("Retry-After", "5")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"error":"Service is starting, try again shortly"}`))
+}
+
+// newServer - HTTP server with the timeouts from SERVER_*_TIMEOUT
+func newServer(cfg config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// listen - Serve until Shutdown; any other error ends the process
+func listen(srv *http.Server) {
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("Failed to start server", err)
+	}
+}
+
+// shutdown - Stop accepting connections and let in-flight requests finish
+// within SERVER_SHUTDOWN_TIMEOUT (connections still open after that are
+// closed), then stop the background workers and close the database pools
+func shutdown(srv *http.Server, timeout time.Duration, stopWorkers func()) {
+	lifecycle.Set(lifecycle.Draining)
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", timeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Requests still running at the shutdown deadline, closing their connections", "error", err)
+		srv.Close()
+	}
+
+	stopWorkers()
+	if err := controllers.WaitBackground(ctx); err != nil {
+		slog.Warn("Background work still running at the shutdown deadline", "error", err)
+	}
+
+	if err := database.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
+	}
+	slog.Info("Server stopped")
+}
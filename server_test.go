@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"mini-project-buku-sb-go-73-Agil/config"
+	"mini-project-buku-sb-go-73-Agil/lifecycle"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// startServer - newServer for handler, serving on a free local port
+func startServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	t.Helper()
+	t.Cleanup(func() { lifecycle.Set(lifecycle.Starting) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(config.Default().Server, handler)
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return srv, "http://" + listener.Addr().String()
+}
+
+func TestAppHandlerWhileStarting(t *testing.T) {
+	app := &appHandler{}
+	for path, status := range map[string]int{"/livez": http.StatusOK, "/readyz": http.StatusServiceUnavailable, "/health": http.StatusServiceUnavailable, "/api/books": http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != status {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, status)
+		}
+		if status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: 503 without Retry-After", path)
+		}
+	}
+
+	app.Set(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }))
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/books", nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want the API to answer once set", w.Code)
+	}
+}
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	stopped, workersStopped := make(chan struct{}), false
+	go func() {
+		shutdown(srv, 5*time.Second, func() { workersStopped = true })
+		close(stopped)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if lifecycle.Current() != lifecycle.Draining {
+		t.Fatalf("state = %s during the shutdown, want shutting_down", lifecycle.Current())
+	}
+	select {
+	case <-stopped:
+		t.Fatal("shutdown returned while a request was running")
+	default:
+	}
+
+	close(release)
+	if got := <-status; got != http.StatusOK {
+		t.Fatalf("in-flight request: status = %d, want 200", got)
+	}
+	<-stopped
+	if !workersStopped {
+		t.Fatal("background workers not stopped")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	srv, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+
+	failed := make(chan bool, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		failed <- err != nil
+	}()
+	<-started
+
+	start := time.Now()
+	shutdown(srv, 50*time.Millisecond, func() {})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("shutdown took %v, want it to stop at the deadline", elapsed)
+	}
+	if !<-failed {
+		t.Fatal("request still running at the deadline was answered")
+	}
+}